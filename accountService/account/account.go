@@ -376,7 +376,7 @@ func GetTotalReservations(w http.ResponseWriter, r *http.Request) {
 
 	// Count non-canceled reservations for the user
 	var totalReservations int
-	query := `SELECT COUNT(*) FROM ElectriGo_VehicleDB.Reservations WHERE user_id = ? AND status IN ('active', 'completed')`
+	query := `SELECT COUNT(*) FROM ElectriGo_VehicleDB.Reservations WHERE user_id = ? AND status IN ('Confirmed', 'InProgress', 'Completed')`
 	err = db.QueryRow(query, userID).Scan(&totalReservations)
 	if err != nil {
 		log.Printf("Error fetching total reservations: %v", err)
@@ -0,0 +1,436 @@
+package analytics
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/staff"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DB variable for global database connection for analytics service
+var db *sql.DB
+
+// Initialize the database connection for analytics service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Analytics connected successfully.")
+}
+
+// Reservation statuses that count as the vehicle being rented out
+const rentedStatuses = lifecycle.RentedStatuses
+
+// Default reporting window when no date range is given
+const defaultWindow = 30 * 24 * time.Hour
+
+// filters holds the date range and station filter shared by every analytics endpoint
+type filters struct {
+	From      time.Time
+	To        time.Time
+	StationID int
+	CSV       bool
+}
+
+// parseFilters reads from, to, station_id and format from the query string. Dates may be
+// given as RFC 3339 timestamps or as YYYY-MM-DD.
+func parseFilters(r *http.Request) (filters, error) {
+	query := r.URL.Query()
+	f := filters{To: time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)}
+	f.From = f.To.Add(-defaultWindow)
+
+	var err error
+	if toParam := query.Get("to"); toParam != "" {
+		if f.To, err = parseDate(toParam); err != nil {
+			return f, fmt.Errorf("invalid to date")
+		}
+	}
+	if fromParam := query.Get("from"); fromParam != "" {
+		if f.From, err = parseDate(fromParam); err != nil {
+			return f, fmt.Errorf("invalid from date")
+		}
+	}
+	if !f.To.After(f.From) {
+		return f, fmt.Errorf("to must be after from")
+	}
+	if stationParam := query.Get("station_id"); stationParam != "" {
+		if f.StationID, err = strconv.Atoi(stationParam); err != nil {
+			return f, fmt.Errorf("invalid station_id")
+		}
+	}
+	switch query.Get("format") {
+	case "", "json":
+	case "csv":
+		f.CSV = true
+	default:
+		return f, fmt.Errorf("format must be json or csv")
+	}
+	return f, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// authorize allows only fleet managers, identified by the user_id query parameter
+func authorize(w http.ResponseWriter, r *http.Request) bool {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "Missing or invalid user_id", http.StatusBadRequest)
+		return false
+	}
+	isManager, err := staff.IsFleetManager(userID)
+	if err != nil {
+		log.Println("Error checking fleet manager role:", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return false
+	}
+	if !isManager {
+		http.Error(w, "Analytics are only available to fleet managers", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// respond writes the result as JSON, or as a CSV download when requested
+func respond(w http.ResponseWriter, f filters, name string, result interface{}, header []string, records [][]string) {
+	if !f.CSV {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("%s_%s_%s.csv", name, f.From.Format("20060102"), f.To.Format("20060102"))))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	writer.WriteAll(records)
+}
+
+// rental is a reservation reduced to the fields analytics needs
+type rental struct {
+	VehicleID   int
+	VehicleName string
+	Start       time.Time
+	End         time.Time
+}
+
+// fetchRentals loads rentals overlapping the window, filtered by pick-up station
+func fetchRentals(f filters) ([]rental, error) {
+	rows, err := db.Query(`
+        SELECT r.vehicle_id, v.vehicle_name, r.start_time, r.end_time
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.status IN (`+rentedStatuses+`) AND r.start_time < ? AND r.end_time > ? AND (? = 0 OR r.pickup_station_id = ?)`,
+		f.To, f.From, f.StationID, f.StationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rentals []rental
+	for rows.Next() {
+		var rent rental
+		if err := rows.Scan(&rent.VehicleID, &rent.VehicleName, &rent.Start, &rent.End); err != nil {
+			return nil, err
+		}
+		rentals = append(rentals, rent)
+	}
+	return rentals, rows.Err()
+}
+
+// overlapHours returns how many hours of [start, end) fall inside [from, to)
+func overlapHours(start, end, from, to time.Time) float64 {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start).Hours()
+}
+
+func round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// UtilisationPeriod is the share of a period during which a vehicle was rented
+type UtilisationPeriod struct {
+	VehicleID      int       `json:"vehicle_id"`
+	VehicleName    string    `json:"vehicle_name"`
+	PeriodStart    time.Time `json:"period_start"`
+	BookedHours    float64   `json:"booked_hours"`
+	UtilisationPct float64   `json:"utilisation_percentage"`
+}
+
+// GetUtilisation reports utilisation per vehicle per day or week (granularity=day|week)
+func GetUtilisation(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	f, err := parseFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	period := 24 * time.Hour
+	switch r.URL.Query().Get("granularity") {
+	case "", "day":
+	case "week":
+		period = 7 * 24 * time.Hour
+	default:
+		http.Error(w, "granularity must be day or week", http.StatusBadRequest)
+		return
+	}
+
+	vehicles, err := db.Query("SELECT vehicle_id, vehicle_name FROM Vehicles WHERE (? = 0 OR station_id = ?) ORDER BY vehicle_id", f.StationID, f.StationID)
+	if err != nil {
+		log.Println("Error fetching vehicles for utilisation:", err)
+		http.Error(w, "Error computing utilisation", http.StatusInternalServerError)
+		return
+	}
+	defer vehicles.Close()
+
+	rentals, err := fetchRentals(f)
+	if err != nil {
+		log.Println("Error fetching rentals for utilisation:", err)
+		http.Error(w, "Error computing utilisation", http.StatusInternalServerError)
+		return
+	}
+	byVehicle := make(map[int][]rental)
+	for _, rent := range rentals {
+		byVehicle[rent.VehicleID] = append(byVehicle[rent.VehicleID], rent)
+	}
+
+	// Weeks start on Monday; days start at midnight UTC
+	firstPeriod := f.From.Truncate(24 * time.Hour)
+	if period > 24*time.Hour {
+		firstPeriod = firstPeriod.AddDate(0, 0, -((int(firstPeriod.Weekday()) + 6) % 7))
+	}
+
+	result := []UtilisationPeriod{}
+	var records [][]string
+	for vehicles.Next() {
+		var vehicleID int
+		var vehicleName string
+		if err := vehicles.Scan(&vehicleID, &vehicleName); err != nil {
+			log.Println("Error scanning vehicle for utilisation:", err)
+			http.Error(w, "Error computing utilisation", http.StatusInternalServerError)
+			return
+		}
+
+		for periodStart := firstPeriod; periodStart.Before(f.To); periodStart = periodStart.Add(period) {
+			periodEnd := periodStart.Add(period)
+			var booked float64
+			for _, rent := range byVehicle[vehicleID] {
+				booked += overlapHours(rent.Start, rent.End, periodStart, periodEnd)
+			}
+			entry := UtilisationPeriod{
+				VehicleID:      vehicleID,
+				VehicleName:    vehicleName,
+				PeriodStart:    periodStart,
+				BookedHours:    round(booked, 2),
+				UtilisationPct: round(booked/period.Hours()*100, 2),
+			}
+			result = append(result, entry)
+			records = append(records, []string{strconv.Itoa(vehicleID), vehicleName, periodStart.Format("2006-01-02"),
+				formatFloat(entry.BookedHours), formatFloat(entry.UtilisationPct)})
+		}
+	}
+
+	respond(w, f, "utilisation", result,
+		[]string{"vehicle_id", "vehicle_name", "period_start", "booked_hours", "utilisation_percentage"}, records)
+}
+
+// VehicleRevenue is the invoiced revenue of a vehicle over the window
+type VehicleRevenue struct {
+	VehicleID    int     `json:"vehicle_id"`
+	VehicleName  string  `json:"vehicle_name"`
+	Reservations int     `json:"reservations"`
+	Revenue      float64 `json:"revenue"`
+}
+
+// GetRevenue reports invoiced revenue per vehicle for reservations starting in the window. Combined
+// group invoices count towards each vehicle by the line items of its reservation.
+func GetRevenue(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	f, err := parseFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT v.vehicle_id, v.vehicle_name, COUNT(DISTINCT r.reservation_id), COALESCE(SUM(i.amount), 0)
+        FROM Vehicles v
+        LEFT JOIN Reservations r ON r.vehicle_id = v.vehicle_id AND r.start_time >= ? AND r.start_time < ?
+             AND (? = 0 OR r.pickup_station_id = ?)
+        LEFT JOIN (
+            SELECT reservation_id, final_amount AS amount FROM ElectriGo_BillingDB.Invoices WHERE reservation_id IS NOT NULL
+            UNION ALL
+            SELECT l.reservation_id, l.amount FROM ElectriGo_BillingDB.InvoiceLineItems l
+            JOIN ElectriGo_BillingDB.Invoices gi ON l.invoice_id = gi.invoice_id
+            WHERE gi.group_id IS NOT NULL
+        ) i ON i.reservation_id = r.reservation_id
+        WHERE (? = 0 OR v.station_id = ?)
+        GROUP BY v.vehicle_id, v.vehicle_name
+        ORDER BY v.vehicle_id`, f.From, f.To, f.StationID, f.StationID, f.StationID, f.StationID)
+	if err != nil {
+		log.Println("Error fetching revenue:", err)
+		http.Error(w, "Error computing revenue", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	result := []VehicleRevenue{}
+	var records [][]string
+	for rows.Next() {
+		var revenue VehicleRevenue
+		if err := rows.Scan(&revenue.VehicleID, &revenue.VehicleName, &revenue.Reservations, &revenue.Revenue); err != nil {
+			log.Println("Error scanning revenue:", err)
+			http.Error(w, "Error computing revenue", http.StatusInternalServerError)
+			return
+		}
+		result = append(result, revenue)
+		records = append(records, []string{strconv.Itoa(revenue.VehicleID), revenue.VehicleName,
+			strconv.Itoa(revenue.Reservations), formatFloat(revenue.Revenue)})
+	}
+
+	respond(w, f, "revenue", result, []string{"vehicle_id", "vehicle_name", "reservations", "revenue"}, records)
+}
+
+// Summary holds fleet-wide rental statistics over the window
+type Summary struct {
+	From               time.Time `json:"from"`
+	To                 time.Time `json:"to"`
+	TotalReservations  int       `json:"total_reservations"`
+	Cancelled          int       `json:"cancelled_reservations"`
+	CancellationRate   float64   `json:"cancellation_rate_percentage"`
+	AverageRentalHours float64   `json:"average_rental_hours"`
+}
+
+// GetSummary reports the average rental length and cancellation rate for reservations starting in the window
+func GetSummary(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	f, err := parseFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary := Summary{From: f.From, To: f.To}
+	var averageMinutes sql.NullFloat64
+	err = db.QueryRow(`
+        SELECT COUNT(*),
+               COALESCE(SUM(status = 'Cancelled'), 0),
+               AVG(CASE WHEN status IN (`+rentedStatuses+`) THEN TIMESTAMPDIFF(MINUTE, start_time, end_time) END)
+        FROM Reservations
+        WHERE start_time >= ? AND start_time < ? AND (? = 0 OR pickup_station_id = ?)`,
+		f.From, f.To, f.StationID, f.StationID).Scan(&summary.TotalReservations, &summary.Cancelled, &averageMinutes)
+	if err != nil {
+		log.Println("Error computing rental summary:", err)
+		http.Error(w, "Error computing summary", http.StatusInternalServerError)
+		return
+	}
+	if summary.TotalReservations > 0 {
+		summary.CancellationRate = round(float64(summary.Cancelled)/float64(summary.TotalReservations)*100, 2)
+	}
+	summary.AverageRentalHours = round(averageMinutes.Float64/60, 2)
+
+	respond(w, f, "summary", summary,
+		[]string{"from", "to", "total_reservations", "cancelled_reservations", "cancellation_rate_percentage", "average_rental_hours"},
+		[][]string{{f.From.Format(time.RFC3339), f.To.Format(time.RFC3339), strconv.Itoa(summary.TotalReservations),
+			strconv.Itoa(summary.Cancelled), formatFloat(summary.CancellationRate), formatFloat(summary.AverageRentalHours)}})
+}
+
+// HourDemand is the demand seen in one hour of the day across the window
+type HourDemand struct {
+	Hour                int     `json:"hour"`
+	ReservationsStarted int     `json:"reservations_started"`
+	BookedVehicleHours  float64 `json:"booked_vehicle_hours"`
+}
+
+// GetPeakHours reports demand for each hour of the day (UTC) across the window
+func GetPeakHours(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	f, err := parseFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rentals, err := fetchRentals(f)
+	if err != nil {
+		log.Println("Error fetching rentals for peak hours:", err)
+		http.Error(w, "Error computing peak hours", http.StatusInternalServerError)
+		return
+	}
+
+	demand := make([]HourDemand, 24)
+	for hour := range demand {
+		demand[hour].Hour = hour
+	}
+	for _, rent := range rentals {
+		if !rent.Start.Before(f.From) {
+			demand[rent.Start.Hour()].ReservationsStarted++
+		}
+		// Spread the part of the rental inside the window over the clock hours it covers
+		start, end := rent.Start, rent.End
+		if start.Before(f.From) {
+			start = f.From
+		}
+		if end.After(f.To) {
+			end = f.To
+		}
+		for hourStart := start.Truncate(time.Hour); hourStart.Before(end); hourStart = hourStart.Add(time.Hour) {
+			demand[hourStart.Hour()].BookedVehicleHours += overlapHours(start, end, hourStart, hourStart.Add(time.Hour))
+		}
+	}
+
+	var records [][]string
+	for hour := range demand {
+		demand[hour].BookedVehicleHours = round(demand[hour].BookedVehicleHours, 2)
+		records = append(records, []string{strconv.Itoa(hour), strconv.Itoa(demand[hour].ReservationsStarted),
+			formatFloat(demand[hour].BookedVehicleHours)})
+	}
+
+	respond(w, f, "peak_hours", demand, []string{"hour", "reservations_started", "booked_vehicle_hours"}, records)
+}
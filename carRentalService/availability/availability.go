@@ -0,0 +1,265 @@
+package availability
+
+import (
+	"carRentalService/lifecycle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for availability service
+var db *sql.DB
+
+// Initialize the database connection for availability service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for availability connected successfully.")
+}
+
+// Interval types shown on the calendar
+const (
+	IntervalReservation  = "Reservation"
+	IntervalBuffer       = "Buffer"
+	IntervalMaintenance  = "Maintenance"
+	IntervalWaitlistHold = "WaitlistHold"
+	IntervalOutOfService = "OutOfService"
+)
+
+// Calendar defaults and limits
+const (
+	defaultBuffer      = 30 * time.Minute
+	defaultWindow      = 7 * 24 * time.Hour
+	maxWindow          = 31 * 24 * time.Hour
+	defaultGranularity = time.Hour
+	minGranularity     = 15 * time.Minute
+	maxSlots           = 3000
+)
+
+// Interval struct represents a period in which a vehicle cannot be booked
+type Interval struct {
+	Type        string    `json:"type"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	ReferenceID int       `json:"reference_id,omitempty"` // Reservation, maintenance or waitlist ID
+}
+
+// Slot struct represents a free period on the calendar
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Calendar struct represents a vehicle's availability over a window
+type Calendar struct {
+	VehicleID   int        `json:"vehicle_id"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Granularity string     `json:"granularity"`
+	Occupied    []Interval `json:"occupied"`
+	FreeSlots   []Slot     `json:"free_slots"`
+}
+
+// Buffer returns the turnaround time kept free after each reservation for cleaning and charging,
+// configurable in minutes with RESERVATION_BUFFER_MINUTES
+func Buffer() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("RESERVATION_BUFFER_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultBuffer
+}
+
+// OccupiedIntervals returns the reservations and waitlist offers, their turnaround buffers and the
+// maintenance windows of a vehicle that overlap a period, ordered by start time
+func OccupiedIntervals(vehicleID int, from time.Time, to time.Time) ([]Interval, error) {
+	buffer := Buffer()
+	intervals := []Interval{}
+
+	rows, err := db.Query(`
+        SELECT reservation_id, start_time, end_time FROM Reservations
+        WHERE vehicle_id = ? AND status IN (`+lifecycle.HoldingStatuses+`) AND `+lifecycle.UnexpiredHold+` AND start_time < ? AND end_time > ?`,
+		vehicleID, time.Now(), to, from.Add(-buffer))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var interval Interval
+		if err := rows.Scan(&interval.ReferenceID, &interval.Start, &interval.End); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		interval.Type = IntervalReservation
+		intervals = append(intervals, interval)
+		if buffer > 0 {
+			intervals = append(intervals, Interval{Type: IntervalBuffer, Start: interval.End, End: interval.End.Add(buffer), ReferenceID: interval.ReferenceID})
+		}
+	}
+	rows.Close()
+
+	// Vehicles offered to waitlisted users are held until the offer is accepted or lapses
+	rows, err = db.Query(`
+        SELECT waitlist_id, start_time, end_time FROM WaitlistEntries
+        WHERE offered_vehicle_id = ? AND status = 'Offered' AND offer_expires_at > ? AND start_time < ? AND end_time > ?`,
+		vehicleID, time.Now(), to, from.Add(-buffer))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		interval := Interval{Type: IntervalWaitlistHold}
+		if err := rows.Scan(&interval.ReferenceID, &interval.Start, &interval.End); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		intervals = append(intervals, interval)
+		if buffer > 0 {
+			intervals = append(intervals, Interval{Type: IntervalBuffer, Start: interval.End, End: interval.End.Add(buffer), ReferenceID: interval.ReferenceID})
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+        SELECT maintenance_id, planned_start, planned_end FROM MaintenanceRecords
+        WHERE vehicle_id = ? AND status IN ('Scheduled', 'InProgress') AND planned_start < ? AND planned_end > ?`,
+		vehicleID, to, from)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		interval := Interval{Type: IntervalMaintenance}
+		if err := rows.Scan(&interval.ReferenceID, &interval.Start, &interval.End); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		intervals = append(intervals, interval)
+	}
+	rows.Close()
+
+	// Clip to the requested period, dropping buffers that end before it
+	clipped := intervals[:0]
+	for _, interval := range intervals {
+		if !interval.End.After(from) || !interval.Start.Before(to) {
+			continue
+		}
+		if interval.Start.Before(from) {
+			interval.Start = from
+		}
+		if interval.End.After(to) {
+			interval.End = to
+		}
+		clipped = append(clipped, interval)
+	}
+	sort.Slice(clipped, func(i, j int) bool {
+		return clipped[i].Start.Before(clipped[j].Start)
+	})
+	return clipped, nil
+}
+
+// GetVehicleCalendar retrieves a vehicle's occupied intervals and free slots between from and to
+// (RFC3339, defaulting to the next 7 days). Free slots are whole periods of the requested
+// granularity (a duration such as 30m or 1h) aligned to the start of the window.
+func GetVehicleCalendar(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicle_id"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+
+	from := time.Now().Truncate(time.Hour)
+	if fromParam := query.Get("from"); fromParam != "" {
+		if from, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			http.Error(w, "Invalid from time format", http.StatusBadRequest)
+			return
+		}
+	}
+	to := from.Add(defaultWindow)
+	if toParam := query.Get("to"); toParam != "" {
+		if to, err = time.Parse(time.RFC3339, toParam); err != nil {
+			http.Error(w, "Invalid to time format", http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) || to.Sub(from) > maxWindow {
+		http.Error(w, "to must be after from and at most 31 days later", http.StatusBadRequest)
+		return
+	}
+
+	granularity := defaultGranularity
+	if granularityParam := query.Get("granularity"); granularityParam != "" {
+		if granularity, err = time.ParseDuration(granularityParam); err != nil || granularity < minGranularity {
+			http.Error(w, "Invalid granularity (use a duration of at least 15m, such as 30m or 1h)", http.StatusBadRequest)
+			return
+		}
+	}
+	if int(to.Sub(from)/granularity) > maxSlots {
+		http.Error(w, "Window is too long for this granularity", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	err = db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching vehicle for calendar:", err)
+		http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := Calendar{VehicleID: vehicleID, From: from, To: to, Granularity: granularity.String(), FreeSlots: []Slot{}}
+
+	// A vehicle out of service cannot be booked until it is repaired
+	if status == "OutOfService" {
+		calendar.Occupied = []Interval{{Type: IntervalOutOfService, Start: from, End: to}}
+	} else {
+		calendar.Occupied, err = OccupiedIntervals(vehicleID, from, to)
+		if err != nil {
+			log.Printf("Error fetching occupied intervals for vehicle %d: %v", vehicleID, err)
+			http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Occupied intervals are sorted by start, so each slot only needs to look from the first interval that may still overlap it
+	next := 0
+	for slotStart := from; !slotStart.Add(granularity).After(to); slotStart = slotStart.Add(granularity) {
+		slotEnd := slotStart.Add(granularity)
+		for next < len(calendar.Occupied) && !calendar.Occupied[next].End.After(slotStart) {
+			next++
+		}
+		free := true
+		for _, interval := range calendar.Occupied[next:] {
+			if !interval.Start.Before(slotEnd) {
+				break
+			}
+			if interval.End.After(slotStart) {
+				free = false
+				break
+			}
+		}
+		if free {
+			calendar.FreeSlots = append(calendar.FreeSlots, Slot{Start: slotStart, End: slotEnd})
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(calendar)
+}
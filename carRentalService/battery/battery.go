@@ -0,0 +1,48 @@
+package battery
+
+import (
+	"math"
+	"time"
+)
+
+// Minimum charge (percent) a vehicle should still have when an intended trip ends
+const ReserveChargePercent = 10.0
+
+// Status holds the battery details of a vehicle used to estimate its charge and range
+type Status struct {
+	ChargePercent float64 // Current state of charge, 0-100
+	CapacityKWh   float64 // Usable battery capacity
+	ChargeRateKW  float64 // Charging power available at the vehicle's home station
+	MaxRangeKm    float64 // Range on a full charge
+}
+
+// RangeKm returns the estimated driving range for a given state of charge
+func (s Status) RangeKm(chargePercent float64) float64 {
+	return roundTo(chargePercent/100*s.MaxRangeKm, 1)
+}
+
+// ExpectedChargeAt estimates the state of charge at a future time, assuming the vehicle
+// stays plugged in at its home station until then
+func (s Status) ExpectedChargeAt(now, at time.Time) float64 {
+	if !at.After(now) || s.CapacityKWh <= 0 {
+		return roundTo(s.ChargePercent, 1)
+	}
+
+	hours := at.Sub(now).Hours()
+	charge := s.ChargePercent + hours*s.ChargeRateKW/s.CapacityKWh*100
+	return roundTo(math.Min(charge, 100), 1)
+}
+
+// ChargeNeededPercent returns the state of charge needed to cover a trip distance
+// while keeping the reserve charge
+func (s Status) ChargeNeededPercent(tripDistanceKm float64) float64 {
+	if s.MaxRangeKm <= 0 {
+		return math.Inf(1)
+	}
+	return roundTo(tripDistanceKm/s.MaxRangeKm*100+ReserveChargePercent, 1)
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
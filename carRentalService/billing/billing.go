@@ -0,0 +1,110 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTP client for calls to the Payment Service
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// baseURL returns the Payment Service address, configurable with PAYMENT_SERVICE_URL
+func baseURL() string {
+	if url := os.Getenv("PAYMENT_SERVICE_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8082"
+}
+
+// RejectedError is returned when the Payment Service rejects a request, so sending it again will not help
+type RejectedError struct {
+	Status  string
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("payment service returned %s: %s", e.Status, e.Message)
+}
+
+// addLineItem charges an additional amount to a reservation's invoice in the Payment Service. A
+// charge sent again with the same non-empty request key is only added once.
+func addLineItem(reservationID int, itemType string, description string, amount float64, requestKey string) error {
+	return post("/v1/invoices/line-items", map[string]interface{}{
+		"reservation_id": reservationID,
+		"item_type":      itemType,
+		"description":    description,
+		"amount":         amount,
+		"request_key":    requestKey,
+	}, nil)
+}
+
+// Charge is a line item billed on a supplementary invoice
+type Charge struct {
+	ItemType    string  `json:"item_type"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// CreateSupplementaryInvoice bills charges raised after a rental has ended on a new invoice for
+// the reservation, returning the invoice's ID. A request sent again with the same non-empty request
+// key returns the invoice created the first time.
+func CreateSupplementaryInvoice(reservationID int, charges []Charge, requestKey string) (int, error) {
+	var response struct {
+		InvoiceID int `json:"invoice_id"`
+	}
+	err := post("/v1/invoices/supplementary", map[string]interface{}{
+		"reservation_id": reservationID,
+		"line_items":     charges,
+		"request_key":    requestKey,
+	}, &response)
+	return response.InvoiceID, err
+}
+
+// issueRefund refunds part of what was paid for a reservation, returning the amount actually
+// refunded, which the Payment Service caps at the amount paid less earlier refunds. A refund sent
+// again with the same non-empty request key is only paid once.
+func issueRefund(reservationID int, amount float64, reason string, requestKey string) (float64, error) {
+	var response struct {
+		Amount float64 `json:"amount"`
+	}
+	err := post("/v1/payments/refunds", map[string]interface{}{
+		"reservation_id": reservationID,
+		"amount":         amount,
+		"reason":         reason,
+		"request_key":    requestKey,
+	}, &response)
+	return response.Amount, err
+}
+
+// post sends a JSON request to the Payment Service and decodes the response into out, if given
+func post(path string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(baseURL()+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("payment service unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return &RejectedError{Status: resp.Status, Message: strings.TrimSpace(string(message))}
+		}
+		return fmt.Errorf("payment service returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
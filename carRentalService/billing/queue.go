@@ -0,0 +1,156 @@
+package billing
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DB variable for global database connection for the billing queue
+var db *sql.DB
+
+// Initialize the database connection for the billing queue
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for BillingRequests table connected successfully.")
+}
+
+// Kinds of billing request
+const (
+	KindLineItem = "LineItem"
+	KindRefund   = "Refund"
+)
+
+// Billing request statuses. Requests stay Pending until the Payment Service accepts them, and
+// are Failed if it rejects them outright.
+const (
+	RequestPending   = "Pending"
+	RequestCompleted = "Completed"
+	RequestFailed    = "Failed"
+)
+
+// Pending requests are left to the caller's own attempt for this long before the retrier sends them
+const retryDelay = time.Minute
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// QueueLineItem records a charge to a reservation's invoice inside the caller's transaction. Once
+// the transaction commits the charge is sent with Send, and retried until the Payment Service
+// accepts it. Payment Service calls must never be made while holding locks on the reservation,
+// as the Payment Service's inserts wait for them.
+func QueueLineItem(tx execer, reservationID int, itemType string, description string, amount float64) (int, error) {
+	return queue(tx, reservationID, KindLineItem, itemType, description, amount)
+}
+
+// QueueRefund records a refund of part of what was paid for a reservation, like QueueLineItem
+func QueueRefund(tx execer, reservationID int, amount float64, reason string) (int, error) {
+	return queue(tx, reservationID, KindRefund, "", reason, amount)
+}
+
+func queue(tx execer, reservationID int, kind string, itemType string, description string, amount float64) (int, error) {
+	result, err := tx.Exec("INSERT INTO BillingRequests (reservation_id, kind, item_type, description, amount) VALUES (?, ?, NULLIF(?, ''), ?, ?)",
+		reservationID, kind, itemType, description, amount)
+	if err != nil {
+		return 0, err
+	}
+	requestID, err := result.LastInsertId()
+	return int(requestID), err
+}
+
+// Send sends a queued request to the Payment Service, returning the amount charged or actually
+// refunded. The request's key makes sending it again harmless, so a request that fails stays
+// Pending for the retrier unless the Payment Service rejected it.
+func Send(requestID int) (float64, error) {
+	var reservationID int
+	var kind, itemType, description, status string
+	var amount, resultAmount float64
+	err := db.QueryRow("SELECT reservation_id, kind, COALESCE(item_type, ''), description, amount, status, COALESCE(result_amount, 0) FROM BillingRequests WHERE request_id = ?", requestID).
+		Scan(&reservationID, &kind, &itemType, &description, &amount, &status, &resultAmount)
+	if err != nil {
+		return 0, err
+	}
+	if status == RequestCompleted {
+		return resultAmount, nil
+	}
+	if status == RequestFailed {
+		return 0, fmt.Errorf("billing request %d was rejected", requestID)
+	}
+
+	key := fmt.Sprintf("billing-request-%d", requestID)
+	resultAmount = amount
+	if kind == KindRefund {
+		resultAmount, err = issueRefund(reservationID, amount, description, key)
+	} else {
+		err = addLineItem(reservationID, itemType, description, amount, key)
+	}
+	if err != nil {
+		status := RequestPending
+		if errors.As(err, new(*RejectedError)) {
+			status = RequestFailed
+		}
+		message := err.Error()
+		if len(message) > 255 {
+			message = message[:255]
+		}
+		if _, updateErr := db.Exec("UPDATE BillingRequests SET attempts = attempts + 1, status = ?, last_error = ? WHERE request_id = ?", status, message, requestID); updateErr != nil {
+			log.Printf("Error recording failed billing request %d: %v", requestID, updateErr)
+		}
+		return 0, err
+	}
+
+	_, err = db.Exec("UPDATE BillingRequests SET attempts = attempts + 1, status = ?, result_amount = ?, last_error = NULL, completed_at = NOW() WHERE request_id = ?",
+		RequestCompleted, resultAmount, requestID)
+	return resultAmount, err
+}
+
+// StartRetrier periodically resends Pending billing requests, for example those that could not
+// reach the Payment Service
+func StartRetrier(interval time.Duration) {
+	go func() {
+		for {
+			retryPending()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// retryPending sends each Pending request older than the retry delay
+func retryPending() {
+	rows, err := db.Query("SELECT request_id FROM BillingRequests WHERE status = ? AND created_at <= ? ORDER BY request_id", RequestPending, time.Now().Add(-retryDelay))
+	if err != nil {
+		log.Println("Error finding pending billing requests:", err)
+		return
+	}
+	var requestIDs []int
+	for rows.Next() {
+		var requestID int
+		if err := rows.Scan(&requestID); err != nil {
+			log.Println("Error scanning pending billing request:", err)
+			continue
+		}
+		requestIDs = append(requestIDs, requestID)
+	}
+	rows.Close()
+
+	for _, requestID := range requestIDs {
+		if _, err := Send(requestID); err != nil {
+			log.Printf("Error sending billing request %d: %v", requestID, err)
+		}
+	}
+}
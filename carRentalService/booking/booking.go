@@ -1,11 +1,22 @@
 package booking
 
 import (
+	"carRentalService/availability"
+	"carRentalService/battery"
+	"carRentalService/billing"
+	"carRentalService/cancellation"
+	"carRentalService/geofence"
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/pricing"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -32,16 +43,118 @@ func InitDB() {
 
 // Reservation struct represents a reservation in the system
 type Reservation struct {
-	ReservationID int       `json:"reservation_id"`
-	UserID        int       `json:"user_id"`
-	VehicleID     int       `json:"vehicle_id"`
-	VehicleName   string    `json:"vehicle_name"`
-	HourlyRate    float64   `json:"hourly_rate"`
-	StartTime     time.Time `json:"start_time"`
-	EndTime       time.Time `json:"end_time"`
-	Status        string    `json:"status"`
-	TotalCost     float64   `json:"total_cost"`
-	CreatedAt     time.Time `json:"created_at"`
+	ReservationID  int        `json:"reservation_id"`
+	UserID         int        `json:"user_id"`
+	VehicleID      int        `json:"vehicle_id"`
+	VehicleName    string     `json:"vehicle_name"`
+	HourlyRate     float64    `json:"hourly_rate"`
+	StationID      int        `json:"pickup_station_id"`
+	StationName    string     `json:"pickup_station_name"`
+	StartTime      time.Time  `json:"start_time"`
+	EndTime        time.Time  `json:"end_time"`
+	Status         string     `json:"status"`
+	TotalCost      float64    `json:"total_cost"`
+	CreatedAt      time.Time  `json:"created_at"`
+	TripDistance   float64    `json:"trip_distance_km,omitempty"`
+	SeriesID       int        `json:"series_id,omitempty"`       // Set on occurrences of a recurring series
+	GroupID        int        `json:"group_id,omitempty"`        // Set on reservations made as part of a group booking
+	HoldExpiresAt  *time.Time `json:"hold_expires_at,omitempty"` // A Pending reservation expires at this time unless paid for
+	PaymentStatus  string     `json:"payment_status,omitempty"`  // Set when listing a user's reservations
+	InvoiceID      *int       `json:"invoice_id,omitempty"`      // Rental invoice the reservation was paid on
+	AmountPaid     float64    `json:"amount_paid,omitempty"`     // Amount paid for the reservation, its share of a group invoice
+	AmountRefunded float64    `json:"amount_refunded,omitempty"`
+	QuoteID        string     `json:"quote_id,omitempty"`   // Quote whose rental cost is honoured when booking
+	PromoCode      string     `json:"promo_code,omitempty"` // Promo code of the quote booked with; payment cannot use another
+}
+
+// Errors returned when a reservation cannot be created
+var (
+	ErrVehicleNotFound    = errors.New("vehicle not found")
+	ErrVehicleUnavailable = errors.New("vehicle is not available")
+	ErrOverlap            = errors.New("vehicle is already reserved during the requested period")
+)
+
+// Reservations can be picked up this long before their start time, and last at most maxRentalDuration
+const (
+	earlyPickupGrace  = 15 * time.Minute
+	maxRentalDuration = 30 * 24 * time.Hour
+)
+
+// hasOverlap reports whether an active reservation of the vehicle, other than excludeID, or a
+// waitlist offer still being held for someone overlaps the period once the turnaround buffer
+// after each is taken into account
+func hasOverlap(tx *sql.Tx, vehicleID int, start time.Time, end time.Time, excludeID int) (bool, error) {
+	buffer := availability.Buffer()
+	now := time.Now()
+	var exists bool
+	err := tx.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM Reservations
+            WHERE vehicle_id = ? AND status IN (`+lifecycle.HoldingStatuses+`) AND `+lifecycle.UnexpiredHold+` AND reservation_id <> ?
+              AND start_time < ? AND end_time > ?
+        ) OR EXISTS(
+            SELECT 1 FROM WaitlistEntries
+            WHERE offered_vehicle_id = ? AND status = 'Offered' AND offer_expires_at > ?
+              AND start_time < ? AND end_time > ?
+        )`, vehicleID, now, excludeID, end.Add(buffer), start.Add(-buffer),
+		vehicleID, now, end.Add(buffer), start.Add(-buffer)).Scan(&exists)
+	return exists, err
+}
+
+// createReservation inserts a reservation and marks the vehicle as Booked in one transaction.
+// The vehicle row is locked first, so concurrent bookings of the same vehicle are checked for
+// overlaps one at a time and at most one of two overlapping requests succeeds.
+func createReservation(reservation *Reservation) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertReservation(tx, reservation); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertReservation locks the vehicle, checks it is free and inserts a Pending reservation within a transaction
+func insertReservation(tx *sql.Tx, reservation *Reservation) error {
+	var availabilityStatus string
+	err := tx.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ? FOR UPDATE", reservation.VehicleID).Scan(&availabilityStatus)
+	if err == sql.ErrNoRows {
+		return ErrVehicleNotFound
+	} else if err != nil {
+		return err
+	}
+	if !lifecycle.IsBookable(availabilityStatus) {
+		return ErrVehicleUnavailable
+	}
+
+	overlap, err := hasOverlap(tx, reservation.VehicleID, reservation.StartTime, reservation.EndTime, 0)
+	if err != nil {
+		return err
+	}
+	if overlap {
+		return ErrOverlap
+	}
+
+	// Occurrences of a series are paid for one at a time, so each is held until it starts rather
+	// than for the usual checkout hold
+	holdExpiresAt := time.Now().Add(holdTTL())
+	if reservation.SeriesID != 0 {
+		holdExpiresAt = reservation.StartTime
+	}
+	result, err := tx.Exec("INSERT INTO Reservations (user_id, vehicle_id, pickup_station_id, start_time, end_time, status, total_cost, trip_distance_km, series_id, group_id, hold_expires_at, promo_code) VALUES (?, ?, ?, ?, ?, 'Pending', ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), ?, NULLIF(?, ''))",
+		reservation.UserID, reservation.VehicleID, reservation.StationID, reservation.StartTime, reservation.EndTime, reservation.TotalCost, reservation.TripDistance, reservation.SeriesID, reservation.GroupID, holdExpiresAt, reservation.PromoCode)
+	if err != nil {
+		return err
+	}
+	reservationID, _ := result.LastInsertId()
+	reservation.ReservationID = int(reservationID)
+	reservation.HoldExpiresAt = &holdExpiresAt
+
+	_, err = tx.Exec("UPDATE Vehicles SET availability_status = 'Booked' WHERE vehicle_id = ? AND availability_status = 'Available'", reservation.VehicleID)
+	return err
 }
 
 // Make a new reservation
@@ -83,60 +196,133 @@ func MakeReservation(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the vehicle is available
 	var availabilityStatus string
-	var hourlyRate float64
 	var vehicleName string
+	var stationID int
+	var batteryStatus battery.Status
 
-	err = db.QueryRow("SELECT availability_status, hourly_rate, vehicle_name FROM Vehicles WHERE vehicle_id = ?", reservation.VehicleID).
-		Scan(&availabilityStatus, &hourlyRate, &vehicleName)
+	err = db.QueryRow("SELECT availability_status, vehicle_name, station_id, battery_level, battery_capacity_kwh, charge_rate_kw, max_range_km FROM Vehicles WHERE vehicle_id = ?", reservation.VehicleID).
+		Scan(&availabilityStatus, &vehicleName, &stationID, &batteryStatus.ChargePercent, &batteryStatus.CapacityKWh, &batteryStatus.ChargeRateKW, &batteryStatus.MaxRangeKm)
 	if err != nil {
 		log.Println("Vehicle not found:", err)
 		http.Error(w, "Vehicle not found", http.StatusNotFound)
 		return
 	}
 
-	if availabilityStatus != "Available" {
+	if !lifecycle.IsBookable(availabilityStatus) {
 		log.Printf("Vehicle %d is not available for booking\n", reservation.VehicleID)
 		http.Error(w, "Vehicle is not available", http.StatusConflict)
 		return
 	}
 
-	// Calculate total cost of reservation
-	duration := reservation.EndTime.Sub(reservation.StartTime).Hours()
-	if duration <= 0 {
+	// Calculate total cost of reservation from the vehicle's rate plan
+	if !reservation.EndTime.After(reservation.StartTime) {
 		log.Println("Invalid reservation time range: end time must be after start time")
 		http.Error(w, "Invalid reservation time range: end time must be after start time", http.StatusBadRequest)
 		return
 	}
-	reservation.TotalCost = duration * hourlyRate
-
-	// Insert reservation into Reservations table, including total_cost
-	result, err := db.Exec("INSERT INTO Reservations (user_id, vehicle_id, start_time, end_time, status, total_cost) VALUES (?, ?, ?, ?, 'Active', ?)",
-		reservation.UserID, reservation.VehicleID, reservation.StartTime, reservation.EndTime, reservation.TotalCost)
+	if reservation.EndTime.Sub(reservation.StartTime) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusBadRequest)
+		return
+	}
+	quote, err := pricing.QuoteVehicle(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
 	if err != nil {
-		log.Printf("Error inserting reservation into database: %v", err)
-		http.Error(w, "Error making reservation", http.StatusInternalServerError)
+		log.Println("Error pricing reservation:", err)
+		http.Error(w, "Error calculating reservation cost", http.StatusInternalServerError)
 		return
 	}
 
-	// Get the newly inserted reservation ID
-	reservationID, _ := result.LastInsertId()
-	reservation.ReservationID = int(reservationID)
-	reservation.VehicleName = vehicleName
+	// A quote obtained beforehand fixes the rental cost and its breakdown, even if rates have
+	// changed since, and the promo code the reservation is paid with
+	if reservation.QuoteID != "" {
+		quote, err = honourQuote(reservation.QuoteID, &reservation)
+		switch {
+		case errors.Is(err, ErrQuoteExpired):
+			http.Error(w, "Quote has expired; please request a new quote", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Quote is invalid or was issued for a different vehicle, user, period or promo code", http.StatusBadRequest)
+			return
+		}
+	} else if reservation.PromoCode != "" {
+		http.Error(w, "A promo code can only be booked with a quote that includes it; give it at payment instead", http.StatusBadRequest)
+		return
+	}
+	reservation.TotalCost = quote.Total
 
-	// Update vehicle availability status to Booked
-	_, err = db.Exec("UPDATE Vehicles SET availability_status = 'Booked' WHERE vehicle_id = ?", reservation.VehicleID)
+	// Scheduled maintenance windows block the vehicle
+	maintenanceConflict, err := maintenance.HasConflict(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
 	if err != nil {
-		log.Println("Error updating vehicle status to Booked:", err)
-		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		log.Println("Error checking maintenance schedule:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	if maintenanceConflict {
+		log.Printf("Vehicle %d has maintenance scheduled during the requested period\n", reservation.VehicleID)
+		http.Error(w, "Vehicle is scheduled for maintenance during the requested period", http.StatusConflict)
 		return
 	}
 
+	// Check that the vehicle can be charged enough for the intended trip before pick-up
+	expectedCharge := batteryStatus.ExpectedChargeAt(time.Now(), reservation.StartTime)
+	var chargeWarning string
+	if reservation.TripDistance < 0 {
+		http.Error(w, "Trip distance cannot be negative", http.StatusBadRequest)
+		return
+	} else if reservation.TripDistance > 0 {
+		if batteryStatus.RangeKm(expectedCharge) < reservation.TripDistance {
+			log.Printf("Vehicle %d expected range %.1f km is below trip distance %.1f km\n", reservation.VehicleID, batteryStatus.RangeKm(expectedCharge), reservation.TripDistance)
+			http.Error(w, "Vehicle cannot be charged enough for the intended trip distance before the start time", http.StatusConflict)
+			return
+		}
+		if expectedCharge < batteryStatus.ChargeNeededPercent(reservation.TripDistance) {
+			chargeWarning = fmt.Sprintf("Expected charge at pick-up is %.1f%%, which leaves less than %.0f%% reserve for a %.1f km trip", expectedCharge, battery.ReserveChargePercent, reservation.TripDistance)
+		}
+	}
+
+	// The vehicle is picked up from its home station
+	reservation.StationID = stationID
+
+	// Insert the reservation and mark the vehicle as Booked, rechecking availability under a row lock
+	err = createReservation(&reservation)
+	switch {
+	case errors.Is(err, ErrVehicleNotFound):
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrVehicleUnavailable):
+		http.Error(w, "Vehicle is not available", http.StatusConflict)
+		return
+	case errors.Is(err, ErrOverlap):
+		log.Printf("Vehicle %d is already reserved during the requested period\n", reservation.VehicleID)
+		http.Error(w, "Vehicle is already reserved during the requested period", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error inserting reservation into database: %v", err)
+		http.Error(w, "Error making reservation", http.StatusInternalServerError)
+		return
+	}
+	reservation.VehicleName = vehicleName
+
 	// Respond with reservation details (including reservation_id)
+	response := map[string]interface{}{
+		"message":                   "Reservation created successfully",
+		"reservation_id":            reservation.ReservationID,
+		"pickup_station_id":         reservation.StationID,
+		"expected_charge_at_pickup": expectedCharge,
+		"total_cost":                reservation.TotalCost,
+		"price_breakdown":           quote,
+		"hold_expires_at":           reservation.HoldExpiresAt,
+	}
+	if reservation.QuoteID != "" {
+		response["quote_id"] = reservation.QuoteID
+	}
+	if reservation.PromoCode != "" {
+		response["promo_code"] = reservation.PromoCode
+	}
+	if chargeWarning != "" {
+		response["warning"] = chargeWarning
+	}
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":        "Reservation created successfully",
-		"reservation_id": reservation.ReservationID,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // GetReservation handles fetching a reservation by ID
@@ -144,25 +330,41 @@ func GetReservation(w http.ResponseWriter, r *http.Request) {
 	reservationID := mux.Vars(r)["reservation_id"]
 
 	var reservation struct {
-		ReservationID int     `json:"reservation_id"`
-		VehicleName   string  `json:"vehicle_name"`
-		HourlyRate    float64 `json:"hourly_rate"`
-		StartTime     string  `json:"start_time"`
-		EndTime       string  `json:"end_time"`
-		TotalCost     float64 `json:"total_cost"`
+		ReservationID  int        `json:"reservation_id"`
+		VehicleName    string     `json:"vehicle_name"`
+		HourlyRate     float64    `json:"hourly_rate"`
+		StationID      int        `json:"pickup_station_id"`
+		StationName    string     `json:"pickup_station_name"`
+		StationAddress string     `json:"pickup_station_address"`
+		StartTime      string     `json:"start_time"`
+		EndTime        string     `json:"end_time"`
+		Status         string     `json:"status"`
+		TotalCost      float64    `json:"total_cost"`
+		ActualPickupAt *time.Time `json:"actual_pickup_at"`
+		ActualReturnAt *time.Time `json:"actual_return_at"`
+		HoldExpiresAt  *time.Time `json:"hold_expires_at"`
 	}
 
 	err := db.QueryRow(`
-        SELECT r.reservation_id, v.vehicle_name, v.hourly_rate, r.start_time, r.end_time, r.total_cost
+        SELECT r.reservation_id, v.vehicle_name, v.hourly_rate, s.station_id, s.station_name, s.address, r.start_time, r.end_time, r.status, r.total_cost,
+               r.actual_pickup_at, r.actual_return_at, IF(r.status = 'Pending', r.hold_expires_at, NULL)
         FROM Reservations r
         JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        JOIN Stations s ON r.pickup_station_id = s.station_id
         WHERE r.reservation_id = ?`, reservationID).Scan(
 		&reservation.ReservationID,
 		&reservation.VehicleName,
 		&reservation.HourlyRate,
+		&reservation.StationID,
+		&reservation.StationName,
+		&reservation.StationAddress,
 		&reservation.StartTime,
 		&reservation.EndTime,
+		&reservation.Status,
 		&reservation.TotalCost,
+		&reservation.ActualPickupAt,
+		&reservation.ActualReturnAt,
+		&reservation.HoldExpiresAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -178,70 +380,223 @@ func GetReservation(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(reservation)
 }
 
-// GetUserReservations handles fetching reservations for a specific user
-func GetUserReservations(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["user_id"]
-
-	// Query to get reservations for the user
-	query := `
-        SELECT 
-            r.reservation_id, 
-            r.user_id, 
-            r.vehicle_id, 
-            v.vehicle_name,
-            v.hourly_rate, 
-            r.start_time, 
-            r.end_time, 
-            r.status, 
-            r.total_cost, 
-            r.created_at 
-        FROM Reservations r
-        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
-        WHERE r.user_id = ?
-    `
+// Reservations cannot be modified once their start time is this close
+const modificationCutoff = 2 * time.Hour
 
-	rows, err := db.Query(query, userID)
-	if err != nil {
-		log.Printf("Error fetching reservations for user %s from database: %v", userID, err)
-		http.Error(w, "Error fetching reservations", http.StatusInternalServerError)
+// statusError is an error with the HTTP status and message to respond with
+type statusError struct {
+	status  int
+	message string
+}
+
+func (err *statusError) Error() string {
+	return err.message
+}
+
+// newStatusError returns a statusError with a formatted message
+func newStatusError(status int, format string, args ...interface{}) error {
+	return &statusError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// writeError responds with a statusError's status and message, or logs any other error and
+// responds with a generic message
+func writeError(w http.ResponseWriter, err error, message string) {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		http.Error(w, statusErr.message, statusErr.status)
 		return
 	}
-	defer rows.Close()
+	log.Printf("%s: %v", message, err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// modification is a requested change to a reservation's times and, optionally, its vehicle
+type modification struct {
+	UserID    int
+	VehicleID int // 0 keeps the current vehicle
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// modificationResult is a reservation after a modification
+type modificationResult struct {
+	VehicleID       int           `json:"vehicle_id"`
+	StationID       int           `json:"pickup_station_id"`
+	TotalCost       float64       `json:"total_cost"`
+	PriceDifference float64       `json:"price_difference"`
+	Quote           pricing.Quote `json:"price_breakdown"`
+}
+
+// modifyReservation moves a Pending or Confirmed reservation to new times and, optionally, to
+// another vehicle. Changes close modificationCutoff before the current start time, and the new
+// period must be free on the target vehicle. Unpaid reservations are simply re-priced; for paid
+// ones the price difference is charged as a Modification line item or partly refunded.
+func modifyReservation(reservationID int, change modification) (modificationResult, error) {
+	var result modificationResult
+	startTime, endTime := change.StartTime, change.EndTime
+	if !endTime.After(startTime) {
+		return result, newStatusError(http.StatusBadRequest, "End time must be after start time")
+	}
+	if endTime.Sub(startTime) > maxRentalDuration {
+		return result, newStatusError(http.StatusBadRequest, "Reservations cannot be longer than 30 days")
+	}
+	if startTime.Before(time.Now()) {
+		return result, newStatusError(http.StatusBadRequest, "Start time cannot be in the past")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var userID, vehicleID int
+	var status string
+	var currentStart, currentEnd time.Time
+	var totalCost float64
+	err = tx.QueryRow("SELECT user_id, vehicle_id, status, start_time, end_time, total_cost FROM Reservations WHERE reservation_id = ? FOR UPDATE", reservationID).
+		Scan(&userID, &vehicleID, &status, &currentStart, &currentEnd, &totalCost)
+	if err == sql.ErrNoRows {
+		return result, newStatusError(http.StatusNotFound, "Reservation not found")
+	} else if err != nil {
+		return result, fmt.Errorf("fetching reservation: %w", err)
+	}
+
+	if userID != change.UserID {
+		return result, newStatusError(http.StatusForbidden, "Only the renter can modify this reservation")
+	}
+	if status != lifecycle.Pending && status != lifecycle.Confirmed {
+		return result, newStatusError(http.StatusConflict, "A %s reservation cannot be modified", status)
+	}
+	if time.Until(currentStart) < modificationCutoff {
+		return result, newStatusError(http.StatusConflict, "Reservations cannot be modified less than %.0f hours before the start time", modificationCutoff.Hours())
+	}
+
+	result.VehicleID = vehicleID
+	if change.VehicleID != 0 {
+		result.VehicleID = change.VehicleID
+	}
+
+	// Lock the current and new vehicle so the new times are checked against other reservations one
+	// request at a time. The lower ID is locked first so concurrent switches cannot deadlock.
+	lockIDs := []int{vehicleID}
+	if result.VehicleID < vehicleID {
+		lockIDs = []int{result.VehicleID, vehicleID}
+	} else if result.VehicleID > vehicleID {
+		lockIDs = []int{vehicleID, result.VehicleID}
+	}
+	var availabilityStatus string
+	for _, id := range lockIDs {
+		var lockedStatus string
+		var lockedStation int
+		err := tx.QueryRow("SELECT availability_status, station_id FROM Vehicles WHERE vehicle_id = ? FOR UPDATE", id).Scan(&lockedStatus, &lockedStation)
+		if err == sql.ErrNoRows {
+			return result, newStatusError(http.StatusNotFound, "Vehicle not found")
+		} else if err != nil {
+			return result, fmt.Errorf("locking vehicle: %w", err)
+		}
+		if id == result.VehicleID {
+			availabilityStatus, result.StationID = lockedStatus, lockedStation
+		}
+	}
+	if result.VehicleID != vehicleID && !lifecycle.IsBookable(availabilityStatus) {
+		return result, newStatusError(http.StatusConflict, "Vehicle is not available")
+	}
+
+	overlap, err := hasOverlap(tx, result.VehicleID, startTime, endTime, reservationID)
+	if err != nil {
+		return result, fmt.Errorf("checking reservation overlap: %w", err)
+	}
+	if overlap {
+		return result, newStatusError(http.StatusConflict, "Vehicle is already reserved during the requested period")
+	}
 
-	var reservations []Reservation
-	for rows.Next() {
-		var reservation Reservation
-		var createdAtString string
+	// Scheduled maintenance windows block the vehicle
+	maintenanceConflict, err := maintenance.HasConflict(result.VehicleID, startTime, endTime)
+	if err != nil {
+		return result, fmt.Errorf("checking maintenance schedule: %w", err)
+	}
+	if maintenanceConflict {
+		return result, newStatusError(http.StatusConflict, "Vehicle is scheduled for maintenance during the requested period")
+	}
 
-		// Scan each row into a Reservation object
-		err := rows.Scan(&reservation.ReservationID, &reservation.UserID, &reservation.VehicleID, &reservation.VehicleName, &reservation.HourlyRate, &reservation.StartTime, &reservation.EndTime, &reservation.Status, &reservation.TotalCost, &createdAtString)
+	// Calculate new cost from the vehicle's rate plan
+	result.Quote, err = pricing.QuoteVehicle(result.VehicleID, startTime, endTime)
+	if err != nil {
+		return result, fmt.Errorf("pricing reservation: %w", err)
+	}
+
+	// An unpaid reservation is simply re-priced. A paid one is charged or refunded the difference
+	// between the new and original booking at current rates, so earlier extensions and other
+	// line items on the invoice are left as they are.
+	result.TotalCost = result.Quote.Total
+	if status == lifecycle.Confirmed {
+		originalQuote, err := pricing.QuoteVehicle(vehicleID, currentStart, currentEnd)
 		if err != nil {
-			log.Printf("Error scanning reservation row: %v", err)
-			http.Error(w, "Error fetching reservations", http.StatusInternalServerError)
-			return
+			return result, fmt.Errorf("pricing original reservation: %w", err)
 		}
+		result.PriceDifference = math.Round((result.Quote.Total-originalQuote.Total)*100) / 100
+		result.TotalCost = math.Max(0, math.Round((totalCost+result.PriceDifference)*100)/100)
+	}
 
-		reservations = append(reservations, reservation)
+	_, err = tx.Exec("UPDATE Reservations SET vehicle_id = ?, pickup_station_id = ?, start_time = ?, end_time = ?, total_cost = ? WHERE reservation_id = ?",
+		result.VehicleID, result.StationID, startTime, endTime, result.TotalCost, reservationID)
+	if err != nil {
+		return result, fmt.Errorf("updating reservation: %w", err)
 	}
 
-	// Respond with the list of reservations
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(reservations)
+	// Move the booking to the new vehicle and release the old one if nothing else holds it
+	if result.VehicleID != vehicleID {
+		if _, err := tx.Exec("UPDATE Vehicles SET availability_status = 'Booked' WHERE vehicle_id = ? AND availability_status = 'Available'", result.VehicleID); err != nil {
+			return result, fmt.Errorf("updating vehicle status: %w", err)
+		}
+		if err := releaseVehicle(tx, vehicleID); err != nil {
+			return result, fmt.Errorf("releasing previous vehicle: %w", err)
+		}
+	}
+
+	// The difference is queued with the change and settled with the Payment Service once the
+	// reservation is no longer locked
+	billingRequestID := 0
+	description := fmt.Sprintf("Modification to %s - %s", startTime.Format("2006-01-02 15:04"), endTime.Format("2006-01-02 15:04"))
+	if result.PriceDifference > 0 {
+		billingRequestID, err = billing.QueueLineItem(tx, reservationID, "Modification", description, result.PriceDifference)
+	} else if result.PriceDifference < 0 {
+		billingRequestID, err = billing.QueueRefund(tx, reservationID, -result.PriceDifference, description)
+	}
+	if err != nil {
+		return result, fmt.Errorf("queueing modification billing: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("committing reservation update: %w", err)
+	}
+	if billingRequestID != 0 {
+		if _, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error settling modification of reservation %d, it will be retried: %v", reservationID, err)
+		}
+	}
+	refreshWaitlist()
+	return result, nil
 }
 
-// UpdateReservation handles modifying an existing reservation
+// UpdateReservation moves a reservation to new times and, optionally, to another vehicle
 func UpdateReservation(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	reservationID := vars["reservation_id"]
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
 
 	var updatedReservation struct {
+		UserID    int    `json:"user_id"`
+		VehicleID int    `json:"vehicle_id"` // Optional; switches the reservation to another vehicle
 		StartTime string `json:"start_time"`
 		EndTime   string `json:"end_time"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&updatedReservation)
-	if err != nil {
+	err = json.NewDecoder(r.Body).Decode(&updatedReservation)
+	if err != nil || updatedReservation.UserID == 0 {
 		log.Println("Error decoding reservation input:", err)
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
@@ -263,76 +618,572 @@ func UpdateReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if endTime.Before(startTime) {
-		log.Println("End time is before start time")
-		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+	result, err := modifyReservation(reservationID, modification{
+		UserID:    updatedReservation.UserID,
+		VehicleID: updatedReservation.VehicleID,
+		StartTime: startTime,
+		EndTime:   endTime,
+	})
+	if err != nil {
+		writeError(w, err, "Failed to update reservation")
 		return
 	}
 
-	// Calculate new cost
-	var hourlyRate float64
-	err = db.QueryRow("SELECT hourly_rate FROM Vehicles v JOIN Reservations r ON v.vehicle_id = r.vehicle_id WHERE r.reservation_id = ?", reservationID).Scan(&hourlyRate)
+	// Respond with success message and the new price
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           "Reservation updated successfully",
+		"vehicle_id":        result.VehicleID,
+		"pickup_station_id": result.StationID,
+		"total_cost":        result.TotalCost,
+		"price_difference":  result.PriceDifference,
+		"price_breakdown":   result.Quote,
+	})
+}
+
+// cancellationOutcome works out the fee and refund for cancelling a reservation now under the renter's membership tier policy
+func cancellationOutcome(reservationID int, userID int, startTime time.Time) (cancellation.Outcome, error) {
+	policy, err := cancellation.PolicyFor(userID)
+	if err != nil {
+		return cancellation.Outcome{}, err
+	}
+	amountPaid, err := cancellation.AmountPaid(reservationID)
+	if err != nil {
+		return cancellation.Outcome{}, err
+	}
+	return cancellation.Evaluate(policy, startTime, time.Now(), amountPaid), nil
+}
+
+// GetCancellationQuote shows the fee and refund that cancelling a reservation now would incur
+func GetCancellationQuote(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
 	if err != nil {
-		log.Println("Error fetching hourly rate:", err)
-		http.Error(w, "Vehicle not found for reservation", http.StatusNotFound)
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
 		return
 	}
 
-	duration := endTime.Sub(startTime).Hours()
-	totalCost := duration * hourlyRate
+	var userID int
+	var status string
+	var startTime time.Time
+	err = db.QueryRow("SELECT user_id, status, start_time FROM Reservations WHERE reservation_id = ?", reservationID).Scan(&userID, &status, &startTime)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching reservation %d for cancellation quote: %v", reservationID, err)
+		http.Error(w, "Error fetching reservation", http.StatusInternalServerError)
+		return
+	}
+	if !lifecycle.CanTransition(status, lifecycle.Cancelled) {
+		http.Error(w, fmt.Sprintf("A %s reservation cannot be cancelled", status), http.StatusConflict)
+		return
+	}
 
-	// Update reservation in database
-	_, err = db.Exec("UPDATE Reservations SET start_time = ?, end_time = ?, total_cost = ? WHERE reservation_id = ?", startTime, endTime, totalCost, reservationID)
+	outcome, err := cancellationOutcome(reservationID, userID, startTime)
 	if err != nil {
-		log.Println("Error updating reservation:", err)
-		http.Error(w, "Failed to update reservation", http.StatusInternalServerError)
+		log.Printf("Error calculating cancellation fee for reservation %d: %v", reservationID, err)
+		http.Error(w, "Error calculating cancellation fee", http.StatusInternalServerError)
 		return
 	}
 
-	// Respond with success message
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Reservation updated successfully",
-	})
+	json.NewEncoder(w).Encode(outcome)
 }
 
-// Cancel an existing reservation
-func CancelReservation(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	reservationID := vars["reservation_id"]
+// cancelReservation cancels a reservation. The renter's membership tier policy decides how much
+// of what was paid is kept as a cancellation fee; the rest is refunded through the Payment Service
+// once the cancellation is committed. refundPending reports a refund that could not be sent yet
+// and is left to the billing retrier.
+func cancelReservation(reservationID int) (outcome cancellation.Outcome, refundPending bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return outcome, false, err
+	}
+	defer tx.Rollback()
+
+	// Get the renter, vehicle and status of the reservation, locking it against concurrent changes
+	var userID, vehicleID int
+	var status string
+	var startTime time.Time
+	err = tx.QueryRow("SELECT user_id, vehicle_id, status, start_time FROM Reservations WHERE reservation_id = ? FOR UPDATE", reservationID).
+		Scan(&userID, &vehicleID, &status, &startTime)
+	if err == sql.ErrNoRows {
+		return outcome, false, newStatusError(http.StatusNotFound, "Reservation not found")
+	} else if err != nil {
+		return outcome, false, fmt.Errorf("fetching reservation: %w", err)
+	}
+	if !lifecycle.CanTransition(status, lifecycle.Cancelled) {
+		return outcome, false, newStatusError(http.StatusConflict, "A %s reservation cannot be cancelled", status)
+	}
 
-	// Get vehicle ID associated with the reservation
-	var vehicleID int
-	err := db.QueryRow("SELECT vehicle_id FROM Reservations WHERE reservation_id = ? AND status = 'Active'", reservationID).Scan(&vehicleID)
+	outcome, err = cancellationOutcome(reservationID, userID, startTime)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("Reservation not found or already cancelled/completed: %s", reservationID)
-			http.Error(w, "Reservation not found or already completed/cancelled", http.StatusNotFound)
+		return outcome, false, fmt.Errorf("calculating cancellation fee: %w", err)
+	}
+
+	// Update reservation status to Cancelled
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Cancelled' WHERE reservation_id = ?", reservationID); err != nil {
+		return outcome, false, fmt.Errorf("cancelling reservation: %w", err)
+	}
+
+	// The vehicle becomes Available once it has no other reservations holding it
+	if err := releaseVehicle(tx, vehicleID); err != nil {
+		return outcome, false, fmt.Errorf("updating vehicle %d status: %w", vehicleID, err)
+	}
+
+	// The refund is queued with the cancellation and sent once the reservation is no longer locked
+	billingRequestID := 0
+	if outcome.Refund > 0 {
+		reason := fmt.Sprintf("Cancellation of reservation %d (%s policy)", reservationID, outcome.Policy.MembershipTier)
+		if billingRequestID, err = billing.QueueRefund(tx, reservationID, outcome.Refund, reason); err != nil {
+			return outcome, false, fmt.Errorf("queueing cancellation refund: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return outcome, false, fmt.Errorf("committing cancellation: %w", err)
+	}
+	if billingRequestID != 0 {
+		if refunded, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error refunding cancelled reservation %d, it will be retried: %v", reservationID, err)
+			refundPending = true
 		} else {
-			log.Printf("Error fetching reservation for cancellation: %v", err)
-			http.Error(w, "Error fetching reservation", http.StatusInternalServerError)
+			outcome.Refund = refunded
 		}
+	}
+	refreshWaitlist()
+	return outcome, refundPending, nil
+}
+
+// Cancel an existing reservation, refunding what the cancellation policy allows
+func CancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
 		return
 	}
 
-	// Update reservation status to Cancelled
-	_, err = db.Exec("UPDATE Reservations SET status = 'Cancelled' WHERE reservation_id = ?", reservationID)
+	outcome, refundPending, err := cancelReservation(reservationID)
+	if err != nil {
+		writeError(w, err, "Error cancelling reservation")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Reservation cancelled successfully",
+		"refund_amount":    outcome.Refund,
+		"refund_pending":   refundPending, // The refund could not be sent yet and will be retried
+		"cancellation_fee": outcome.Fee,
+		"rule":             outcome.Rule,
+		"policy":           outcome.Policy,
+	})
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// releaseVehicle returns a Booked or InUse vehicle to Available, or to Booked while other
+// reservations still hold it. Vehicles in maintenance or out of service keep their status.
+func releaseVehicle(conn execer, vehicleID int) error {
+	_, err := conn.Exec(`
+        UPDATE Vehicles SET availability_status = IF(
+            EXISTS (SELECT 1 FROM Reservations WHERE vehicle_id = ? AND status IN (`+lifecycle.HoldingStatuses+`)),
+            'Booked', 'Available')
+        WHERE vehicle_id = ? AND availability_status IN ('Booked', 'InUse')`, vehicleID, vehicleID)
+	return err
+}
+
+// handover is the request body for picking up and returning a vehicle. The odometer and charge
+// default to the vehicle's latest telemetry when they are not given.
+type handover struct {
+	UserID        int      `json:"user_id"`
+	OdometerKm    *float64 `json:"odometer_km"`
+	ChargePercent *float64 `json:"charge_percent"`
+}
+
+// decodeHandover reads and validates a pick-up or return request
+func decodeHandover(r *http.Request) (handover, error) {
+	var request handover
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		return request, fmt.Errorf("invalid input")
+	}
+	if request.OdometerKm != nil && *request.OdometerKm < 0 {
+		return request, fmt.Errorf("odometer_km cannot be negative")
+	}
+	if request.ChargePercent != nil && (*request.ChargePercent < 0 || *request.ChargePercent > 100) {
+		return request, fmt.Errorf("charge_percent must be between 0 and 100")
+	}
+	return request, nil
+}
+
+// PickUpReservation starts a confirmed reservation when the renter collects the vehicle,
+// recording the actual pick-up time, odometer and charge
+func PickUpReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	request, err := decodeHandover(r)
 	if err != nil {
-		log.Printf("Error cancelling reservation %s: %v", reservationID, err)
-		http.Error(w, "Error cancelling reservation", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting pick-up transaction:", err)
+		http.Error(w, "Error picking up vehicle", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, vehicleID int
+	var status, vehicleStatus string
+	var startTime, endTime time.Time
+	var odometer, charge float64
+	err = tx.QueryRow(`
+        SELECT r.user_id, r.vehicle_id, r.status, r.start_time, r.end_time, v.availability_status, v.odometer_km, v.battery_level
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.reservation_id = ?
+        FOR UPDATE`, reservationID).Scan(&userID, &vehicleID, &status, &startTime, &endTime, &vehicleStatus, &odometer, &charge)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation for pick-up:", err)
+		http.Error(w, "Error picking up vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	if userID != request.UserID {
+		http.Error(w, "Only the renter can pick up this reservation", http.StatusForbidden)
+		return
+	}
+	if !lifecycle.CanTransition(status, lifecycle.InProgress) {
+		http.Error(w, fmt.Sprintf("A %s reservation cannot be picked up", status), http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	if now.Before(startTime.Add(-earlyPickupGrace)) || !now.Before(endTime) {
+		http.Error(w, "The vehicle can only be picked up during the reservation period", http.StatusConflict)
+		return
+	}
+	if vehicleStatus != "Booked" && vehicleStatus != "Available" {
+		http.Error(w, fmt.Sprintf("Vehicle is currently %s and cannot be picked up", vehicleStatus), http.StatusConflict)
+		return
+	}
+
+	if request.OdometerKm != nil {
+		odometer = *request.OdometerKm
+	}
+	if request.ChargePercent != nil {
+		charge = *request.ChargePercent
+	}
+
+	_, err = tx.Exec("UPDATE Reservations SET status = 'InProgress', actual_pickup_at = ?, pickup_odometer_km = ?, pickup_charge = ? WHERE reservation_id = ?",
+		now, odometer, charge, reservationID)
+	if err != nil {
+		log.Println("Error starting reservation:", err)
+		http.Error(w, "Error picking up vehicle", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec("UPDATE Vehicles SET availability_status = 'InUse', odometer_km = GREATEST(odometer_km, ?), battery_level = ? WHERE vehicle_id = ?",
+		odometer, charge, vehicleID)
+	if err != nil {
+		log.Printf("Error updating vehicle %d status to InUse: %v", vehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing pick-up:", err)
+		http.Error(w, "Error picking up vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Vehicle picked up successfully",
+		"actual_pickup_at":   now,
+		"pickup_odometer_km": odometer,
+		"pickup_charge":      charge,
+	})
+}
+
+// ReturnReservation completes a reservation when the renter returns the vehicle, recording the
+// actual return time, odometer and charge, freeing the vehicle and billing any geofence fees
+func ReturnReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	request, err := decodeHandover(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting return transaction:", err)
+		http.Error(w, "Error returning vehicle", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, vehicleID int
+	var status string
+	var endTime time.Time
+	var pickupOdometer, odometer, charge float64
+	err = tx.QueryRow(`
+        SELECT r.user_id, r.vehicle_id, r.status, r.end_time, COALESCE(r.pickup_odometer_km, 0), v.odometer_km, v.battery_level
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.reservation_id = ?
+        FOR UPDATE`, reservationID).Scan(&userID, &vehicleID, &status, &endTime, &pickupOdometer, &odometer, &charge)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation for return:", err)
+		http.Error(w, "Error returning vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	if userID != request.UserID {
+		http.Error(w, "Only the renter can return this reservation", http.StatusForbidden)
+		return
+	}
+	if !lifecycle.CanTransition(status, lifecycle.Completed) {
+		http.Error(w, fmt.Sprintf("A %s reservation cannot be returned", status), http.StatusConflict)
+		return
+	}
+
+	if request.OdometerKm != nil {
+		odometer = *request.OdometerKm
+	}
+	if request.ChargePercent != nil {
+		charge = *request.ChargePercent
+	}
+	if odometer < pickupOdometer {
+		http.Error(w, "odometer_km cannot be lower than at pick-up", http.StatusBadRequest)
 		return
 	}
 
-	// Update vehicle availability status to Available
-	_, err = db.Exec("UPDATE Vehicles SET availability_status = 'Available' WHERE vehicle_id = ?", vehicleID)
+	now := time.Now()
+	_, err = tx.Exec("UPDATE Reservations SET status = 'Completed', actual_return_at = ?, return_odometer_km = ?, return_charge = ? WHERE reservation_id = ?",
+		now, odometer, charge, reservationID)
+	if err != nil {
+		log.Println("Error completing reservation:", err)
+		http.Error(w, "Error returning vehicle", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec("UPDATE Vehicles SET odometer_km = GREATEST(odometer_km, ?), battery_level = ? WHERE vehicle_id = ?", odometer, charge, vehicleID)
 	if err != nil {
-		log.Printf("Error updating vehicle %d status to Available: %v", vehicleID, err)
+		log.Printf("Error updating vehicle %d after return: %v", vehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+	if err := releaseVehicle(tx, vehicleID); err != nil {
+		log.Printf("Error releasing vehicle %d after return: %v", vehicleID, err)
 		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
 		return
 	}
+	lateReturn, err := recordLateReturn(tx, reservationID, vehicleID, endTime, now)
+	if err != nil {
+		log.Printf("Error recording late return of reservation %d: %v", reservationID, err)
+		http.Error(w, "Error returning vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing return:", err)
+		http.Error(w, "Error returning vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	// Geofence and late-return fees are billed at return; fees left Pending are billed by the return fee sweeper
+	if err := geofence.SettleViolationFees(reservationID); err != nil {
+		log.Printf("Error settling geofence fees for reservation %d: %v", reservationID, err)
+	}
+	if lateReturn != nil {
+		if err := billLateReturn(lateReturn); err != nil {
+			log.Printf("Error billing late return of reservation %d: %v", reservationID, err)
+		}
+		if err := offerSubstitute(lateReturn); err != nil {
+			log.Printf("Error offering a substitute vehicle for reservation %d: %v", *lateReturn.BlockedReservationID, err)
+		}
+	}
+
+	// An early return frees the rest of the reserved period for the waitlist
+	refreshWaitlist()
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Reservation cancelled successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Vehicle returned successfully",
+		"actual_return_at":   now,
+		"return_odometer_km": odometer,
+		"return_charge":      charge,
+		"distance_km":        odometer - pickupOdometer,
+		"late_return":        lateReturn,
+	})
+}
+
+// ExtendReservation moves the end of a reservation later. The extra time must be free, the
+// rental must stay within the maximum length, and the additional cost is priced with the
+// current rate plan. Unpaid reservations have their total updated; paid ones are charged the
+// difference as an Extension line item on their invoice.
+func ExtendReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		UserID     int       `json:"user_id"`
+		NewEndTime time.Time `json:"new_end_time"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 || request.NewEndTime.IsZero() {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting extension transaction:", err)
+		http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, vehicleID int
+	var status string
+	var startTime, endTime time.Time
+	var totalCost float64
+	err = tx.QueryRow("SELECT user_id, vehicle_id, status, start_time, end_time, total_cost FROM Reservations WHERE reservation_id = ? FOR UPDATE", reservationID).
+		Scan(&userID, &vehicleID, &status, &startTime, &endTime, &totalCost)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation for extension:", err)
+		http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+		return
+	}
+
+	if userID != request.UserID {
+		http.Error(w, "Only the renter can extend this reservation", http.StatusForbidden)
+		return
+	}
+	if status != lifecycle.Pending && status != lifecycle.Confirmed && status != lifecycle.InProgress {
+		http.Error(w, fmt.Sprintf("A %s reservation cannot be extended", status), http.StatusConflict)
+		return
+	}
+	if !request.NewEndTime.After(endTime) {
+		http.Error(w, "new_end_time must be after the current end time", http.StatusBadRequest)
+		return
+	}
+	if !request.NewEndTime.After(time.Now()) {
+		http.Error(w, "new_end_time must be in the future", http.StatusBadRequest)
+		return
+	}
+	if request.NewEndTime.Sub(startTime) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusConflict)
+		return
+	}
+
+	// Lock the vehicle and check that the extra time is free
+	if _, err := tx.Exec("SELECT vehicle_id FROM Vehicles WHERE vehicle_id = ? FOR UPDATE", vehicleID); err != nil {
+		log.Println("Error locking vehicle for extension:", err)
+		http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+		return
+	}
+	overlap, err := hasOverlap(tx, vehicleID, endTime, request.NewEndTime, reservationID)
+	if err != nil {
+		log.Println("Error checking reservation overlap:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	if overlap {
+		http.Error(w, "Vehicle is reserved by someone else during the extra time", http.StatusConflict)
+		return
+	}
+	maintenanceConflict, err := maintenance.HasConflict(vehicleID, endTime, request.NewEndTime)
+	if err != nil {
+		log.Println("Error checking maintenance schedule:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	if maintenanceConflict {
+		http.Error(w, "Vehicle is scheduled for maintenance during the extra time", http.StatusConflict)
+		return
+	}
+
+	// Price the extension as the difference between the extended and original rental, so daily
+	// caps and weekly rates carry across the original end time
+	originalQuote, err := pricing.QuoteVehicle(vehicleID, startTime, endTime)
+	if err != nil {
+		log.Println("Error pricing original reservation:", err)
+		http.Error(w, "Error calculating extension cost", http.StatusInternalServerError)
+		return
+	}
+	extendedQuote, err := pricing.QuoteVehicle(vehicleID, startTime, request.NewEndTime)
+	if err != nil {
+		log.Println("Error pricing extended reservation:", err)
+		http.Error(w, "Error calculating extension cost", http.StatusInternalServerError)
+		return
+	}
+	additionalCost := math.Max(0, math.Round((extendedQuote.Total-originalQuote.Total)*100)/100)
+
+	// An unpaid reservation is simply re-priced; a paid one keeps its price and is charged the extra
+	newTotal := totalCost + additionalCost
+	if status == lifecycle.Pending {
+		newTotal = extendedQuote.Total
+	}
+	_, err = tx.Exec("UPDATE Reservations SET end_time = ?, total_cost = ? WHERE reservation_id = ?", request.NewEndTime, newTotal, reservationID)
+	if err != nil {
+		log.Println("Error extending reservation:", err)
+		http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+		return
+	}
+
+	// The charge is queued with the extension and sent once the reservation is no longer locked
+	billingRequestID := 0
+	if status != lifecycle.Pending && additionalCost > 0 {
+		description := fmt.Sprintf("Extension from %s to %s", endTime.Format("2006-01-02 15:04"), request.NewEndTime.Format("2006-01-02 15:04"))
+		billingRequestID, err = billing.QueueLineItem(tx, reservationID, "Extension", description, additionalCost)
+		if err != nil {
+			log.Println("Error queueing extension charge:", err)
+			http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing extension:", err)
+		http.Error(w, "Error extending reservation", http.StatusInternalServerError)
+		return
+	}
+
+	if billingRequestID != 0 {
+		if _, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error billing extension of reservation %d, it will be retried: %v", reservationID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         "Reservation extended successfully",
+		"end_time":        request.NewEndTime,
+		"additional_cost": additionalCost,
+		"total_cost":      newTotal,
+		"price_breakdown": extendedQuote,
 	})
 }
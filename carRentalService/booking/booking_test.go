@@ -0,0 +1,130 @@
+package booking
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the database named by ELECTRIGO_TEST_DSN, skipping the test when it is not set.
+// The database must be loaded from seed.sql, e.g.
+// ELECTRIGO_TEST_DSN="user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+func openTestDB(t *testing.T) {
+	dsn := os.Getenv("ELECTRIGO_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ELECTRIGO_TEST_DSN not set; skipping database test")
+	}
+	var err error
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+}
+
+func TestConcurrentReservationsDoNotOverlap(t *testing.T) {
+	openTestDB(t)
+
+	const vehicleID = 5
+	const attempts = 20
+
+	var originalStatus string
+	if err := db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&originalStatus); err != nil {
+		t.Fatalf("fetching test vehicle: %v", err)
+	}
+
+	// Book a window far in the future so seeded reservations cannot interfere
+	start := time.Now().AddDate(5, 0, 0).Truncate(time.Hour)
+	end := start.Add(4 * time.Hour)
+
+	var created []int
+	var mutex sync.Mutex
+	t.Cleanup(func() {
+		for _, id := range created {
+			db.Exec("DELETE FROM Reservations WHERE reservation_id = ?", id)
+		}
+		db.Exec("UPDATE Vehicles SET availability_status = ? WHERE vehicle_id = ?", originalStatus, vehicleID)
+	})
+
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			// Every request overlaps the others by at least three hours
+			shift := time.Duration(offset%2) * time.Hour
+			reservation := Reservation{UserID: 1, VehicleID: vehicleID, StationID: 4, StartTime: start.Add(shift), EndTime: end.Add(shift), TotalCost: 88}
+			err := createReservation(&reservation)
+			if err == nil {
+				mutex.Lock()
+				created = append(created, reservation.ReservationID)
+				mutex.Unlock()
+			}
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrOverlap):
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly 1 of %d overlapping bookings to succeed, got %d", attempts, succeeded)
+	}
+
+	var overlapping int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM Reservations
+        WHERE vehicle_id = ? AND status = 'Pending' AND start_time < ? AND end_time > ?`,
+		vehicleID, end.Add(time.Hour), start).Scan(&overlapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlapping != 1 {
+		t.Fatalf("expected 1 pending reservation in the window, found %d", overlapping)
+	}
+}
+
+func TestReservationsAfterBufferDoNotConflict(t *testing.T) {
+	openTestDB(t)
+
+	const vehicleID = 5
+
+	var originalStatus string
+	if err := db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&originalStatus); err != nil {
+		t.Fatalf("fetching test vehicle: %v", err)
+	}
+
+	start := time.Now().AddDate(5, 1, 0).Truncate(time.Hour)
+	first := Reservation{UserID: 1, VehicleID: vehicleID, StationID: 4, StartTime: start, EndTime: start.Add(2 * time.Hour), TotalCost: 44}
+	second := Reservation{UserID: 2, VehicleID: vehicleID, StationID: 4, StartTime: start.Add(3 * time.Hour), EndTime: start.Add(5 * time.Hour), TotalCost: 44}
+	t.Cleanup(func() {
+		for _, reservation := range []Reservation{first, second} {
+			db.Exec("DELETE FROM Reservations WHERE reservation_id = ?", reservation.ReservationID)
+		}
+		db.Exec("UPDATE Vehicles SET availability_status = ? WHERE vehicle_id = ?", originalStatus, vehicleID)
+	})
+
+	if err := createReservation(&first); err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+	// The vehicle is now Booked but remains bookable for a period after the turnaround buffer
+	if err := createReservation(&second); err != nil {
+		t.Fatalf("second reservation after the buffer: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/pricing"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// A group booking reserves at most this many vehicles
+const maxGroupSize = 20
+
+// Group is several vehicles booked together for the same period. Each vehicle is an ordinary
+// reservation, so members can be cancelled one at a time, but the group is paid for with one
+// checkout on one combined invoice.
+type Group struct {
+	GroupID       int           `json:"group_id"`
+	UserID        int           `json:"user_id"`
+	StartTime     time.Time     `json:"start_time"`
+	EndTime       time.Time     `json:"end_time"`
+	CreatedAt     time.Time     `json:"created_at"`
+	TotalCost     float64       `json:"total_cost"`                // Total of the members still holding their vehicle
+	HoldExpiresAt *time.Time    `json:"hold_expires_at,omitempty"` // Earliest hold expiry of the unpaid members
+	Members       []GroupMember `json:"members"`
+}
+
+// GroupMember is a reservation belonging to a group
+type GroupMember struct {
+	ReservationID int     `json:"reservation_id"`
+	VehicleID     int     `json:"vehicle_id"`
+	VehicleName   string  `json:"vehicle_name"`
+	HourlyRate    float64 `json:"hourly_rate"`
+	StationID     int     `json:"pickup_station_id"`
+	Status        string  `json:"status"`
+	TotalCost     float64 `json:"total_cost"`
+}
+
+// bookGroupMember checks and books one vehicle of a group inside the group's transaction,
+// returning a reason if the vehicle cannot be booked for the period
+func bookGroupMember(tx *sql.Tx, reservation *Reservation) (string, error) {
+	maintenanceConflict, err := maintenance.HasConflict(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
+	if err != nil {
+		return "", err
+	}
+	if maintenanceConflict {
+		return "scheduled for maintenance", nil
+	}
+
+	quote, err := pricing.QuoteVehicle(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
+	if err != nil {
+		return "", err
+	}
+	reservation.TotalCost = quote.Total
+
+	err = insertReservation(tx, reservation)
+	switch {
+	case errors.Is(err, ErrVehicleNotFound):
+		return "not found", nil
+	case errors.Is(err, ErrOverlap):
+		return "already reserved", nil
+	case errors.Is(err, ErrVehicleUnavailable):
+		return "not available", nil
+	}
+	return "", err
+}
+
+// CreateGroup books several vehicles for the same period, either a list of specific vehicles or
+// a number of vehicles of a class. The booking is all or nothing: if any vehicle cannot be
+// booked, none are. Vehicles are locked in ID order so concurrent group bookings cannot deadlock.
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID       int       `json:"user_id"`
+		StartTime    time.Time `json:"start_time"`
+		EndTime      time.Time `json:"end_time"`
+		VehicleIDs   []int     `json:"vehicle_ids"`   // Either specific vehicles
+		VehicleClass string    `json:"vehicle_class"` // or a number of vehicles of a class
+		Count        int       `json:"count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 ||
+		request.StartTime.IsZero() || request.EndTime.IsZero() {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	if (len(request.VehicleIDs) == 0) == (request.VehicleClass == "") {
+		http.Error(w, "Give either vehicle_ids or vehicle_class and count", http.StatusBadRequest)
+		return
+	}
+	size := len(request.VehicleIDs)
+	if request.VehicleClass != "" {
+		size = request.Count
+	}
+	if size < 1 || size > maxGroupSize {
+		http.Error(w, fmt.Sprintf("A group booking must have between 1 and %d vehicles", maxGroupSize), http.StatusBadRequest)
+		return
+	}
+	if !request.EndTime.After(request.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+	if request.EndTime.Sub(request.StartTime) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusBadRequest)
+		return
+	}
+	if request.StartTime.Before(time.Now()) {
+		http.Error(w, "Start time cannot be in the past", http.StatusBadRequest)
+		return
+	}
+
+	// Candidate vehicles with their stations, in ID order
+	var rows *sql.Rows
+	var err error
+	if request.VehicleClass != "" {
+		rows, err = db.Query(`
+            SELECT vehicle_id, station_id FROM Vehicles
+            WHERE vehicle_class = ? AND availability_status IN ('Available', 'Booked', 'InUse')
+            ORDER BY vehicle_id`, request.VehicleClass)
+	} else {
+		sort.Ints(request.VehicleIDs)
+		for i := 1; i < len(request.VehicleIDs); i++ {
+			if request.VehicleIDs[i] == request.VehicleIDs[i-1] {
+				http.Error(w, fmt.Sprintf("Vehicle %d is listed more than once", request.VehicleIDs[i]), http.StatusBadRequest)
+				return
+			}
+		}
+		args := make([]interface{}, len(request.VehicleIDs))
+		for i, vehicleID := range request.VehicleIDs {
+			args[i] = vehicleID
+		}
+		rows, err = db.Query("SELECT vehicle_id, station_id FROM Vehicles WHERE vehicle_id IN (?"+strings.Repeat(", ?", len(args)-1)+") ORDER BY vehicle_id", args...)
+	}
+	if err != nil {
+		log.Println("Error fetching vehicles for group booking:", err)
+		http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+		return
+	}
+	var candidates []Reservation
+	for rows.Next() {
+		candidate := Reservation{UserID: request.UserID, StartTime: request.StartTime, EndTime: request.EndTime}
+		if err := rows.Scan(&candidate.VehicleID, &candidate.StationID); err != nil {
+			rows.Close()
+			log.Println("Error scanning vehicle for group booking:", err)
+			http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+			return
+		}
+		candidates = append(candidates, candidate)
+	}
+	rows.Close()
+	if request.VehicleClass == "" && len(candidates) < len(request.VehicleIDs) {
+		http.Error(w, "One or more vehicles were not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting group booking transaction:", err)
+		http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO ReservationGroups (user_id, start_time, end_time) VALUES (?, ?, ?)", request.UserID, request.StartTime, request.EndTime)
+	if err != nil {
+		log.Println("Error inserting reservation group:", err)
+		http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+		return
+	}
+	groupID, _ := result.LastInsertId()
+
+	members := []Reservation{}
+	for _, candidate := range candidates {
+		if len(members) == size {
+			break
+		}
+		candidate.GroupID = int(groupID)
+		reason, err := bookGroupMember(tx, &candidate)
+		if err != nil {
+			log.Printf("Error booking vehicle %d for group %d: %v", candidate.VehicleID, groupID, err)
+			http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+			return
+		}
+		if reason != "" {
+			// A specific vehicle that cannot be booked fails the group; a class booking tries the next vehicle
+			if request.VehicleClass == "" {
+				http.Error(w, fmt.Sprintf("Vehicle %d is %s during the requested period; nothing was booked", candidate.VehicleID, reason), http.StatusConflict)
+				return
+			}
+			continue
+		}
+		members = append(members, candidate)
+	}
+	if len(members) < size {
+		http.Error(w, fmt.Sprintf("Only %d %s vehicles are free during the requested period; nothing was booked", len(members), request.VehicleClass), http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing group booking:", err)
+		http.Error(w, "Error creating group booking", http.StatusInternalServerError)
+		return
+	}
+
+	group, err := fetchGroup(int(groupID))
+	if err != nil {
+		log.Printf("Error fetching group %d: %v", groupID, err)
+		http.Error(w, "Group booked but could not be loaded", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Booked %d vehicles", len(members)),
+		"group":   group,
+	})
+}
+
+// fetchGroup loads a group and its members in vehicle order
+func fetchGroup(groupID int) (Group, error) {
+	var group Group
+	err := db.QueryRow("SELECT group_id, user_id, start_time, end_time, created_at FROM ReservationGroups WHERE group_id = ?", groupID).
+		Scan(&group.GroupID, &group.UserID, &group.StartTime, &group.EndTime, &group.CreatedAt)
+	if err != nil {
+		return group, err
+	}
+
+	rows, err := db.Query(`
+        SELECT r.reservation_id, r.vehicle_id, v.vehicle_name, v.hourly_rate, r.pickup_station_id, r.status, r.total_cost,
+               IF(r.status = 'Pending', r.hold_expires_at, NULL)
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.group_id = ?
+        ORDER BY r.vehicle_id`, groupID)
+	if err != nil {
+		return group, err
+	}
+	defer rows.Close()
+
+	group.Members = []GroupMember{}
+	for rows.Next() {
+		var member GroupMember
+		var holdExpiresAt *time.Time
+		if err := rows.Scan(&member.ReservationID, &member.VehicleID, &member.VehicleName, &member.HourlyRate, &member.StationID,
+			&member.Status, &member.TotalCost, &holdExpiresAt); err != nil {
+			return group, err
+		}
+		if member.Status == lifecycle.Pending || member.Status == lifecycle.Confirmed {
+			group.TotalCost += member.TotalCost
+		}
+		if holdExpiresAt != nil && (group.HoldExpiresAt == nil || holdExpiresAt.Before(*group.HoldExpiresAt)) {
+			group.HoldExpiresAt = holdExpiresAt
+		}
+		group.Members = append(group.Members, member)
+	}
+	group.TotalCost = math.Round(group.TotalCost*100) / 100
+	return group, rows.Err()
+}
+
+// GetGroup retrieves a group booking with all of its members
+func GetGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["group_id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	group, err := fetchGroup(groupID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching group %d: %v", groupID, err)
+		http.Error(w, "Error fetching group", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(group)
+}
@@ -0,0 +1,229 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Payment states of a reservation in a user's reservation history
+const (
+	PaymentUnpaid            = "Unpaid"
+	PaymentPaid              = "Paid"
+	PaymentPartiallyRefunded = "PartiallyRefunded"
+	PaymentRefunded          = "Refunded"
+)
+
+// Page sizes of a user's reservation history
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// Columns a user's reservation history can be sorted by
+var historySortColumns = map[string]string{
+	"start_time": "r.start_time",
+	"end_time":   "r.end_time",
+	"created_at": "r.created_at",
+	"total_cost": "r.total_cost",
+}
+
+// Statuses a user's reservation history can be filtered by
+var historyStatuses = map[string]bool{
+	lifecycle.Pending:    true,
+	lifecycle.Confirmed:  true,
+	lifecycle.InProgress: true,
+	lifecycle.Completed:  true,
+	lifecycle.Cancelled:  true,
+	lifecycle.NoShow:     true,
+	lifecycle.Expired:    true,
+}
+
+// historyQuery is a parsed request for a page of a user's reservation history
+type historyQuery struct {
+	conditions []string
+	args       []interface{}
+	orderBy    string
+	limit      int
+	offset     int
+}
+
+// parseHistoryQuery reads the filters, sort order and page of a user's reservation history from
+// the query string:
+//   - status: one or more comma-separated reservation statuses
+//   - from, to: only reservations overlapping this period, as RFC 3339 timestamps or YYYY-MM-DD
+//   - vehicle_id: only reservations of this vehicle
+//   - sort: start_time, end_time, created_at (the default) or total_cost
+//   - order: desc (the default) or asc
+//   - limit, offset: the page, 50 reservations by default and at most 200
+func parseHistoryQuery(r *http.Request, userID int) (historyQuery, error) {
+	query := r.URL.Query()
+	h := historyQuery{conditions: []string{"r.user_id = ?"}, args: []interface{}{userID}, limit: defaultHistoryLimit}
+
+	if statusParam := query.Get("status"); statusParam != "" {
+		statuses := strings.Split(statusParam, ",")
+		for i, status := range statuses {
+			statuses[i] = strings.TrimSpace(status)
+			if !historyStatuses[statuses[i]] {
+				return h, fmt.Errorf("invalid status %q", statuses[i])
+			}
+			h.args = append(h.args, statuses[i])
+		}
+		h.conditions = append(h.conditions, "r.status IN (?"+strings.Repeat(", ?", len(statuses)-1)+")")
+	}
+
+	var from, to time.Time
+	var err error
+	if fromParam := query.Get("from"); fromParam != "" {
+		if from, err = parseHistoryDate(fromParam); err != nil {
+			return h, fmt.Errorf("invalid from date")
+		}
+		h.conditions = append(h.conditions, "r.end_time > ?")
+		h.args = append(h.args, from)
+	}
+	if toParam := query.Get("to"); toParam != "" {
+		if to, err = parseHistoryDate(toParam); err != nil {
+			return h, fmt.Errorf("invalid to date")
+		}
+		h.conditions = append(h.conditions, "r.start_time < ?")
+		h.args = append(h.args, to)
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return h, fmt.Errorf("to must be after from")
+	}
+
+	if vehicleParam := query.Get("vehicle_id"); vehicleParam != "" {
+		vehicleID, err := strconv.Atoi(vehicleParam)
+		if err != nil {
+			return h, fmt.Errorf("invalid vehicle_id")
+		}
+		h.conditions = append(h.conditions, "r.vehicle_id = ?")
+		h.args = append(h.args, vehicleID)
+	}
+
+	column := historySortColumns["created_at"]
+	if sortParam := query.Get("sort"); sortParam != "" {
+		var ok bool
+		if column, ok = historySortColumns[sortParam]; !ok {
+			return h, fmt.Errorf("sort must be start_time, end_time, created_at or total_cost")
+		}
+	}
+	direction := "DESC"
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		direction = "ASC"
+	default:
+		return h, fmt.Errorf("order must be asc or desc")
+	}
+	// Break ties by reservation ID so pages do not overlap
+	h.orderBy = fmt.Sprintf("%s %s, r.reservation_id %s", column, direction, direction)
+
+	if limitParam := query.Get("limit"); limitParam != "" {
+		h.limit, err = strconv.Atoi(limitParam)
+		if err != nil || h.limit <= 0 || h.limit > maxHistoryLimit {
+			return h, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+	}
+	if offsetParam := query.Get("offset"); offsetParam != "" {
+		h.offset, err = strconv.Atoi(offsetParam)
+		if err != nil || h.offset < 0 {
+			return h, fmt.Errorf("offset must not be negative")
+		}
+	}
+	return h, nil
+}
+
+func parseHistoryDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// paymentStatus works out the payment state of a reservation from its rental invoice
+func paymentStatus(invoiceID *int, amountPaid float64, amountRefunded float64) string {
+	switch {
+	case invoiceID == nil:
+		return PaymentUnpaid
+	case amountRefunded <= 0:
+		return PaymentPaid
+	case amountRefunded < amountPaid:
+		return PaymentPartiallyRefunded
+	}
+	return PaymentRefunded
+}
+
+// GetUserReservations retrieves a page of a user's reservations with their payment state. The
+// total number of reservations matching the filters is returned in the X-Total-Count header.
+func GetUserReservations(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	h, err := parseHistoryQuery(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	where := strings.Join(h.conditions, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Reservations r WHERE "+where, h.args...).Scan(&total); err != nil {
+		log.Printf("Error counting reservations for user %d: %v", userID, err)
+		http.Error(w, "Error fetching reservations", http.StatusInternalServerError)
+		return
+	}
+
+	// A reservation in a group booking is paid on the group's invoice, its share being its Rental line item
+	rows, err := db.Query(`
+        SELECT r.reservation_id, r.user_id, r.vehicle_id, v.vehicle_name, v.hourly_rate, s.station_id, s.station_name,
+               r.start_time, r.end_time, r.status, r.total_cost, r.created_at, COALESCE(r.trip_distance_km, 0),
+               COALESCE(r.series_id, 0), COALESCE(r.group_id, 0), IF(r.status = 'Pending', r.hold_expires_at, NULL),
+               i.invoice_id,
+               COALESCE(IF(i.group_id IS NULL, i.final_amount,
+                           (SELECT SUM(l.amount) FROM ElectriGo_BillingDB.InvoiceLineItems l WHERE l.invoice_id = i.invoice_id AND l.reservation_id = r.reservation_id)), 0),
+               COALESCE((SELECT SUM(f.amount) FROM ElectriGo_BillingDB.Refunds f WHERE f.invoice_id = i.invoice_id AND f.reservation_id = r.reservation_id), 0)
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        JOIN Stations s ON r.pickup_station_id = s.station_id
+        LEFT JOIN ElectriGo_BillingDB.Invoices i ON i.invoice_type = 'Rental' AND (i.reservation_id = r.reservation_id OR i.group_id = r.group_id)
+        WHERE `+where+`
+        ORDER BY `+h.orderBy+`
+        LIMIT ? OFFSET ?`, append(h.args, h.limit, h.offset)...)
+	if err != nil {
+		log.Printf("Error fetching reservations for user %d from database: %v", userID, err)
+		http.Error(w, "Error fetching reservations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	reservations := []Reservation{}
+	for rows.Next() {
+		var reservation Reservation
+		err := rows.Scan(&reservation.ReservationID, &reservation.UserID, &reservation.VehicleID, &reservation.VehicleName, &reservation.HourlyRate,
+			&reservation.StationID, &reservation.StationName, &reservation.StartTime, &reservation.EndTime, &reservation.Status, &reservation.TotalCost,
+			&reservation.CreatedAt, &reservation.TripDistance, &reservation.SeriesID, &reservation.GroupID, &reservation.HoldExpiresAt,
+			&reservation.InvoiceID, &reservation.AmountPaid, &reservation.AmountRefunded)
+		if err != nil {
+			log.Printf("Error scanning reservation row: %v", err)
+			http.Error(w, "Error fetching reservations", http.StatusInternalServerError)
+			return
+		}
+		reservation.PaymentStatus = paymentStatus(reservation.InvoiceID, reservation.AmountPaid, reservation.AmountRefunded)
+		reservations = append(reservations, reservation)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reservations)
+}
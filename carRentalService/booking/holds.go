@@ -0,0 +1,100 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/notify"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// New reservations hold their vehicle for this long while the renter pays for them
+const defaultHoldTTL = 15 * time.Minute
+
+// holdTTL returns how long an unpaid reservation holds its vehicle, configurable in minutes with RESERVATION_HOLD_MINUTES
+func holdTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("RESERVATION_HOLD_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultHoldTTL
+}
+
+// StartHoldSweeper periodically marks Pending reservations whose hold has expired without
+// payment as Expired and releases their vehicles
+func StartHoldSweeper(interval time.Duration) {
+	go func() {
+		for {
+			expireHolds()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// expireHolds expires each Pending reservation whose hold has run out
+func expireHolds() {
+	rows, err := db.Query("SELECT reservation_id FROM Reservations WHERE status = 'Pending' AND hold_expires_at <= ?", time.Now())
+	if err != nil {
+		log.Println("Error finding expired reservation holds:", err)
+		return
+	}
+	var reservationIDs []int
+	for rows.Next() {
+		var reservationID int
+		if err := rows.Scan(&reservationID); err != nil {
+			log.Println("Error scanning expired reservation hold:", err)
+			continue
+		}
+		reservationIDs = append(reservationIDs, reservationID)
+	}
+	rows.Close()
+
+	for _, reservationID := range reservationIDs {
+		if err := expireHold(reservationID); err != nil {
+			log.Printf("Error expiring hold on reservation %d: %v", reservationID, err)
+		}
+	}
+}
+
+// expireHold moves an unpaid reservation to Expired and releases its vehicle
+func expireHold(reservationID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Recheck under the row lock in case the reservation was paid for or cancelled meanwhile
+	var userID, vehicleID int
+	var startTime time.Time
+	err = tx.QueryRow(`
+        SELECT user_id, vehicle_id, start_time FROM Reservations
+        WHERE reservation_id = ? AND status = ? AND hold_expires_at <= ?
+        FOR UPDATE`, reservationID, lifecycle.Pending, time.Now()).Scan(&userID, &vehicleID, &startTime)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Expired' WHERE reservation_id = ?", reservationID); err != nil {
+		return err
+	}
+	if err := releaseVehicle(tx, vehicleID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Hold on reservation %d expired\n", reservationID)
+	refreshWaitlist()
+	body := fmt.Sprintf(`
+		<p>Your reservation #%d starting %s was not paid for within %s and has expired.</p>
+		<p>The vehicle has been released. You are welcome to book again if it is still available.</p>
+	`, reservationID, startTime.Format(time.RFC1123), holdTTL())
+	notify.User(userID, fmt.Sprintf("Reservation #%d expired", reservationID), body)
+	return nil
+}
@@ -0,0 +1,488 @@
+package booking
+
+import (
+	"carRentalService/availability"
+	"carRentalService/billing"
+	"carRentalService/geofence"
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/notify"
+	"carRentalService/pricing"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Vehicles returned within the grace period after their end time are not charged for the overtime,
+// and later returns are charged for all of it at the rate plan price times the penalty multiplier
+const (
+	defaultLateReturnGrace       = 15 * time.Minute
+	defaultLatePenaltyMultiplier = 1.5
+)
+
+// lateReturnGrace returns the late-return grace period, configurable in minutes with LATE_RETURN_GRACE_MINUTES
+func lateReturnGrace() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("LATE_RETURN_GRACE_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultLateReturnGrace
+}
+
+// latePenaltyMultiplier returns the overtime price multiplier, configurable with LATE_RETURN_PENALTY_MULTIPLIER
+func latePenaltyMultiplier() float64 {
+	if multiplier, err := strconv.ParseFloat(os.Getenv("LATE_RETURN_PENALTY_MULTIPLIER"), 64); err == nil && multiplier > 0 {
+		return multiplier
+	}
+	return defaultLatePenaltyMultiplier
+}
+
+// Late-return fee statuses
+const (
+	LateFeeWaived  = "Waived"
+	LateFeePending = "Pending"
+	LateFeeBilled  = "Billed"
+)
+
+// Statuses of the substitute vehicle offered to a renter delayed by a late return
+const (
+	SubstituteOffered     = "Offered"
+	SubstituteAccepted    = "Accepted"
+	SubstituteUnavailable = "Unavailable"
+)
+
+// LateReturn records a reservation returned after its end time, the penalty charged for the
+// overtime, and the next renter's reservation it delayed, if any
+type LateReturn struct {
+	LateReturnID         int       `json:"late_return_id"`
+	ReservationID        int       `json:"reservation_id"`
+	ScheduledEndTime     time.Time `json:"scheduled_end_time"`
+	ReturnedAt           time.Time `json:"returned_at"`
+	MinutesLate          int       `json:"minutes_late"`
+	Fee                  float64   `json:"fee"`
+	FeeStatus            string    `json:"fee_status"`
+	InvoiceID            *int      `json:"invoice_id,omitempty"`
+	BlockedReservationID *int      `json:"blocked_reservation_id,omitempty"`
+	SubstituteVehicleID  *int      `json:"substitute_vehicle_id,omitempty"`
+	SubstituteStatus     *string   `json:"substitute_status,omitempty"`
+}
+
+// recordLateReturn records a return made after the reservation's end time. Overtime beyond the
+// grace period is priced at the penalty rate, and the earliest unstarted reservation of the
+// vehicle that could not be picked up on time, counting the turnaround buffer, is flagged as
+// blocked. Nothing is recorded for returns within the grace period that delayed no one.
+func recordLateReturn(tx *sql.Tx, reservationID int, vehicleID int, endTime time.Time, returnedAt time.Time) (*LateReturn, error) {
+	overtime := returnedAt.Sub(endTime)
+	if overtime <= 0 {
+		return nil, nil
+	}
+	lateReturn := &LateReturn{
+		ReservationID:    reservationID,
+		ScheduledEndTime: endTime,
+		ReturnedAt:       returnedAt,
+		MinutesLate:      int(math.Ceil(overtime.Minutes())),
+		FeeStatus:        LateFeeWaived,
+	}
+
+	if overtime > lateReturnGrace() {
+		quote, err := pricing.QuoteVehicle(vehicleID, endTime, returnedAt)
+		if err != nil {
+			return nil, fmt.Errorf("pricing overtime: %w", err)
+		}
+		lateReturn.Fee = math.Round(quote.Total*latePenaltyMultiplier()*100) / 100
+		if lateReturn.Fee > 0 {
+			lateReturn.FeeStatus = LateFeePending
+		}
+	}
+
+	var blockedID int
+	err := tx.QueryRow(`
+        SELECT reservation_id FROM Reservations
+        WHERE vehicle_id = ? AND reservation_id <> ? AND status IN ('Pending', 'Confirmed') AND `+lifecycle.UnexpiredHold+`
+          AND actual_pickup_at IS NULL AND start_time < ? AND end_time > ?
+        ORDER BY start_time LIMIT 1`, vehicleID, reservationID, time.Now(), returnedAt.Add(availability.Buffer()), returnedAt).Scan(&blockedID)
+	if err == nil {
+		lateReturn.BlockedReservationID = &blockedID
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("finding blocked reservation: %w", err)
+	}
+
+	if lateReturn.FeeStatus == LateFeeWaived && lateReturn.BlockedReservationID == nil {
+		return nil, nil
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO LateReturns (reservation_id, scheduled_end_time, returned_at, minutes_late, fee, fee_status, blocked_reservation_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		reservationID, endTime, returnedAt, lateReturn.MinutesLate, lateReturn.Fee, lateReturn.FeeStatus, lateReturn.BlockedReservationID)
+	if err != nil {
+		return nil, fmt.Errorf("recording late return: %w", err)
+	}
+	lateReturnID, _ := result.LastInsertId()
+	lateReturn.LateReturnID = int(lateReturnID)
+	return lateReturn, nil
+}
+
+// billLateReturn bills a pending late-return fee on a supplementary invoice. A failed charge
+// leaves the fee Pending for the return fee sweeper; the invoice is keyed on the late return so
+// it is only created once.
+func billLateReturn(lateReturn *LateReturn) error {
+	if lateReturn.FeeStatus != LateFeePending {
+		return nil
+	}
+	description := fmt.Sprintf("Returned %d minutes after %s", lateReturn.MinutesLate, lateReturn.ScheduledEndTime.Format("2006-01-02 15:04"))
+	invoiceID, err := billing.CreateSupplementaryInvoice(lateReturn.ReservationID, []billing.Charge{
+		{ItemType: "LateReturn", Description: description, Amount: lateReturn.Fee},
+	}, fmt.Sprintf("late-return-%d", lateReturn.LateReturnID))
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE LateReturns SET fee_status = 'Billed', invoice_id = ? WHERE late_return_id = ?", invoiceID, lateReturn.LateReturnID); err != nil {
+		return err
+	}
+	lateReturn.FeeStatus = LateFeeBilled
+	lateReturn.InvoiceID = &invoiceID
+	return nil
+}
+
+// StartReturnFeeSweeper periodically bills the geofence and late-return fees of returned
+// reservations that were left Pending, for example because the Payment Service was unreachable
+func StartReturnFeeSweeper(interval time.Duration) {
+	go func() {
+		for {
+			settleReturnFees()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// settleReturnFees bills the Pending fees of reservations returned more than a minute ago, leaving
+// recent returns to the return itself
+func settleReturnFees() {
+	cutoff := time.Now().Add(-time.Minute)
+
+	rows, err := db.Query(`
+        SELECT DISTINCT v.reservation_id FROM ZoneViolations v
+        JOIN Reservations r ON v.reservation_id = r.reservation_id
+        WHERE v.fee_status = 'Pending' AND r.status = ? AND r.actual_return_at <= ?`, lifecycle.Completed, cutoff)
+	if err != nil {
+		log.Println("Error finding unbilled geofence fees:", err)
+		return
+	}
+	var reservationIDs []int
+	for rows.Next() {
+		var reservationID int
+		if err := rows.Scan(&reservationID); err != nil {
+			log.Println("Error scanning unbilled geofence fee:", err)
+			continue
+		}
+		reservationIDs = append(reservationIDs, reservationID)
+	}
+	rows.Close()
+	for _, reservationID := range reservationIDs {
+		if err := geofence.SettleViolationFees(reservationID); err != nil {
+			log.Printf("Error settling geofence fees for reservation %d: %v", reservationID, err)
+		}
+	}
+
+	rows, err = db.Query(`
+        SELECT late_return_id, reservation_id, scheduled_end_time, minutes_late, fee, fee_status
+        FROM LateReturns WHERE fee_status = ? AND returned_at <= ?`, LateFeePending, cutoff)
+	if err != nil {
+		log.Println("Error finding unbilled late-return fees:", err)
+		return
+	}
+	var lateReturns []*LateReturn
+	for rows.Next() {
+		lateReturn := &LateReturn{}
+		if err := rows.Scan(&lateReturn.LateReturnID, &lateReturn.ReservationID, &lateReturn.ScheduledEndTime, &lateReturn.MinutesLate,
+			&lateReturn.Fee, &lateReturn.FeeStatus); err != nil {
+			log.Println("Error scanning unbilled late-return fee:", err)
+			continue
+		}
+		lateReturns = append(lateReturns, lateReturn)
+	}
+	rows.Close()
+	for _, lateReturn := range lateReturns {
+		if err := billLateReturn(lateReturn); err != nil {
+			log.Printf("Error billing late return of reservation %d: %v", lateReturn.ReservationID, err)
+		}
+	}
+}
+
+// offerSubstitute finds a vehicle of the same class that is free for the rest of a blocked
+// reservation, preferring its pickup station and then the cheapest, and offers it to the renter.
+// The renter is told about the delay either way.
+func offerSubstitute(lateReturn *LateReturn) error {
+	if lateReturn.BlockedReservationID == nil {
+		return nil
+	}
+	blockedID := *lateReturn.BlockedReservationID
+
+	var userID, vehicleID, stationID int
+	var vehicleClass string
+	var startTime, endTime time.Time
+	err := db.QueryRow(`
+        SELECT r.user_id, r.vehicle_id, r.pickup_station_id, v.vehicle_class, r.start_time, r.end_time
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.reservation_id = ?`, blockedID).Scan(&userID, &vehicleID, &stationID, &vehicleClass, &startTime, &endTime)
+	if err != nil {
+		return err
+	}
+	from := startTime
+	if now := time.Now(); now.After(from) {
+		from = now
+	}
+
+	rows, err := db.Query(`
+        SELECT vehicle_id FROM Vehicles
+        WHERE vehicle_class = ? AND vehicle_id <> ? AND availability_status IN ('Available', 'Booked', 'InUse')
+        ORDER BY station_id = ? DESC, hourly_rate, vehicle_id`, vehicleClass, vehicleID, stationID)
+	if err != nil {
+		return err
+	}
+	var candidates []int
+	for rows.Next() {
+		var candidateID int
+		if err := rows.Scan(&candidateID); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, candidateID)
+	}
+	rows.Close()
+
+	substituteID := 0
+	for _, candidateID := range candidates {
+		free, err := vehicleFreeFor(candidateID, from, endTime, 0)
+		if err != nil {
+			log.Printf("Error checking substitute vehicle %d for reservation %d: %v", candidateID, blockedID, err)
+			continue
+		}
+		if free {
+			substituteID = candidateID
+			break
+		}
+	}
+
+	status := SubstituteUnavailable
+	if substituteID != 0 {
+		status = SubstituteOffered
+	}
+	_, err = db.Exec("UPDATE LateReturns SET substitute_vehicle_id = NULLIF(?, 0), substitute_status = ? WHERE late_return_id = ?",
+		substituteID, status, lateReturn.LateReturnID)
+	if err != nil {
+		return err
+	}
+	lateReturn.SubstituteStatus = &status
+	if substituteID != 0 {
+		lateReturn.SubstituteVehicleID = &substituteID
+	}
+
+	body := fmt.Sprintf(`
+		<p>The vehicle for your reservation #%d starting %s was returned late by the previous renter, and is only ready from %s.</p>
+	`, blockedID, startTime.Format(time.RFC1123), lateReturn.ReturnedAt.Add(availability.Buffer()).Format(time.RFC1123))
+	if substituteID != 0 {
+		var vehicleName, stationName string
+		err := db.QueryRow("SELECT v.vehicle_name, s.station_name FROM Vehicles v JOIN Stations s ON v.station_id = s.station_id WHERE v.vehicle_id = ?", substituteID).
+			Scan(&vehicleName, &stationName)
+		if err != nil {
+			return err
+		}
+		body += fmt.Sprintf("<p>We can offer you the %s at %s instead, at no extra cost. Accept the substitute to switch to it, or wait for your original vehicle.</p>", vehicleName, stationName)
+	} else {
+		body += "<p>We could not find a substitute vehicle of the same class. We apologise for the delay.</p>"
+	}
+	notify.User(userID, fmt.Sprintf("Reservation #%d delayed by a late return", blockedID), body)
+	return nil
+}
+
+// vehicleFreeFor reports whether a vehicle can be booked for a period without overlapping its
+// reservations, other than excludeID, or its maintenance windows
+func vehicleFreeFor(vehicleID int, start time.Time, end time.Time, excludeID int) (bool, error) {
+	maintenanceConflict, err := maintenance.HasConflict(vehicleID, start, end)
+	if err != nil || maintenanceConflict {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	overlap, err := hasOverlap(tx, vehicleID, start, end, excludeID)
+	return !overlap, err
+}
+
+// acceptSubstitute moves a reservation delayed by a late return to the substitute vehicle offered
+// for it. The price is kept, and the substitute is checked again because it is not held while offered.
+func acceptSubstitute(reservationID int, userID int) (LateReturn, error) {
+	var lateReturn LateReturn
+	tx, err := db.Begin()
+	if err != nil {
+		return lateReturn, err
+	}
+	defer tx.Rollback()
+
+	var substituteID int
+	err = tx.QueryRow(`
+        SELECT late_return_id, substitute_vehicle_id FROM LateReturns
+        WHERE blocked_reservation_id = ? AND substitute_status = ? FOR UPDATE`, reservationID, SubstituteOffered).
+		Scan(&lateReturn.LateReturnID, &substituteID)
+	if err == sql.ErrNoRows {
+		return lateReturn, newStatusError(http.StatusNotFound, "No substitute vehicle has been offered for this reservation")
+	} else if err != nil {
+		return lateReturn, fmt.Errorf("fetching substitute offer: %w", err)
+	}
+
+	var renterID, vehicleID int
+	var status string
+	var startTime, endTime time.Time
+	var pickedUp bool
+	err = tx.QueryRow("SELECT user_id, vehicle_id, status, start_time, end_time, actual_pickup_at IS NOT NULL FROM Reservations WHERE reservation_id = ? FOR UPDATE", reservationID).
+		Scan(&renterID, &vehicleID, &status, &startTime, &endTime, &pickedUp)
+	if err != nil {
+		return lateReturn, fmt.Errorf("fetching reservation: %w", err)
+	}
+	if renterID != userID {
+		return lateReturn, newStatusError(http.StatusForbidden, "Only the renter can accept a substitute vehicle")
+	}
+	if (status != lifecycle.Pending && status != lifecycle.Confirmed) || pickedUp {
+		return lateReturn, newStatusError(http.StatusConflict, "A %s reservation cannot switch vehicles", status)
+	}
+
+	// Lock both vehicles, lower ID first, so the substitute is checked against other bookings one at a time
+	lockIDs := []int{vehicleID, substituteID}
+	if substituteID < vehicleID {
+		lockIDs = []int{substituteID, vehicleID}
+	}
+	var availabilityStatus string
+	var stationID int
+	for _, id := range lockIDs {
+		var lockedStatus string
+		var lockedStation int
+		if err := tx.QueryRow("SELECT availability_status, station_id FROM Vehicles WHERE vehicle_id = ? FOR UPDATE", id).Scan(&lockedStatus, &lockedStation); err != nil {
+			return lateReturn, fmt.Errorf("locking vehicle: %w", err)
+		}
+		if id == substituteID {
+			availabilityStatus, stationID = lockedStatus, lockedStation
+		}
+	}
+
+	from := startTime
+	if now := time.Now(); now.After(from) {
+		from = now
+	}
+	unavailable := !lifecycle.IsBookable(availabilityStatus)
+	if !unavailable {
+		unavailable, err = hasOverlap(tx, substituteID, from, endTime, reservationID)
+		if err != nil {
+			return lateReturn, fmt.Errorf("checking reservation overlap: %w", err)
+		}
+	}
+	if !unavailable {
+		unavailable, err = maintenance.HasConflict(substituteID, from, endTime)
+		if err != nil {
+			return lateReturn, fmt.Errorf("checking maintenance schedule: %w", err)
+		}
+	}
+	if unavailable {
+		if _, err := tx.Exec("UPDATE LateReturns SET substitute_status = 'Unavailable' WHERE late_return_id = ?", lateReturn.LateReturnID); err != nil {
+			return lateReturn, fmt.Errorf("updating substitute offer: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return lateReturn, err
+		}
+		return lateReturn, newStatusError(http.StatusConflict, "The substitute vehicle is no longer available")
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET vehicle_id = ?, pickup_station_id = ? WHERE reservation_id = ?", substituteID, stationID, reservationID); err != nil {
+		return lateReturn, fmt.Errorf("updating reservation: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE LateReturns SET substitute_status = 'Accepted' WHERE late_return_id = ?", lateReturn.LateReturnID); err != nil {
+		return lateReturn, fmt.Errorf("updating substitute offer: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE Vehicles SET availability_status = 'Booked' WHERE vehicle_id = ? AND availability_status = 'Available'", substituteID); err != nil {
+		return lateReturn, fmt.Errorf("updating vehicle status: %w", err)
+	}
+	if err := releaseVehicle(tx, vehicleID); err != nil {
+		return lateReturn, fmt.Errorf("releasing previous vehicle: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return lateReturn, fmt.Errorf("committing substitute: %w", err)
+	}
+	refreshWaitlist()
+	return fetchLateReturn(reservationID)
+}
+
+// fetchLateReturn loads the latest late return recorded for a reservation, or that delayed it
+func fetchLateReturn(reservationID int) (LateReturn, error) {
+	var lateReturn LateReturn
+	err := db.QueryRow(`
+        SELECT late_return_id, reservation_id, scheduled_end_time, returned_at, minutes_late, fee, fee_status,
+               invoice_id, blocked_reservation_id, substitute_vehicle_id, substitute_status
+        FROM LateReturns
+        WHERE reservation_id = ? OR blocked_reservation_id = ?
+        ORDER BY late_return_id DESC LIMIT 1`, reservationID, reservationID).Scan(
+		&lateReturn.LateReturnID, &lateReturn.ReservationID, &lateReturn.ScheduledEndTime, &lateReturn.ReturnedAt,
+		&lateReturn.MinutesLate, &lateReturn.Fee, &lateReturn.FeeStatus, &lateReturn.InvoiceID,
+		&lateReturn.BlockedReservationID, &lateReturn.SubstituteVehicleID, &lateReturn.SubstituteStatus)
+	return lateReturn, err
+}
+
+// GetLateReturn retrieves the late return of a reservation, or the late return that delayed it
+func GetLateReturn(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	lateReturn, err := fetchLateReturn(reservationID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No late return recorded for this reservation", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching late return:", err)
+		http.Error(w, "Error fetching late return", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lateReturn)
+}
+
+// AcceptSubstitute switches a reservation delayed by a late return to the substitute vehicle offered for it
+func AcceptSubstitute(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	lateReturn, err := acceptSubstitute(reservationID, request.UserID)
+	if err != nil {
+		writeError(w, err, "Error accepting substitute vehicle")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Reservation moved to the substitute vehicle",
+		"late_return": lateReturn,
+	})
+}
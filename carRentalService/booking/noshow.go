@@ -0,0 +1,143 @@
+package booking
+
+import (
+	"carRentalService/billing"
+	"carRentalService/cancellation"
+	"carRentalService/lifecycle"
+	"carRentalService/notify"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Confirmed reservations not picked up this long after their start time are marked as no-shows
+const defaultNoShowGrace = time.Hour
+
+// noShowGrace returns the no-show grace period, configurable in minutes with NO_SHOW_GRACE_MINUTES
+func noShowGrace() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("NO_SHOW_GRACE_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultNoShowGrace
+}
+
+// StartNoShowMonitor periodically marks confirmed reservations that were never picked up as
+// no-shows, releasing their vehicles and applying the no-show fee
+func StartNoShowMonitor(interval time.Duration) {
+	go func() {
+		for {
+			markNoShows(time.Now().Add(-noShowGrace()))
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// notDelayedByLateReturn is an SQL condition on Reservations r that leaves out reservations whose
+// vehicle is still out with an earlier renter, or was returned late after the cutoff, so the
+// grace period only starts once the vehicle is back
+const notDelayedByLateReturn = `
+        NOT EXISTS (SELECT 1 FROM Reservations p WHERE p.vehicle_id = r.vehicle_id AND p.status = 'InProgress')
+        AND NOT EXISTS (SELECT 1 FROM LateReturns l WHERE l.blocked_reservation_id = r.reservation_id AND l.returned_at > ?)`
+
+// markNoShows handles each confirmed reservation that started before the cutoff without being picked up
+func markNoShows(cutoff time.Time) {
+	rows, err := db.Query(`
+        SELECT r.reservation_id FROM Reservations r
+        WHERE r.status = 'Confirmed' AND r.actual_pickup_at IS NULL AND r.start_time <= ? AND`+notDelayedByLateReturn, cutoff, cutoff)
+	if err != nil {
+		log.Println("Error finding no-show reservations:", err)
+		return
+	}
+	var reservationIDs []int
+	for rows.Next() {
+		var reservationID int
+		if err := rows.Scan(&reservationID); err != nil {
+			log.Println("Error scanning no-show reservation:", err)
+			continue
+		}
+		reservationIDs = append(reservationIDs, reservationID)
+	}
+	rows.Close()
+
+	for _, reservationID := range reservationIDs {
+		if err := markNoShow(reservationID, cutoff); err != nil {
+			log.Printf("Error marking reservation %d as a no-show: %v", reservationID, err)
+		}
+	}
+}
+
+// markNoShow moves a reservation to NoShow, releases its vehicle and refunds whatever the renter's
+// no-show policy does not keep. The refund is queued with the no-show and sent once it is
+// committed; a failed refund is left to the billing retrier.
+func markNoShow(reservationID int, cutoff time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Recheck under the row lock in case the renter picked the vehicle up or cancelled meanwhile, or
+	// the vehicle is still out with a late renter
+	var userID, vehicleID int
+	var startTime time.Time
+	err = tx.QueryRow(`
+        SELECT r.user_id, r.vehicle_id, r.start_time FROM Reservations r
+        WHERE r.reservation_id = ? AND r.status = ? AND r.actual_pickup_at IS NULL AND r.start_time <= ? AND`+notDelayedByLateReturn+`
+        FOR UPDATE`, reservationID, lifecycle.Confirmed, cutoff, cutoff).Scan(&userID, &vehicleID, &startTime)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	policy, err := cancellation.PolicyFor(userID)
+	if err != nil {
+		return err
+	}
+	amountPaid, err := cancellation.AmountPaid(reservationID)
+	if err != nil {
+		return err
+	}
+	outcome := cancellation.EvaluateNoShow(policy, amountPaid)
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'NoShow' WHERE reservation_id = ?", reservationID); err != nil {
+		return err
+	}
+	if err := releaseVehicle(tx, vehicleID); err != nil {
+		return err
+	}
+
+	billingRequestID := 0
+	if outcome.Refund > 0 {
+		reason := fmt.Sprintf("No-show on reservation %d (%s policy)", reservationID, policy.MembershipTier)
+		if billingRequestID, err = billing.QueueRefund(tx, reservationID, outcome.Refund, reason); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if billingRequestID != 0 {
+		if refunded, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error refunding no-show reservation %d, it will be retried: %v", reservationID, err)
+		} else {
+			outcome.Refund = refunded
+		}
+	}
+
+	log.Printf("Reservation %d marked as a no-show\n", reservationID)
+	refreshWaitlist()
+	body := fmt.Sprintf(`
+		<p>Your reservation #%d starting %s was not picked up within %s and has been marked as a no-show.</p>
+		<p>Under your %s membership policy, a no-show fee of $%.2f applies.</p>
+	`, reservationID, startTime.Format(time.RFC1123), noShowGrace(), policy.MembershipTier, outcome.Fee)
+	if outcome.Refund > 0 {
+		body += fmt.Sprintf("<p>The remaining $%.2f will be refunded to you shortly.</p>", outcome.Refund)
+	}
+	notify.User(userID, fmt.Sprintf("Reservation #%d marked as a no-show", reservationID), body)
+	return nil
+}
@@ -0,0 +1,283 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/pricing"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quotes are honoured at booking for this long
+const defaultQuoteTTL = 10 * time.Minute
+
+// quoteTTL returns how long a quote is honoured, configurable in minutes with QUOTE_VALID_MINUTES
+func quoteTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("QUOTE_VALID_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultQuoteTTL
+}
+
+// Errors returned when a quote cannot be honoured
+var (
+	ErrQuoteInvalid  = errors.New("quote is invalid")
+	ErrQuoteExpired  = errors.New("quote has expired")
+	ErrQuoteMismatch = errors.New("quote is for a different vehicle, user, period or promo code")
+)
+
+var (
+	quoteKey     []byte
+	quoteKeyOnce sync.Once
+)
+
+// quoteSigningKey returns the key quotes are signed with, set with QUOTE_SIGNING_KEY. Without it a
+// random key is used, so quotes are not honoured after a restart.
+func quoteSigningKey() []byte {
+	quoteKeyOnce.Do(func() {
+		if key := os.Getenv("QUOTE_SIGNING_KEY"); key != "" {
+			quoteKey = []byte(key)
+			return
+		}
+		quoteKey = make([]byte, 32)
+		if _, err := rand.Read(quoteKey); err != nil {
+			log.Fatal("Error generating quote signing key:", err)
+		}
+		log.Println("QUOTE_SIGNING_KEY not set, quotes will not be honoured after a restart")
+	})
+	return quoteKey
+}
+
+// quoteClaims are the terms of a quote that are signed into its ID. The rates are carried so that
+// the booking gets the quoted price breakdown as well as the quoted rental cost.
+type quoteClaims struct {
+	VehicleID  int           `json:"v"`
+	UserID     int           `json:"u,omitempty"`
+	StartTime  int64         `json:"s"`
+	EndTime    int64         `json:"e"`
+	Rates      pricing.Rates `json:"r"`
+	RentalCost float64       `json:"c"`
+	PromoCode  string        `json:"p,omitempty"` // The only promo code the reservation can be paid with
+	ExpiresAt  int64         `json:"x"`
+}
+
+// sign returns a quote ID carrying the claims and their HMAC-SHA256 signature
+func (claims quoteClaims) sign() string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, quoteSigningKey())
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyQuote checks a quote ID's signature and expiry and returns its claims
+func verifyQuote(quoteID string, now time.Time) (quoteClaims, error) {
+	var claims quoteClaims
+	encoded, signature, found := strings.Cut(quoteID, ".")
+	if !found {
+		return claims, ErrQuoteInvalid
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return claims, ErrQuoteInvalid
+	}
+	mac := hmac.New(sha256.New, quoteSigningKey())
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return claims, ErrQuoteInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, ErrQuoteInvalid
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrQuoteExpired
+	}
+	return claims, nil
+}
+
+// honourQuote returns the price breakdown of a quote if it was issued for this reservation and has
+// not expired, and sets the reservation's promo code to the quote's. A quote issued without a user
+// can be honoured for any user, as the rental cost does not depend on the user.
+func honourQuote(quoteID string, reservation *Reservation) (pricing.Quote, error) {
+	claims, err := verifyQuote(quoteID, time.Now())
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+	if claims.VehicleID != reservation.VehicleID || (claims.UserID != 0 && claims.UserID != reservation.UserID) ||
+		claims.StartTime != reservation.StartTime.Unix() || claims.EndTime != reservation.EndTime.Unix() ||
+		(reservation.PromoCode != "" && reservation.PromoCode != claims.PromoCode) {
+		return pricing.Quote{}, ErrQuoteMismatch
+	}
+	breakdown := claims.Rates.Quote(reservation.StartTime, reservation.EndTime)
+	if breakdown.Total != claims.RentalCost {
+		return pricing.Quote{}, ErrQuoteInvalid
+	}
+	reservation.PromoCode = claims.PromoCode
+	return breakdown, nil
+}
+
+// PriceQuote is the itemised price of a rental before it is booked
+type PriceQuote struct {
+	QuoteID                   string        `json:"quote_id"`   // Pass to MakeReservation to be charged this rental cost with this promo code
+	ExpiresAt                 time.Time     `json:"expires_at"` // The quote is honoured until this time
+	VehicleID                 int           `json:"vehicle_id"`
+	VehicleName               string        `json:"vehicle_name"`
+	UserID                    int           `json:"user_id,omitempty"`
+	StartTime                 time.Time     `json:"start_time"`
+	EndTime                   time.Time     `json:"end_time"`
+	PriceBreakdown            pricing.Quote `json:"price_breakdown"` // Base rate, time-based rates and caps
+	RentalCost                float64       `json:"rental_cost"`
+	MembershipTier            string        `json:"membership_tier,omitempty"`
+	MembershipDiscountPercent float64       `json:"membership_discount_percent"`
+	MembershipDiscount        float64       `json:"membership_discount"`
+	PromoCode                 string        `json:"promo_code,omitempty"`
+	PromoDiscountPercent      float64       `json:"promo_discount_percent"`
+	PromoDiscount             float64       `json:"promo_discount"`
+	Total                     float64       `json:"total"` // After discounts; later charges such as charging sessions are invoiced separately
+}
+
+// QuoteReservation prices a rental without booking it, after checking that the vehicle is free for
+// the period. Discounts are worked out as at checkout: the membership discount first, then the promo
+// code on the rest. The signed quote ID holds the rental cost and its breakdown for
+// QUOTE_VALID_MINUTES when booking, and ties the reservation to the quoted promo code, if any.
+func QuoteReservation(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		VehicleID int       `json:"vehicle_id"`
+		StartTime time.Time `json:"start_time"`
+		EndTime   time.Time `json:"end_time"`
+		UserID    int       `json:"user_id"`    // Optional, for the membership discount
+		PromoCode string    `json:"promo_code"` // Optional
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.VehicleID == 0 ||
+		request.StartTime.IsZero() || request.EndTime.IsZero() {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	if !request.EndTime.After(request.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+	if request.EndTime.Sub(request.StartTime) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusBadRequest)
+		return
+	}
+	if request.StartTime.Before(time.Now()) {
+		http.Error(w, "Start time cannot be in the past", http.StatusBadRequest)
+		return
+	}
+
+	quote := PriceQuote{VehicleID: request.VehicleID, UserID: request.UserID, StartTime: request.StartTime, EndTime: request.EndTime}
+
+	// Check that the vehicle is free for the period, as a booking would
+	var availabilityStatus string
+	err := db.QueryRow("SELECT availability_status, vehicle_name FROM Vehicles WHERE vehicle_id = ?", request.VehicleID).Scan(&availabilityStatus, &quote.VehicleName)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching vehicle for quote:", err)
+		http.Error(w, "Error calculating quote", http.StatusInternalServerError)
+		return
+	}
+	if !lifecycle.IsBookable(availabilityStatus) {
+		http.Error(w, "Vehicle is not available", http.StatusConflict)
+		return
+	}
+	maintenanceConflict, err := maintenance.HasConflict(request.VehicleID, request.StartTime, request.EndTime)
+	if err != nil {
+		log.Println("Error checking maintenance schedule:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	if maintenanceConflict {
+		http.Error(w, "Vehicle is scheduled for maintenance during the requested period", http.StatusConflict)
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	overlap, err := hasOverlap(tx, request.VehicleID, request.StartTime, request.EndTime, 0)
+	tx.Rollback()
+	if err != nil {
+		log.Println("Error checking reservations for quote:", err)
+		http.Error(w, "Error checking vehicle availability", http.StatusInternalServerError)
+		return
+	}
+	if overlap {
+		http.Error(w, "Vehicle is already reserved during the requested period", http.StatusConflict)
+		return
+	}
+
+	rates, err := pricing.VehicleRates(request.VehicleID, request.StartTime, request.EndTime)
+	if err != nil {
+		log.Println("Error pricing quote:", err)
+		http.Error(w, "Error calculating quote", http.StatusInternalServerError)
+		return
+	}
+	quote.PriceBreakdown = rates.Quote(request.StartTime, request.EndTime)
+	quote.RentalCost = quote.PriceBreakdown.Total
+
+	if request.UserID != 0 {
+		err := db.QueryRow(`
+            SELECT u.membership_tier, COALESCE(t.discount_percent, 0)
+            FROM ElectriGo_AccountDB.Users u
+            LEFT JOIN ElectriGo_AccountDB.MembershipTiers t ON t.membership_tier = u.membership_tier
+            WHERE u.user_id = ?`, request.UserID).Scan(&quote.MembershipTier, &quote.MembershipDiscountPercent)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error fetching membership tier for quote:", err)
+			http.Error(w, "Error calculating quote", http.StatusInternalServerError)
+			return
+		}
+	}
+	if request.PromoCode != "" {
+		err := db.QueryRow("SELECT discount_percentage FROM ElectriGo_BillingDB.Promotions WHERE promo_code = ? AND CURDATE() BETWEEN valid_from AND valid_until",
+			request.PromoCode).Scan(&quote.PromoDiscountPercent)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Promo code is invalid or expired", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error fetching promo code for quote:", err)
+			http.Error(w, "Error calculating quote", http.StatusInternalServerError)
+			return
+		}
+		quote.PromoCode = request.PromoCode
+	}
+	quote.MembershipDiscount = math.Round(quote.RentalCost*quote.MembershipDiscountPercent) / 100
+	quote.PromoDiscount = math.Round((quote.RentalCost-quote.MembershipDiscount)*quote.PromoDiscountPercent) / 100
+	quote.Total = math.Round((quote.RentalCost-quote.MembershipDiscount-quote.PromoDiscount)*100) / 100
+
+	quote.ExpiresAt = time.Now().Add(quoteTTL()).Truncate(time.Second)
+	quote.QuoteID = quoteClaims{
+		VehicleID:  request.VehicleID,
+		UserID:     request.UserID,
+		StartTime:  request.StartTime.Unix(),
+		EndTime:    request.EndTime.Unix(),
+		Rates:      rates,
+		RentalCost: quote.RentalCost,
+		PromoCode:  quote.PromoCode,
+		ExpiresAt:  quote.ExpiresAt.Unix(),
+	}.sign()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,63 @@
+package booking
+
+import (
+	"carRentalService/pricing"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHonourQuote(t *testing.T) {
+	start := time.Date(2030, 3, 4, 9, 0, 0, 0, pricing.Location())
+	end := start.Add(3 * time.Hour)
+	rates := pricing.Rates{
+		Plan:       pricing.Plan{VehicleClass: "Standard", PeakMultiplier: 1.5, WeekendMultiplier: 1, HolidayMultiplier: 1, PeakStartHour: 8, PeakEndHour: 10},
+		HourlyRate: 20,
+	}
+	quoted := rates.Quote(start, end)
+	claims := quoteClaims{
+		VehicleID:  1,
+		UserID:     2,
+		StartTime:  start.Unix(),
+		EndTime:    end.Unix(),
+		Rates:      rates,
+		RentalCost: quoted.Total,
+		PromoCode:  "SPRING",
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+	}
+	expired := claims
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	wrongCost := claims
+	wrongCost.RentalCost = quoted.Total - 1
+
+	tests := []struct {
+		name      string
+		quoteID   string
+		promoCode string // Promo code given when booking
+		wantErr   error
+	}{
+		{"quoted promo code", claims.sign(), "", nil},
+		{"same promo code", claims.sign(), "SPRING", nil},
+		{"different promo code", claims.sign(), "SUMMER", ErrQuoteMismatch},
+		{"expired", expired.sign(), "", ErrQuoteExpired},
+		{"cost does not match rates", wrongCost.sign(), "", ErrQuoteInvalid},
+		{"tampered", claims.sign() + "x", "", ErrQuoteInvalid},
+	}
+	for _, test := range tests {
+		reservation := Reservation{VehicleID: 1, UserID: 2, StartTime: start, EndTime: end, PromoCode: test.promoCode}
+		breakdown, err := honourQuote(test.quoteID, &reservation)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if breakdown.Total != quoted.Total || len(breakdown.Items) != len(quoted.Items) {
+			t.Errorf("%s: got breakdown %+v, want the quoted %+v", test.name, breakdown, quoted)
+		}
+		if reservation.PromoCode != "SPRING" {
+			t.Errorf("%s: got promo code %q, want the quoted SPRING", test.name, reservation.PromoCode)
+		}
+	}
+}
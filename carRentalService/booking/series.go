@@ -0,0 +1,426 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/pricing"
+	"carRentalService/recurrence"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Series statuses
+const (
+	SeriesActive    = "Active"
+	SeriesCancelled = "Cancelled"
+)
+
+// Series is a recurring reservation. Each occurrence is an ordinary reservation, so single
+// occurrences are paid, modified and cancelled through the reservation endpoints.
+type Series struct {
+	SeriesID    int          `json:"series_id"`
+	UserID      int          `json:"user_id"`
+	VehicleID   int          `json:"vehicle_id"`
+	Rule        string       `json:"rrule"`
+	StartTime   time.Time    `json:"start_time"`
+	EndTime     time.Time    `json:"end_time"`
+	Status      string       `json:"status"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Occurrences []Occurrence `json:"occurrences"`
+}
+
+// Occurrence is a reservation belonging to a series
+type Occurrence struct {
+	ReservationID int       `json:"reservation_id"`
+	VehicleID     int       `json:"vehicle_id"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Status        string    `json:"status"`
+	TotalCost     float64   `json:"total_cost"`
+}
+
+// Conflict is an occurrence that could not be booked or changed
+type Conflict struct {
+	ReservationID int       `json:"reservation_id,omitempty"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Reason        string    `json:"reason"`
+}
+
+// bookOccurrence checks and books one occurrence of a series, returning a conflict reason if
+// the vehicle is not free
+func bookOccurrence(reservation *Reservation) (string, error) {
+	maintenanceConflict, err := maintenance.HasConflict(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
+	if err != nil {
+		return "", err
+	}
+	if maintenanceConflict {
+		return "Vehicle is scheduled for maintenance", nil
+	}
+
+	quote, err := pricing.QuoteVehicle(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
+	if err != nil {
+		return "", err
+	}
+	reservation.TotalCost = quote.Total
+
+	err = createReservation(reservation)
+	switch {
+	case errors.Is(err, ErrOverlap):
+		return "Vehicle is already reserved", nil
+	case errors.Is(err, ErrVehicleUnavailable):
+		return "Vehicle is not available", nil
+	}
+	return "", err
+}
+
+// CreateSeries books a recurring reservation. Every occurrence is checked for availability; free
+// occurrences are booked as Pending reservations and the rest are reported as conflicts.
+func CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID    int       `json:"user_id"`
+		VehicleID int       `json:"vehicle_id"`
+		StartTime time.Time `json:"start_time"` // Times of the first occurrence
+		EndTime   time.Time `json:"end_time"`
+		Rule      string    `json:"rrule"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 || request.VehicleID == 0 ||
+		request.StartTime.IsZero() || request.EndTime.IsZero() {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+
+	// Occurrences repeat at the same local clock time, on local days of the week
+	start, end := request.StartTime.In(time.Local), request.EndTime.In(time.Local)
+	if !end.After(start) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+	if end.Sub(start) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusBadRequest)
+		return
+	}
+	if start.Before(time.Now()) {
+		http.Error(w, "Start time cannot be in the past", http.StatusBadRequest)
+		return
+	}
+	rule, err := recurrence.Parse(request.Rule)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid rrule: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var stationID int
+	err = db.QueryRow("SELECT station_id FROM Vehicles WHERE vehicle_id = ?", request.VehicleID).Scan(&stationID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching vehicle for series:", err)
+		http.Error(w, "Error creating reservation series", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO ReservationSeries (user_id, vehicle_id, rrule, start_time, end_time, status) VALUES (?, ?, ?, ?, ?, ?)",
+		request.UserID, request.VehicleID, rule.String(), start, end, SeriesActive)
+	if err != nil {
+		log.Println("Error inserting reservation series:", err)
+		http.Error(w, "Error creating reservation series", http.StatusInternalServerError)
+		return
+	}
+	seriesID, _ := result.LastInsertId()
+
+	booked := []Occurrence{}
+	conflicts := []Conflict{}
+	totalCost := 0.0
+	duration := end.Sub(start)
+	for _, occurrenceStart := range rule.Occurrences(start) {
+		reservation := Reservation{
+			UserID:    request.UserID,
+			VehicleID: request.VehicleID,
+			StationID: stationID,
+			StartTime: occurrenceStart,
+			EndTime:   occurrenceStart.Add(duration),
+			SeriesID:  int(seriesID),
+		}
+		reason, err := bookOccurrence(&reservation)
+		if err != nil {
+			log.Printf("Error booking occurrence %s of series %d: %v", occurrenceStart.Format(time.RFC3339), seriesID, err)
+			reason = "Error booking this occurrence"
+		}
+		if reason != "" {
+			conflicts = append(conflicts, Conflict{StartTime: reservation.StartTime, EndTime: reservation.EndTime, Reason: reason})
+			continue
+		}
+		booked = append(booked, Occurrence{
+			ReservationID: reservation.ReservationID,
+			VehicleID:     reservation.VehicleID,
+			StartTime:     reservation.StartTime,
+			EndTime:       reservation.EndTime,
+			Status:        lifecycle.Pending,
+			TotalCost:     reservation.TotalCost,
+		})
+		totalCost += reservation.TotalCost
+	}
+
+	// A series with no bookable occurrences is not kept
+	if len(booked) == 0 {
+		if _, err := db.Exec("DELETE FROM ReservationSeries WHERE series_id = ?", seriesID); err != nil {
+			log.Printf("Error deleting empty series %d: %v", seriesID, err)
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "None of the occurrences could be booked",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    fmt.Sprintf("Booked %d of %d occurrences", len(booked), len(booked)+len(conflicts)),
+		"series_id":  seriesID,
+		"rrule":      rule.String(),
+		"booked":     booked,
+		"conflicts":  conflicts,
+		"total_cost": math.Round(totalCost*100) / 100,
+	})
+}
+
+// fetchSeries loads a series and its occurrences in start order
+func fetchSeries(seriesID int) (Series, error) {
+	var series Series
+	err := db.QueryRow("SELECT series_id, user_id, vehicle_id, rrule, start_time, end_time, status, created_at FROM ReservationSeries WHERE series_id = ?", seriesID).
+		Scan(&series.SeriesID, &series.UserID, &series.VehicleID, &series.Rule, &series.StartTime, &series.EndTime, &series.Status, &series.CreatedAt)
+	if err != nil {
+		return series, err
+	}
+
+	rows, err := db.Query("SELECT reservation_id, vehicle_id, start_time, end_time, status, total_cost FROM Reservations WHERE series_id = ? ORDER BY start_time", seriesID)
+	if err != nil {
+		return series, err
+	}
+	defer rows.Close()
+
+	series.Occurrences = []Occurrence{}
+	for rows.Next() {
+		var occurrence Occurrence
+		if err := rows.Scan(&occurrence.ReservationID, &occurrence.VehicleID, &occurrence.StartTime, &occurrence.EndTime, &occurrence.Status, &occurrence.TotalCost); err != nil {
+			return series, err
+		}
+		series.Occurrences = append(series.Occurrences, occurrence)
+	}
+	return series, rows.Err()
+}
+
+// GetSeries retrieves a recurring series with all of its occurrences
+func GetSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(mux.Vars(r)["series_id"])
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+
+	series, err := fetchSeries(seriesID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching series %d: %v", seriesID, err)
+		http.Error(w, "Error fetching series", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(series)
+}
+
+// isUpcoming reports whether an occurrence can still be changed as part of its series
+func (occurrence Occurrence) isUpcoming() bool {
+	return (occurrence.Status == lifecycle.Pending || occurrence.Status == lifecycle.Confirmed) && occurrence.StartTime.After(time.Now())
+}
+
+// UpdateSeries changes the clock times, length or vehicle of every upcoming occurrence of a series.
+// Each occurrence follows the usual modification rules; those that cannot be changed are reported
+// as conflicts and keep their current times.
+func UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(mux.Vars(r)["series_id"])
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		UserID          int    `json:"user_id"`
+		VehicleID       int    `json:"vehicle_id"`       // Optional; switches every occurrence to another vehicle
+		StartClock      string `json:"start_clock"`      // Optional new local start time of day, such as 08:30
+		DurationMinutes int    `json:"duration_minutes"` // Optional new length of each occurrence
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 || request.DurationMinutes < 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	var startClock time.Time
+	if request.StartClock != "" {
+		if startClock, err = time.Parse("15:04", request.StartClock); err != nil {
+			http.Error(w, "start_clock must be a time of day such as 08:30", http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := fetchSeries(seriesID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching series %d: %v", seriesID, err)
+		http.Error(w, "Error updating series", http.StatusInternalServerError)
+		return
+	}
+	if series.UserID != request.UserID {
+		http.Error(w, "Only the renter can modify this series", http.StatusForbidden)
+		return
+	}
+	if series.Status != SeriesActive {
+		http.Error(w, "A cancelled series cannot be modified", http.StatusConflict)
+		return
+	}
+
+	// reschedule applies the requested clock time and length to an occurrence's times
+	reschedule := func(start time.Time, end time.Time) (time.Time, time.Time) {
+		start = start.In(time.Local)
+		duration := end.Sub(start)
+		if request.StartClock != "" {
+			start = time.Date(start.Year(), start.Month(), start.Day(), startClock.Hour(), startClock.Minute(), 0, 0, time.Local)
+		}
+		if request.DurationMinutes > 0 {
+			duration = time.Duration(request.DurationMinutes) * time.Minute
+		}
+		return start, start.Add(duration)
+	}
+
+	updated := []Occurrence{}
+	conflicts := []Conflict{}
+	for _, occurrence := range series.Occurrences {
+		if !occurrence.isUpcoming() {
+			continue
+		}
+		start, end := reschedule(occurrence.StartTime, occurrence.EndTime)
+		result, err := modifyReservation(occurrence.ReservationID, modification{UserID: request.UserID, VehicleID: request.VehicleID, StartTime: start, EndTime: end})
+		if err != nil {
+			var statusErr *statusError
+			reason := "Error updating this occurrence"
+			if errors.As(err, &statusErr) {
+				reason = statusErr.message
+			} else {
+				log.Printf("Error updating occurrence %d of series %d: %v", occurrence.ReservationID, seriesID, err)
+			}
+			conflicts = append(conflicts, Conflict{ReservationID: occurrence.ReservationID, StartTime: start, EndTime: end, Reason: reason})
+			continue
+		}
+		updated = append(updated, Occurrence{
+			ReservationID: occurrence.ReservationID,
+			VehicleID:     result.VehicleID,
+			StartTime:     start,
+			EndTime:       end,
+			Status:        occurrence.Status,
+			TotalCost:     result.TotalCost,
+		})
+	}
+
+	// Keep the series' own times and vehicle in line with the occurrences
+	seriesStart, seriesEnd := reschedule(series.StartTime, series.EndTime)
+	vehicleID := series.VehicleID
+	if request.VehicleID != 0 {
+		vehicleID = request.VehicleID
+	}
+	if len(updated) > 0 {
+		_, err = db.Exec("UPDATE ReservationSeries SET vehicle_id = ?, start_time = ?, end_time = ? WHERE series_id = ?", vehicleID, seriesStart, seriesEnd, seriesID)
+		if err != nil {
+			log.Printf("Error updating series %d: %v", seriesID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   fmt.Sprintf("Updated %d of %d upcoming occurrences", len(updated), len(updated)+len(conflicts)),
+		"updated":   updated,
+		"conflicts": conflicts,
+	})
+}
+
+// CancelSeries cancels every upcoming occurrence of a series under the usual cancellation policy.
+// The series itself is cancelled once none of its occurrences are left upcoming.
+func CancelSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(mux.Vars(r)["series_id"])
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+
+	series, err := fetchSeries(seriesID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching series %d: %v", seriesID, err)
+		http.Error(w, "Error cancelling series", http.StatusInternalServerError)
+		return
+	}
+	if series.Status == SeriesCancelled {
+		http.Error(w, "Series is already cancelled", http.StatusConflict)
+		return
+	}
+
+	type cancelledOccurrence struct {
+		ReservationID   int     `json:"reservation_id"`
+		CancellationFee float64 `json:"cancellation_fee"`
+		RefundAmount    float64 `json:"refund_amount"`
+		RefundPending   bool    `json:"refund_pending,omitempty"` // The refund could not be sent yet and will be retried
+	}
+	cancelled := []cancelledOccurrence{}
+	conflicts := []Conflict{}
+	totalRefund := 0.0
+	for _, occurrence := range series.Occurrences {
+		if !occurrence.isUpcoming() {
+			continue
+		}
+		outcome, refundPending, err := cancelReservation(occurrence.ReservationID)
+		if err != nil {
+			var statusErr *statusError
+			reason := "Error cancelling this occurrence"
+			if errors.As(err, &statusErr) {
+				reason = statusErr.message
+			} else {
+				log.Printf("Error cancelling occurrence %d of series %d: %v", occurrence.ReservationID, seriesID, err)
+			}
+			conflicts = append(conflicts, Conflict{ReservationID: occurrence.ReservationID, StartTime: occurrence.StartTime, EndTime: occurrence.EndTime, Reason: reason})
+			continue
+		}
+		cancelled = append(cancelled, cancelledOccurrence{ReservationID: occurrence.ReservationID, CancellationFee: outcome.Fee, RefundAmount: outcome.Refund, RefundPending: refundPending})
+		totalRefund += outcome.Refund
+	}
+
+	if len(conflicts) == 0 {
+		if _, err := db.Exec("UPDATE ReservationSeries SET status = ? WHERE series_id = ?", SeriesCancelled, seriesID); err != nil {
+			log.Printf("Error cancelling series %d: %v", seriesID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       fmt.Sprintf("Cancelled %d of %d upcoming occurrences", len(cancelled), len(cancelled)+len(conflicts)),
+		"cancelled":     cancelled,
+		"conflicts":     conflicts,
+		"refund_amount": math.Round(totalRefund*100) / 100,
+	})
+}
@@ -0,0 +1,459 @@
+package booking
+
+import (
+	"carRentalService/lifecycle"
+	"carRentalService/maintenance"
+	"carRentalService/notify"
+	"carRentalService/pricing"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Waitlist entry statuses. An entry waits until a matching vehicle frees up, is then Offered
+// with a hold on that vehicle, and becomes Accepted once the user books it. Entries whose offer
+// lapses or whose window starts first become Expired.
+const (
+	WaitlistWaiting   = "Waiting"
+	WaitlistOffered   = "Offered"
+	WaitlistAccepted  = "Accepted"
+	WaitlistExpired   = "Expired"
+	WaitlistCancelled = "Cancelled"
+)
+
+// Offers are held for defaultOfferHold unless configured otherwise
+const defaultOfferHold = 30 * time.Minute
+
+// waitlistMutex makes sure only one pass over the waitlist hands out offers at a time
+var waitlistMutex sync.Mutex
+
+// WaitlistEntry is a user waiting for a vehicle, or any vehicle of a class, to become free for a period
+type WaitlistEntry struct {
+	WaitlistID       int        `json:"waitlist_id"`
+	UserID           int        `json:"user_id"`
+	VehicleID        *int       `json:"vehicle_id"`
+	VehicleClass     *string    `json:"vehicle_class"`
+	StartTime        time.Time  `json:"start_time"`
+	EndTime          time.Time  `json:"end_time"`
+	Status           string     `json:"status"`
+	OfferedVehicleID *int       `json:"offered_vehicle_id"`
+	OfferExpiresAt   *time.Time `json:"offer_expires_at"`
+	ReservationID    *int       `json:"reservation_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// offerHold returns how long an offer is held, configurable in minutes with WAITLIST_HOLD_MINUTES
+func offerHold() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("WAITLIST_HOLD_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultOfferHold
+}
+
+// StartWaitlistMonitor periodically expires lapsed offers and offers freed vehicles to waiting users
+func StartWaitlistMonitor(interval time.Duration) {
+	go func() {
+		for {
+			processWaitlist()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// refreshWaitlist offers any vehicle time freed by a cancellation or change to waiting users, in the background
+func refreshWaitlist() {
+	go processWaitlist()
+}
+
+// processWaitlist expires lapsed offers and entries whose window has started, then offers each
+// waiting entry, oldest first, the first matching vehicle that is free for its window
+func processWaitlist() {
+	waitlistMutex.Lock()
+	defer waitlistMutex.Unlock()
+
+	now := time.Now()
+	_, err := db.Exec(`
+        UPDATE WaitlistEntries SET status = 'Expired'
+        WHERE (status = 'Offered' AND offer_expires_at <= ?) OR (status IN ('Waiting', 'Offered') AND start_time <= ?)`, now, now)
+	if err != nil {
+		log.Println("Error expiring waitlist entries:", err)
+		return
+	}
+
+	rows, err := db.Query("SELECT waitlist_id, user_id, vehicle_id, vehicle_class, start_time, end_time FROM WaitlistEntries WHERE status = 'Waiting' ORDER BY created_at, waitlist_id")
+	if err != nil {
+		log.Println("Error fetching waitlist:", err)
+		return
+	}
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var entry WaitlistEntry
+		if err := rows.Scan(&entry.WaitlistID, &entry.UserID, &entry.VehicleID, &entry.VehicleClass, &entry.StartTime, &entry.EndTime); err != nil {
+			log.Println("Error scanning waitlist entry:", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	for _, entry := range entries {
+		candidates, err := waitlistCandidates(entry)
+		if err != nil {
+			log.Printf("Error finding vehicles for waitlist entry %d: %v", entry.WaitlistID, err)
+			continue
+		}
+		for _, vehicleID := range candidates {
+			offered, err := offerVehicle(entry, vehicleID)
+			if err != nil {
+				log.Printf("Error offering vehicle %d to waitlist entry %d: %v", vehicleID, entry.WaitlistID, err)
+				continue
+			}
+			if offered {
+				break
+			}
+		}
+	}
+}
+
+// waitlistCandidates returns the bookable vehicles that match a waitlist entry, cheapest first
+func waitlistCandidates(entry WaitlistEntry) ([]int, error) {
+	rows, err := db.Query(`
+        SELECT vehicle_id FROM Vehicles
+        WHERE (vehicle_id = ? OR vehicle_class = ?) AND availability_status IN ('Available', 'Booked', 'InUse')
+        ORDER BY hourly_rate, vehicle_id`, entry.VehicleID, entry.VehicleClass)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vehicleIDs []int
+	for rows.Next() {
+		var vehicleID int
+		if err := rows.Scan(&vehicleID); err != nil {
+			return nil, err
+		}
+		vehicleIDs = append(vehicleIDs, vehicleID)
+	}
+	return vehicleIDs, rows.Err()
+}
+
+// offerVehicle holds a vehicle for a waitlist entry if it is free for the entry's window, and
+// notifies the user. The vehicle is locked so the hold cannot overlap a booking made meanwhile.
+func offerVehicle(entry WaitlistEntry, vehicleID int) (bool, error) {
+	maintenanceConflict, err := maintenance.HasConflict(vehicleID, entry.StartTime, entry.EndTime)
+	if err != nil || maintenanceConflict {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var availabilityStatus string
+	if err := tx.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ? FOR UPDATE", vehicleID).Scan(&availabilityStatus); err != nil {
+		return false, err
+	}
+	if !lifecycle.IsBookable(availabilityStatus) {
+		return false, nil
+	}
+	overlap, err := hasOverlap(tx, vehicleID, entry.StartTime, entry.EndTime, 0)
+	if err != nil || overlap {
+		return false, err
+	}
+
+	expiresAt := time.Now().Add(offerHold())
+	result, err := tx.Exec("UPDATE WaitlistEntries SET status = 'Offered', offered_vehicle_id = ?, offer_expires_at = ? WHERE waitlist_id = ? AND status = 'Waiting'",
+		vehicleID, expiresAt, entry.WaitlistID)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	log.Printf("Vehicle %d offered to waitlist entry %d\n", vehicleID, entry.WaitlistID)
+	notify.User(entry.UserID, "A vehicle is available for your waitlisted booking", fmt.Sprintf(`
+		<p>Vehicle %d is now available from %s to %s, as you requested on waitlist entry #%d.</p>
+		<p>We are holding it for you until %s. Accept the offer before then to book it.</p>
+	`, vehicleID, entry.StartTime.Format(time.RFC1123), entry.EndTime.Format(time.RFC1123), entry.WaitlistID, expiresAt.Format(time.RFC1123)))
+	return true, nil
+}
+
+// JoinWaitlist adds a user to the waitlist for a vehicle, or any vehicle of a class, for a period
+func JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID       int       `json:"user_id"`
+		VehicleID    int       `json:"vehicle_id"`
+		VehicleClass string    `json:"vehicle_class"`
+		StartTime    time.Time `json:"start_time"`
+		EndTime      time.Time `json:"end_time"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 || request.StartTime.IsZero() || request.EndTime.IsZero() {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	if (request.VehicleID == 0) == (request.VehicleClass == "") {
+		http.Error(w, "Give either vehicle_id or vehicle_class", http.StatusBadRequest)
+		return
+	}
+	if !request.EndTime.After(request.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+	if request.EndTime.Sub(request.StartTime) > maxRentalDuration {
+		http.Error(w, "Reservations cannot be longer than 30 days", http.StatusBadRequest)
+		return
+	}
+	if !request.StartTime.After(time.Now()) {
+		http.Error(w, "Start time must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	// The vehicle or class must exist
+	var vehicleID sql.NullInt64
+	var vehicleClass sql.NullString
+	var exists bool
+	var err error
+	if request.VehicleID != 0 {
+		vehicleID = sql.NullInt64{Int64: int64(request.VehicleID), Valid: true}
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM Vehicles WHERE vehicle_id = ?)", request.VehicleID).Scan(&exists)
+	} else {
+		vehicleClass = sql.NullString{String: request.VehicleClass, Valid: true}
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM Vehicles WHERE vehicle_class = ?)", request.VehicleClass).Scan(&exists)
+	}
+	if err != nil {
+		log.Println("Error checking waitlist vehicle:", err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+
+	// A user waits at most once for the same vehicle or class and overlapping period
+	var alreadyWaiting bool
+	err = db.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM WaitlistEntries
+            WHERE user_id = ? AND vehicle_id <=> ? AND vehicle_class <=> ? AND status IN ('Waiting', 'Offered')
+              AND start_time < ? AND end_time > ?
+        )`, request.UserID, vehicleID, vehicleClass, request.EndTime, request.StartTime).Scan(&alreadyWaiting)
+	if err != nil {
+		log.Println("Error checking existing waitlist entries:", err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+	if alreadyWaiting {
+		http.Error(w, "You are already on the waitlist for this vehicle and period", http.StatusConflict)
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO WaitlistEntries (user_id, vehicle_id, vehicle_class, start_time, end_time, status) VALUES (?, ?, ?, ?, ?, 'Waiting')",
+		request.UserID, vehicleID, vehicleClass, request.StartTime, request.EndTime)
+	if err != nil {
+		log.Println("Error inserting waitlist entry:", err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+	waitlistID, _ := result.LastInsertId()
+
+	// Position among users waiting for the same vehicle or class
+	var position int
+	err = db.QueryRow("SELECT COUNT(*) FROM WaitlistEntries WHERE vehicle_id <=> ? AND vehicle_class <=> ? AND status = 'Waiting' AND waitlist_id <= ?",
+		vehicleID, vehicleClass, waitlistID).Scan(&position)
+	if err != nil {
+		log.Println("Error fetching waitlist position:", err)
+	}
+
+	// The vehicle may already have freed up
+	refreshWaitlist()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Joined the waitlist successfully",
+		"waitlist_id": waitlistID,
+		"position":    position,
+	})
+}
+
+// GetUserWaitlist retrieves a user's waitlist entries, newest first
+func GetUserWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	rows, err := db.Query(`
+        SELECT waitlist_id, user_id, vehicle_id, vehicle_class, start_time, end_time, status, offered_vehicle_id, offer_expires_at, reservation_id, created_at
+        FROM WaitlistEntries WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		log.Printf("Error fetching waitlist for user %s: %v", userID, err)
+		http.Error(w, "Error fetching waitlist", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var entry WaitlistEntry
+		if err := rows.Scan(&entry.WaitlistID, &entry.UserID, &entry.VehicleID, &entry.VehicleClass, &entry.StartTime, &entry.EndTime, &entry.Status,
+			&entry.OfferedVehicleID, &entry.OfferExpiresAt, &entry.ReservationID, &entry.CreatedAt); err != nil {
+			log.Println("Error scanning waitlist entry:", err)
+			http.Error(w, "Error fetching waitlist", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+// decodeWaitlistAction reads the waitlist entry ID and the acting user of an accept or leave request
+func decodeWaitlistAction(r *http.Request) (int, int, error) {
+	waitlistID, err := strconv.Atoi(mux.Vars(r)["waitlist_id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid waitlist ID")
+	}
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		return 0, 0, fmt.Errorf("Invalid input")
+	}
+	return waitlistID, request.UserID, nil
+}
+
+// AcceptWaitlistOffer books the vehicle held for a waitlist entry as a Pending reservation
+func AcceptWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	waitlistID, userID, err := decodeWaitlistAction(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting waitlist acceptance transaction:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var entry WaitlistEntry
+	err = tx.QueryRow("SELECT user_id, status, offered_vehicle_id, offer_expires_at, start_time, end_time FROM WaitlistEntries WHERE waitlist_id = ? FOR UPDATE", waitlistID).
+		Scan(&entry.UserID, &entry.Status, &entry.OfferedVehicleID, &entry.OfferExpiresAt, &entry.StartTime, &entry.EndTime)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching waitlist entry:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+	if entry.UserID != userID {
+		http.Error(w, "Only the waitlisted user can accept this offer", http.StatusForbidden)
+		return
+	}
+	if entry.Status != WaitlistOffered || entry.OfferedVehicleID == nil {
+		http.Error(w, fmt.Sprintf("A %s waitlist entry has no offer to accept", entry.Status), http.StatusConflict)
+		return
+	}
+	if !entry.OfferExpiresAt.After(time.Now()) {
+		http.Error(w, "The offer has expired", http.StatusConflict)
+		return
+	}
+
+	// Release the hold before booking so it does not block the user's own reservation
+	if _, err := tx.Exec("UPDATE WaitlistEntries SET status = 'Accepted' WHERE waitlist_id = ?", waitlistID); err != nil {
+		log.Println("Error accepting waitlist offer:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+
+	reservation := Reservation{UserID: userID, VehicleID: *entry.OfferedVehicleID, StartTime: entry.StartTime, EndTime: entry.EndTime}
+	if err := tx.QueryRow("SELECT station_id FROM Vehicles WHERE vehicle_id = ?", reservation.VehicleID).Scan(&reservation.StationID); err != nil {
+		log.Println("Error fetching offered vehicle:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+	quote, err := pricing.QuoteVehicle(reservation.VehicleID, reservation.StartTime, reservation.EndTime)
+	if err != nil {
+		log.Println("Error pricing waitlist reservation:", err)
+		http.Error(w, "Error calculating reservation cost", http.StatusInternalServerError)
+		return
+	}
+	reservation.TotalCost = quote.Total
+
+	err = insertReservation(tx, &reservation)
+	switch {
+	case errors.Is(err, ErrVehicleNotFound), errors.Is(err, ErrVehicleUnavailable), errors.Is(err, ErrOverlap):
+		http.Error(w, "The offered vehicle is no longer available", http.StatusConflict)
+		return
+	case err != nil:
+		log.Println("Error inserting waitlist reservation:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE WaitlistEntries SET reservation_id = ? WHERE waitlist_id = ?", reservation.ReservationID, waitlistID); err != nil {
+		log.Println("Error linking waitlist reservation:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing waitlist acceptance:", err)
+		http.Error(w, "Error accepting offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           "Offer accepted, reservation created successfully",
+		"reservation_id":    reservation.ReservationID,
+		"vehicle_id":        reservation.VehicleID,
+		"pickup_station_id": reservation.StationID,
+		"total_cost":        reservation.TotalCost,
+		"price_breakdown":   quote,
+	})
+}
+
+// LeaveWaitlist removes a user from the waitlist, declining any offer being held for them
+func LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	waitlistID, userID, err := decodeWaitlistAction(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("UPDATE WaitlistEntries SET status = 'Cancelled' WHERE waitlist_id = ? AND user_id = ? AND status IN ('Waiting', 'Offered')", waitlistID, userID)
+	if err != nil {
+		log.Println("Error leaving waitlist:", err)
+		http.Error(w, "Error leaving waitlist", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "No waiting entry found for this user", http.StatusNotFound)
+		return
+	}
+
+	// A declined offer frees the vehicle for the next user
+	refreshWaitlist()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Left the waitlist successfully",
+	})
+}
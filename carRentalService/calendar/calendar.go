@@ -0,0 +1,298 @@
+package calendar
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for calendar service
+var db *sql.DB
+
+// Initialize the database connection for calendar service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for CalendarFeeds table connected successfully.")
+}
+
+// Event is a reservation as it appears in a calendar
+type Event struct {
+	ReservationID  int
+	VehicleName    string
+	LicensePlate   string
+	StationName    string
+	StationAddress string
+	StartTime      time.Time
+	EndTime        time.Time
+	Status         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+const eventQuery = `
+        SELECT r.reservation_id, v.vehicle_name, v.license_plate, s.station_name, s.address, r.start_time, r.end_time, r.status,
+               r.created_at, r.updated_at
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        JOIN Stations s ON r.pickup_station_id = s.station_id`
+
+// baseURL returns the address feed links are built on, configurable with CAR_RENTAL_SERVICE_URL
+func baseURL() string {
+	if url := os.Getenv("CAR_RENTAL_SERVICE_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8081"
+}
+
+// feedURL returns the subscription address of a feed token
+func feedURL(token string) string {
+	return fmt.Sprintf("%s/v1/calendar/feeds/%s.ics", baseURL(), token)
+}
+
+// newToken returns a random feed token
+func newToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// GetFeed returns a user's calendar feed address, creating the feed on first use
+func GetFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var token string
+	err = db.QueryRow("SELECT token FROM CalendarFeeds WHERE user_id = ?", userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		if token, err = newToken(); err == nil {
+			_, err = db.Exec("INSERT INTO CalendarFeeds (user_id, token) VALUES (?, ?) ON DUPLICATE KEY UPDATE token = token", userID, token)
+		}
+		if err == nil {
+			err = db.QueryRow("SELECT token FROM CalendarFeeds WHERE user_id = ?", userID).Scan(&token)
+		}
+	}
+	if err != nil {
+		log.Println("Error fetching calendar feed:", err)
+		http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  userID,
+		"feed_url": feedURL(token),
+	})
+}
+
+// ResetFeed replaces a user's feed token, so calendars subscribed to the old address stop updating
+func ResetFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newToken()
+	if err == nil {
+		_, err = db.Exec("INSERT INTO CalendarFeeds (user_id, token) VALUES (?, ?) ON DUPLICATE KEY UPDATE token = VALUES(token), created_at = CURRENT_TIMESTAMP", userID, token)
+	}
+	if err != nil {
+		log.Println("Error resetting calendar feed:", err)
+		http.Error(w, "Error resetting calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Calendar feed address reset successfully",
+		"user_id":  userID,
+		"feed_url": feedURL(token),
+	})
+}
+
+// ServeFeed serves every reservation of the feed's user as an iCalendar feed. Cancelled and
+// missed reservations stay in the feed as cancelled events so subscribed calendars remove them.
+func ServeFeed(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM CalendarFeeds WHERE token = ?", token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Calendar feed not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching calendar feed:", err)
+		http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(eventQuery+" WHERE r.user_id = ? ORDER BY r.start_time", userID)
+	if err != nil {
+		log.Println("Error fetching reservations for calendar feed:", err)
+		http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := scanEvent(rows, &event); err != nil {
+			log.Println("Error scanning reservation for calendar feed:", err)
+			http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+			return
+		}
+		events = append(events, event)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(Format("ElectriGo Reservations", events, time.Now())))
+}
+
+// DownloadReservation serves a single reservation as an .ics file
+func DownloadReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	var event Event
+	err = scanEvent(db.QueryRow(eventQuery+" WHERE r.reservation_id = ?", reservationID), &event)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation for calendar download:", err)
+		http.Error(w, "Error fetching reservation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="electrigo-reservation-%d.ics"`, reservationID))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(Format(fmt.Sprintf("ElectriGo Reservation #%d", reservationID), []Event{event}, time.Now())))
+}
+
+// scanner is a single row or a row of a result set
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row scanner, event *Event) error {
+	return row.Scan(&event.ReservationID, &event.VehicleName, &event.LicensePlate, &event.StationName, &event.StationAddress,
+		&event.StartTime, &event.EndTime, &event.Status, &event.CreatedAt, &event.UpdatedAt)
+}
+
+// Format renders events as an iCalendar (RFC 5545) calendar. Each reservation keeps the same UID,
+// and its SEQUENCE grows whenever it changes, so calendar apps update the event in place.
+func Format(name string, events []Event, now time.Time) string {
+	var lines []string
+	lines = append(lines,
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//ElectriGo//Reservations//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:"+escapeText(name),
+	)
+	for _, event := range events {
+		summary := fmt.Sprintf("ElectriGo: %s (%s)", event.VehicleName, event.LicensePlate)
+		description := fmt.Sprintf("Reservation #%d\nVehicle: %s\nLicence plate: %s\nPick-up: %s, %s\nStatus: %s",
+			event.ReservationID, event.VehicleName, event.LicensePlate, event.StationName, event.StationAddress, event.Status)
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:reservation-%d@electrigo", event.ReservationID),
+			"DTSTAMP:"+formatTime(now),
+			"DTSTART:"+formatTime(event.StartTime),
+			"DTEND:"+formatTime(event.EndTime),
+			"CREATED:"+formatTime(event.CreatedAt),
+			"LAST-MODIFIED:"+formatTime(event.UpdatedAt),
+			"SEQUENCE:"+strconv.FormatInt(sequence(event), 10),
+			"SUMMARY:"+escapeText(summary),
+			"LOCATION:"+escapeText(event.StationName+", "+event.StationAddress),
+			"DESCRIPTION:"+escapeText(description),
+			"STATUS:"+eventStatus(event.Status),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var calendar strings.Builder
+	for _, line := range lines {
+		calendar.WriteString(fold(line))
+	}
+	return calendar.String()
+}
+
+// sequence numbers the revisions of an event by the seconds between its creation and last change
+func sequence(event Event) int64 {
+	if event.UpdatedAt.Before(event.CreatedAt) {
+		return 0
+	}
+	return int64(event.UpdatedAt.Sub(event.CreatedAt).Seconds())
+}
+
+// eventStatus maps a reservation status to an iCalendar event status
+func eventStatus(status string) string {
+	switch status {
+	case "Pending":
+		return "TENTATIVE"
+	case "Cancelled", "NoShow", "Expired":
+		return "CANCELLED"
+	}
+	return "CONFIRMED"
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeText escapes the characters that have a meaning in iCalendar text values
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// fold ends a content line with CRLF, splitting it into lines of at most 75 octets without
+// breaking a UTF-8 character; continuation lines start with a space
+func fold(line string) string {
+	var folded strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		folded.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // The leading space counts towards the next line
+	}
+	folded.WriteString(line + "\r\n")
+	return folded.String()
+}
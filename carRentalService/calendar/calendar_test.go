@@ -0,0 +1,166 @@
+package calendar
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the named file in testdata, rewriting the file instead with -update
+func golden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s:\n got: %q\nwant: %q", path, got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	singapore := time.FixedZone("SGT", 8*60*60)
+	created := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		{
+			ReservationID:  42,
+			VehicleName:    "Tesla Model 3",
+			LicensePlate:   "SGX1234A",
+			StationName:    "Marina Bay",
+			StationAddress: "10 Bayfront Ave, Singapore 018956",
+			StartTime:      time.Date(2025, 1, 6, 9, 0, 0, 0, singapore),
+			EndTime:        time.Date(2025, 1, 6, 17, 30, 0, 0, singapore),
+			Status:         "Confirmed",
+			CreatedAt:      created,
+			UpdatedAt:      created.Add(90 * time.Second),
+		},
+		{
+			ReservationID:  43,
+			VehicleName:    "Nissan Leaf; Édition spéciale",
+			LicensePlate:   "SGY9876B",
+			StationName:    "Orchard\\Somerset",
+			StationAddress: "1 Orchard Rd, 東京 station annex, Singapore 238824 – entrance beside the café ☕",
+			StartTime:      time.Date(2025, 1, 7, 8, 0, 0, 0, time.UTC),
+			EndTime:        time.Date(2025, 1, 7, 9, 0, 0, 0, time.UTC),
+			Status:         "Pending",
+			CreatedAt:      created,
+			UpdatedAt:      created,
+		},
+		{
+			ReservationID:  44,
+			VehicleName:    "BYD Atto 3",
+			LicensePlate:   "SGZ5555C",
+			StationName:    "Jurong East",
+			StationAddress: "50 Jurong Gateway Rd",
+			StartTime:      time.Date(2025, 1, 8, 8, 0, 0, 0, time.UTC),
+			EndTime:        time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC),
+			Status:         "Cancelled",
+			CreatedAt:      created,
+			UpdatedAt:      created.Add(-time.Hour), // Clock skew must not give a negative SEQUENCE
+		},
+	}
+	now := time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	calendar := Format("ElectriGo Reservations, Alice", events, now)
+	golden(t, "reservations.ics", calendar)
+	checkContentLines(t, calendar)
+}
+
+func TestFormatWithoutEvents(t *testing.T) {
+	calendar := Format("ElectriGo Reservations", nil, time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC))
+	golden(t, "empty.ics", calendar)
+}
+
+// checkContentLines checks that every line ends with CRLF, is at most 75 octets and is valid UTF-8
+func checkContentLines(t *testing.T, calendar string) {
+	t.Helper()
+	if !strings.HasSuffix(calendar, "\r\n") {
+		t.Errorf("calendar does not end with CRLF")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is %d octets long: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a UTF-8 character: %q", line)
+		}
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("line contains a bare line break: %q", line)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	ascii := func(n int) string { return strings.Repeat("a", n) }
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "VERSION:2.0", "VERSION:2.0\r\n"},
+		{"empty", "", "\r\n"},
+		{"exactly 75 octets", ascii(75), ascii(75) + "\r\n"},
+		{"76 octets", ascii(76), ascii(75) + "\r\n a\r\n"},
+		{"continuation lines hold 74 octets", ascii(75 + 74 + 1), ascii(75) + "\r\n " + ascii(74) + "\r\n a\r\n"},
+		{"2-octet character across the limit", ascii(74) + "é", ascii(74) + "\r\n é\r\n"},
+		{"2-octet character ending at the limit", ascii(73) + "éb", ascii(73) + "é\r\n b\r\n"},
+		{"3-octet character across the limit", ascii(73) + "€", ascii(73) + "\r\n €\r\n"},
+		{"3-octet character ending at the limit", ascii(72) + "☕☕", ascii(72) + "☕\r\n ☕\r\n"},
+		{"4-octet character across the limit", ascii(72) + "😀", ascii(72) + "\r\n 😀\r\n"},
+		{"4-octet character starting at the limit", ascii(75) + "😀", ascii(75) + "\r\n 😀\r\n"},
+		{"multi-octet characters only", strings.Repeat("東", 26), strings.Repeat("東", 25) + "\r\n 東\r\n"},
+	}
+	for _, test := range tests {
+		if got := fold(test.line); got != test.want {
+			t.Errorf("%s: fold(%q) = %q, want %q", test.name, test.line, got, test.want)
+		}
+	}
+}
+
+func TestFoldUnfoldsToOriginal(t *testing.T) {
+	for _, line := range []string{
+		"DESCRIPTION:" + strings.Repeat("Reservation café ☕ 東京 😀 ", 20),
+		"LOCATION:" + strings.Repeat("é", 200),
+		"SUMMARY:" + strings.Repeat("x", 500),
+	} {
+		folded := fold(line)
+		checkContentLines(t, folded)
+		if unfolded := strings.TrimSuffix(strings.ReplaceAll(folded, "\r\n ", ""), "\r\n"); unfolded != line {
+			t.Errorf("fold(%q) unfolds to %q", line, unfolded)
+		}
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Marina Bay", "Marina Bay"},
+		{"10 Bayfront Ave, Singapore", `10 Bayfront Ave\, Singapore`},
+		{"Leaf; Édition", `Leaf\; Édition`},
+		{`Orchard\Somerset`, `Orchard\\Somerset`},
+		{"line one\nline two", `line one\nline two`},
+		{"line one\r\nline two", `line one\nline two`},
+		{`\,;`, `\\\,\;`},
+		{"東京 ☕", "東京 ☕"},
+	}
+	for _, test := range tests {
+		if got := escapeText(test.text); got != test.want {
+			t.Errorf("escapeText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package cancellation
+
+import (
+	"carRentalService/staff"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for cancellation service
+var db *sql.DB
+
+// Initialize the database connection for cancellation service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for CancellationPolicies table connected successfully.")
+}
+
+// Policy used for users whose membership tier has no policy configured
+const (
+	defaultFreeCancellationHours = 24
+	defaultLateFeePercent        = 50
+	defaultNoShowFeePercent      = 100
+)
+
+// Membership tiers of the Users table
+var membershipTiers = map[string]bool{
+	"Basic":   true,
+	"Premium": true,
+	"VIP":     true,
+}
+
+// Rules under which a cancellation was charged
+const (
+	RuleFree       = "Free"
+	RuleLate       = "LateCancellation"
+	RuleAfterStart = "AfterStart"
+	RuleNoShow     = "NoShow"
+)
+
+// Policy is the cancellation policy of a membership tier. Cancelling is free until
+// FreeCancellationHours before the start time, costs LateFeePercent of the amount paid after
+// that, and is not refunded at all once the reservation has started. Renters who never pick up
+// the vehicle are charged NoShowFeePercent of the amount paid.
+type Policy struct {
+	MembershipTier        string  `json:"membership_tier"`
+	FreeCancellationHours float64 `json:"free_cancellation_hours"`
+	LateFeePercent        float64 `json:"late_fee_percent"`
+	NoShowFeePercent      float64 `json:"no_show_fee_percent"`
+}
+
+// Outcome is the fee and refund for cancelling a reservation
+type Outcome struct {
+	Policy           Policy  `json:"policy"`
+	Rule             string  `json:"rule"`
+	HoursBeforeStart float64 `json:"hours_before_start"`
+	AmountPaid       float64 `json:"amount_paid"`
+	Fee              float64 `json:"cancellation_fee"`
+	Refund           float64 `json:"refund_amount"`
+}
+
+// validate checks that a policy's values are in range
+func (policy Policy) validate() error {
+	switch {
+	case !membershipTiers[policy.MembershipTier]:
+		return fmt.Errorf("unknown membership tier %q", policy.MembershipTier)
+	case policy.FreeCancellationHours < 0:
+		return fmt.Errorf("free_cancellation_hours cannot be negative")
+	case policy.LateFeePercent < 0 || policy.LateFeePercent > 100:
+		return fmt.Errorf("late_fee_percent must be between 0 and 100")
+	case policy.NoShowFeePercent < 0 || policy.NoShowFeePercent > 100:
+		return fmt.Errorf("no_show_fee_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// PolicyFor returns the cancellation policy of a user's membership tier
+func PolicyFor(userID int) (Policy, error) {
+	var policy Policy
+	err := db.QueryRow(`
+        SELECT u.membership_tier,
+               COALESCE(p.free_cancellation_hours, ?), COALESCE(p.late_fee_percent, ?), COALESCE(p.no_show_fee_percent, ?)
+        FROM ElectriGo_AccountDB.Users u
+        LEFT JOIN CancellationPolicies p ON p.membership_tier = u.membership_tier
+        WHERE u.user_id = ?`, defaultFreeCancellationHours, defaultLateFeePercent, defaultNoShowFeePercent, userID).
+		Scan(&policy.MembershipTier, &policy.FreeCancellationHours, &policy.LateFeePercent, &policy.NoShowFeePercent)
+	return policy, err
+}
+
+// AmountPaid returns what has been paid for a reservation and not yet refunded, or 0 if it has not
+// been paid. A reservation in a group booking has paid its share of the group's combined invoice,
+// which is the total of the invoice's line items for that reservation.
+func AmountPaid(reservationID int) (float64, error) {
+	var paid float64
+	err := db.QueryRow(`
+        SELECT IF(i.group_id IS NULL,
+                  i.final_amount - COALESCE((SELECT SUM(f.amount) FROM ElectriGo_BillingDB.Refunds f WHERE f.invoice_id = i.invoice_id), 0),
+                  COALESCE((SELECT SUM(l.amount) FROM ElectriGo_BillingDB.InvoiceLineItems l WHERE l.invoice_id = i.invoice_id AND l.reservation_id = r.reservation_id), 0)
+                  - COALESCE((SELECT SUM(f.amount) FROM ElectriGo_BillingDB.Refunds f WHERE f.invoice_id = i.invoice_id AND f.reservation_id = r.reservation_id), 0))
+        FROM Reservations r
+        JOIN ElectriGo_BillingDB.Invoices i ON i.invoice_type = 'Rental' AND (i.reservation_id = r.reservation_id OR i.group_id = r.group_id)
+        WHERE r.reservation_id = ?`, reservationID).Scan(&paid)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return math.Max(0, paid), err
+}
+
+// Evaluate works out the fee and refund for cancelling at a given time a reservation starting at start
+func Evaluate(policy Policy, start time.Time, at time.Time, amountPaid float64) Outcome {
+	outcome := Outcome{Policy: policy, HoursBeforeStart: math.Round(start.Sub(at).Hours()*100) / 100, AmountPaid: amountPaid}
+	switch {
+	case !at.Before(start):
+		outcome.Rule = RuleAfterStart
+		outcome.Fee = amountPaid
+	case start.Sub(at).Hours() >= policy.FreeCancellationHours:
+		outcome.Rule = RuleFree
+	default:
+		outcome.Rule = RuleLate
+		outcome.Fee = math.Round(amountPaid*policy.LateFeePercent) / 100
+	}
+	outcome.Refund = math.Round((amountPaid-outcome.Fee)*100) / 100
+	return outcome
+}
+
+// EvaluateNoShow works out the fee and refund for a reservation that was never picked up
+func EvaluateNoShow(policy Policy, amountPaid float64) Outcome {
+	outcome := Outcome{Policy: policy, Rule: RuleNoShow, AmountPaid: amountPaid}
+	outcome.Fee = math.Round(amountPaid*policy.NoShowFeePercent) / 100
+	outcome.Refund = math.Round((amountPaid-outcome.Fee)*100) / 100
+	return outcome
+}
+
+// GetPolicies retrieves the cancellation policy of each membership tier
+func GetPolicies(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT membership_tier, free_cancellation_hours, late_fee_percent, no_show_fee_percent FROM CancellationPolicies ORDER BY membership_tier")
+	if err != nil {
+		log.Println("Error fetching cancellation policies:", err)
+		http.Error(w, "Error fetching cancellation policies", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	policies := []Policy{}
+	for rows.Next() {
+		var policy Policy
+		if err := rows.Scan(&policy.MembershipTier, &policy.FreeCancellationHours, &policy.LateFeePercent, &policy.NoShowFeePercent); err != nil {
+			log.Println("Error scanning cancellation policy:", err)
+			http.Error(w, "Error fetching cancellation policies", http.StatusInternalServerError)
+			return
+		}
+		policies = append(policies, policy)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(policies)
+}
+
+// UpdatePolicy sets the cancellation policy of a membership tier. Only fleet managers can change policies.
+func UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	tier := mux.Vars(r)["membership_tier"]
+
+	var request struct {
+		UserID int `json:"user_id"`
+		Policy
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	request.MembershipTier = tier
+	if err := request.Policy.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid policy: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	isManager, err := staff.IsFleetManager(request.UserID)
+	if err != nil {
+		log.Println("Error checking fleet manager role:", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return
+	}
+	if !isManager {
+		http.Error(w, "Only fleet managers can change cancellation policies", http.StatusForbidden)
+		return
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO CancellationPolicies (membership_tier, free_cancellation_hours, late_fee_percent, no_show_fee_percent) VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE free_cancellation_hours = VALUES(free_cancellation_hours), late_fee_percent = VALUES(late_fee_percent),
+            no_show_fee_percent = VALUES(no_show_fee_percent)`,
+		request.MembershipTier, request.FreeCancellationHours, request.LateFeePercent, request.NoShowFeePercent)
+	if err != nil {
+		log.Println("Error saving cancellation policy:", err)
+		http.Error(w, "Error saving cancellation policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Cancellation policy updated successfully",
+		"policy":  request.Policy,
+	})
+}
@@ -0,0 +1,105 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{MembershipTier: "Basic", FreeCancellationHours: 24, LateFeePercent: 50, NoShowFeePercent: 100}
+
+func TestEvaluate(t *testing.T) {
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	withFee := func(percent float64) Policy {
+		policy := testPolicy
+		policy.LateFeePercent = percent
+		return policy
+	}
+	noFreePeriod := testPolicy
+	noFreePeriod.FreeCancellationHours = 0
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		at         time.Time
+		amountPaid float64
+		wantRule   string
+		wantFee    float64
+		wantRefund float64
+		wantHours  float64
+	}{
+		{"well before the free period ends", testPolicy, start.Add(-72 * time.Hour), 120, RuleFree, 0, 120, 72},
+		{"exactly at the free cancellation boundary", testPolicy, start.Add(-24 * time.Hour), 120, RuleFree, 0, 120, 24},
+		{"just after the free cancellation boundary", testPolicy, start.Add(-24*time.Hour + time.Second), 120, RuleLate, 60, 60, 24},
+		{"late", testPolicy, start.Add(-2 * time.Hour), 120, RuleLate, 60, 60, 2},
+		{"late fee rounds half a cent up", testPolicy, start.Add(-time.Hour), 33.35, RuleLate, 16.68, 16.67, 1},
+		{"late fee rounds down", withFee(25), start.Add(-time.Hour), 10.01, RuleLate, 2.5, 7.51, 1},
+		{"late fee rounds up", withFee(15), start.Add(-time.Hour), 99.99, RuleLate, 15, 84.99, 1},
+		{"no late fee", withFee(0), start.Add(-time.Hour), 80, RuleLate, 0, 80, 1},
+		{"without a free period", noFreePeriod, start.Add(-time.Minute), 80, RuleFree, 0, 80, 0.02},
+		{"unpaid", testPolicy, start.Add(-time.Hour), 0, RuleLate, 0, 0, 1},
+		{"at the start time", testPolicy, start, 120, RuleAfterStart, 120, 0, 0},
+		{"after the start time", testPolicy, start.Add(90 * time.Minute), 120, RuleAfterStart, 120, 0, -1.5},
+		{"after the start time without a free period", noFreePeriod, start.Add(time.Hour), 80, RuleAfterStart, 80, 0, -1},
+	}
+	for _, test := range tests {
+		outcome := Evaluate(test.policy, start, test.at, test.amountPaid)
+		if outcome.Rule != test.wantRule || outcome.Fee != test.wantFee || outcome.Refund != test.wantRefund {
+			t.Errorf("%s: got rule %s, fee %.2f, refund %.2f, want %s, %.2f and %.2f",
+				test.name, outcome.Rule, outcome.Fee, outcome.Refund, test.wantRule, test.wantFee, test.wantRefund)
+		}
+		if outcome.HoursBeforeStart != test.wantHours {
+			t.Errorf("%s: got %.2f hours before start, want %.2f", test.name, outcome.HoursBeforeStart, test.wantHours)
+		}
+		if outcome.AmountPaid != test.amountPaid || outcome.Policy != test.policy {
+			t.Errorf("%s: outcome does not carry the amount paid and policy: %+v", test.name, outcome)
+		}
+	}
+}
+
+func TestEvaluateNoShow(t *testing.T) {
+	withFee := func(percent float64) Policy {
+		policy := testPolicy
+		policy.NoShowFeePercent = percent
+		return policy
+	}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		amountPaid float64
+		wantFee    float64
+		wantRefund float64
+	}{
+		{"full fee", testPolicy, 120, 120, 0},
+		{"half fee rounds half a cent up", withFee(50), 33.35, 16.68, 16.67},
+		{"fee rounds down", withFee(25), 10.01, 2.5, 7.51},
+		{"no fee", withFee(0), 80, 0, 80},
+		{"unpaid", testPolicy, 0, 0, 0},
+	}
+	for _, test := range tests {
+		outcome := EvaluateNoShow(test.policy, test.amountPaid)
+		if outcome.Rule != RuleNoShow || outcome.Fee != test.wantFee || outcome.Refund != test.wantRefund {
+			t.Errorf("%s: got rule %s, fee %.2f, refund %.2f, want %s, %.2f and %.2f",
+				test.name, outcome.Rule, outcome.Fee, outcome.Refund, RuleNoShow, test.wantFee, test.wantRefund)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		valid  bool
+	}{
+		{testPolicy, true},
+		{Policy{MembershipTier: "VIP", FreeCancellationHours: 0, LateFeePercent: 100, NoShowFeePercent: 0}, true},
+		{Policy{MembershipTier: "Gold", FreeCancellationHours: 24, LateFeePercent: 50, NoShowFeePercent: 100}, false},
+		{Policy{MembershipTier: "Basic", FreeCancellationHours: -1, LateFeePercent: 50, NoShowFeePercent: 100}, false},
+		{Policy{MembershipTier: "Basic", FreeCancellationHours: 24, LateFeePercent: 101, NoShowFeePercent: 100}, false},
+		{Policy{MembershipTier: "Basic", FreeCancellationHours: 24, LateFeePercent: 50, NoShowFeePercent: -5}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.validate(); (err == nil) != test.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", test.policy, err, test.valid)
+		}
+	}
+}
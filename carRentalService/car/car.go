@@ -1,11 +1,17 @@
 package car
 
 import (
+	"carRentalService/battery"
+	"carRentalService/geo"
+	"carRentalService/lifecycle"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -35,11 +41,72 @@ type Vehicle struct {
 	LicensePlate       string  `json:"license_plate"`
 	AvailabilityStatus string  `json:"availability_status"`
 	HourlyRate         float64 `json:"hourly_rate"`
+	VehicleClass       string  `json:"vehicle_class"`
+	StationID          int     `json:"station_id"`
+	StationName        string  `json:"station_name"`
+	StationAddress     string  `json:"station_address"`
+	Latitude           float64 `json:"latitude"`
+	Longitude          float64 `json:"longitude"`
+	CurrentCharge      float64 `json:"current_charge"`
+	EstimatedRangeKm   float64 `json:"estimated_range_km"`
+	ExpectedCharge     float64 `json:"expected_charge_at_pickup"`
+	ExpectedRangeKm    float64 `json:"expected_range_at_pickup_km"`
+	MaxRangeKm         float64 `json:"max_range_km"`
+	OdometerKm         float64 `json:"odometer_km"`
+	battery            battery.Status
+}
+
+// NearbyVehicle is a vehicle together with its distance from the searched location
+type NearbyVehicle struct {
+	Vehicle
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Default search radius in kilometres when none is given for nearby vehicles
+const defaultNearbyRadiusKm = 5.0
+
+// Columns selected for a vehicle listing, shared by the listing queries
+const vehicleQuery = `
+        SELECT v.vehicle_id, v.vehicle_name, v.license_plate, v.availability_status, v.hourly_rate, v.vehicle_class,
+               s.station_id, s.station_name, s.address, s.latitude, s.longitude,
+               v.battery_level, v.battery_capacity_kwh, v.charge_rate_kw, v.max_range_km, v.odometer_km
+        FROM Vehicles v
+        JOIN Stations s ON v.station_id = s.station_id`
+
+// scanVehicle scans a row selected with vehicleQuery into a vehicle
+func scanVehicle(rows *sql.Rows, vehicle *Vehicle) error {
+	return rows.Scan(&vehicle.VehicleID, &vehicle.VehicleName, &vehicle.LicensePlate, &vehicle.AvailabilityStatus, &vehicle.HourlyRate, &vehicle.VehicleClass,
+		&vehicle.StationID, &vehicle.StationName, &vehicle.StationAddress, &vehicle.Latitude, &vehicle.Longitude,
+		&vehicle.battery.ChargePercent, &vehicle.battery.CapacityKWh, &vehicle.battery.ChargeRateKW, &vehicle.battery.MaxRangeKm, &vehicle.OdometerKm)
+}
+
+// setChargeEstimates fills in the current and expected charge of a vehicle for a pick-up time
+func (vehicle *Vehicle) setChargeEstimates(pickupTime time.Time) {
+	vehicle.CurrentCharge = vehicle.battery.ChargePercent
+	vehicle.MaxRangeKm = vehicle.battery.MaxRangeKm
+	vehicle.EstimatedRangeKm = vehicle.battery.RangeKm(vehicle.CurrentCharge)
+	vehicle.ExpectedCharge = vehicle.battery.ExpectedChargeAt(time.Now(), pickupTime)
+	vehicle.ExpectedRangeKm = vehicle.battery.RangeKm(vehicle.ExpectedCharge)
+}
+
+// parsePickupTime reads the optional pickup_time query parameter, defaulting to now
+func parsePickupTime(r *http.Request) (time.Time, error) {
+	pickupParam := r.URL.Query().Get("pickup_time")
+	if pickupParam == "" {
+		return time.Now(), nil
+	}
+	return time.Parse(time.RFC3339, pickupParam)
 }
 
 // Get all vehicles, regardless of availability status
 func GetAllVehicles(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT vehicle_id, vehicle_name, license_plate, availability_status, hourly_rate FROM Vehicles")
+	pickupTime, err := parsePickupTime(r)
+	if err != nil {
+		http.Error(w, "Invalid pickup_time format", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(vehicleQuery)
 	if err != nil {
 		http.Error(w, "Error fetching vehicles", http.StatusInternalServerError)
 		return
@@ -49,10 +116,11 @@ func GetAllVehicles(w http.ResponseWriter, r *http.Request) {
 	var vehicles []Vehicle
 	for rows.Next() {
 		var vehicle Vehicle
-		if err := rows.Scan(&vehicle.VehicleID, &vehicle.VehicleName, &vehicle.LicensePlate, &vehicle.AvailabilityStatus, &vehicle.HourlyRate); err != nil {
+		if err := scanVehicle(rows, &vehicle); err != nil {
 			http.Error(w, "Error scanning vehicle data", http.StatusInternalServerError)
 			return
 		}
+		vehicle.setChargeEstimates(pickupTime)
 		vehicles = append(vehicles, vehicle)
 	}
 
@@ -60,3 +128,71 @@ func GetAllVehicles(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(vehicles)
 }
+
+// GetNearbyVehicles retrieves bookable vehicles within a radius of a location, nearest first
+func GetNearbyVehicles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil {
+		http.Error(w, "Invalid or missing lat", http.StatusBadRequest)
+		return
+	}
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil {
+		http.Error(w, "Invalid or missing lng", http.StatusBadRequest)
+		return
+	}
+	if !geo.ValidCoordinates(lat, lng) {
+		http.Error(w, "Coordinates out of range", http.StatusBadRequest)
+		return
+	}
+
+	radius := defaultNearbyRadiusKm
+	if radiusParam := query.Get("radius"); radiusParam != "" {
+		radius, err = strconv.ParseFloat(radiusParam, 64)
+		if err != nil || radius <= 0 {
+			http.Error(w, "Invalid radius", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pickupTime, err := parsePickupTime(r)
+	if err != nil {
+		http.Error(w, "Invalid pickup_time format", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(vehicleQuery + " WHERE v.availability_status IN (" + lifecycle.BookableVehicleStatuses + ")")
+	if err != nil {
+		log.Println("Error fetching nearby vehicles:", err)
+		http.Error(w, "Error fetching vehicles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Fleet size is small, so distances are computed here rather than with a spatial index
+	vehicles := []NearbyVehicle{}
+	for rows.Next() {
+		var vehicle NearbyVehicle
+		if err := scanVehicle(rows, &vehicle.Vehicle); err != nil {
+			log.Println("Error scanning vehicle data:", err)
+			http.Error(w, "Error scanning vehicle data", http.StatusInternalServerError)
+			return
+		}
+		vehicle.setChargeEstimates(pickupTime)
+
+		vehicle.DistanceKm = geo.HaversineKm(lat, lng, vehicle.Latitude, vehicle.Longitude)
+		if vehicle.DistanceKm <= radius {
+			vehicles = append(vehicles, vehicle)
+		}
+	}
+
+	sort.Slice(vehicles, func(i, j int) bool {
+		return vehicles[i].DistanceKm < vehicles[j].DistanceKm
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vehicles)
+}
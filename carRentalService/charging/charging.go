@@ -0,0 +1,429 @@
+package charging
+
+import (
+	"carRentalService/billing"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for charging service
+var db *sql.DB
+
+// Initialize the database connection for charging service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Charging tables connected successfully.")
+}
+
+// Share of a connector's rated power a simulated charger actually delivers to the battery
+const simulatedChargerEfficiency = 0.9
+
+// Connector struct represents a charging connector at a charging station
+type Connector struct {
+	ConnectorID   int     `json:"connector_id"`
+	ConnectorType string  `json:"connector_type"`
+	PowerKW       float64 `json:"power_kw"`
+	PricePerKWh   float64 `json:"price_per_kwh"`
+	Status        string  `json:"status"`
+}
+
+// Station struct represents a charging station and its connectors
+type Station struct {
+	ChargingStationID int         `json:"charging_station_id"`
+	StationName       string      `json:"station_name"`
+	Address           string      `json:"address"`
+	Latitude          float64     `json:"latitude"`
+	Longitude         float64     `json:"longitude"`
+	Connectors        []Connector `json:"connectors"`
+}
+
+// Session struct represents a charging session during a reservation
+type Session struct {
+	SessionID     int        `json:"session_id"`
+	ReservationID int        `json:"reservation_id"`
+	VehicleID     int        `json:"vehicle_id"`
+	ConnectorID   int        `json:"connector_id"`
+	Simulated     bool       `json:"simulated"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	StartCharge   float64    `json:"start_charge"`
+	EndCharge     *float64   `json:"end_charge,omitempty"`
+	EnergyKWh     float64    `json:"energy_kwh"`
+	Cost          float64    `json:"cost"`
+	Billed        bool       `json:"billed"`
+}
+
+// GetChargingStations retrieves every charging station with its connectors
+func GetChargingStations(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+        SELECT cs.charging_station_id, cs.station_name, cs.address, cs.latitude, cs.longitude,
+               c.connector_id, c.connector_type, c.power_kw, c.price_per_kwh, c.status
+        FROM ChargingStations cs
+        JOIN ChargingConnectors c ON c.charging_station_id = cs.charging_station_id
+        ORDER BY cs.charging_station_id, c.connector_id`)
+	if err != nil {
+		log.Println("Error fetching charging stations:", err)
+		http.Error(w, "Error fetching charging stations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	stations := []Station{}
+	for rows.Next() {
+		var station Station
+		var connector Connector
+		if err := rows.Scan(&station.ChargingStationID, &station.StationName, &station.Address, &station.Latitude, &station.Longitude,
+			&connector.ConnectorID, &connector.ConnectorType, &connector.PowerKW, &connector.PricePerKWh, &connector.Status); err != nil {
+			log.Println("Error scanning charging station:", err)
+			http.Error(w, "Error fetching charging stations", http.StatusInternalServerError)
+			return
+		}
+
+		// Rows are ordered by station, so connectors of the same station are adjacent
+		if len(stations) == 0 || stations[len(stations)-1].ChargingStationID != station.ChargingStationID {
+			stations = append(stations, station)
+		}
+		last := &stations[len(stations)-1]
+		last.Connectors = append(last.Connectors, connector)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stations)
+}
+
+// StartSession starts charging a rented vehicle at a connector while the renter has picked it up
+func StartSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID        int  `json:"user_id"`
+		ReservationID int  `json:"reservation_id"`
+		ConnectorID   int  `json:"connector_id"`
+		Simulated     bool `json:"simulated"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Error decoding charging session input:", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if request.UserID == 0 || request.ReservationID == 0 || request.ConnectorID == 0 {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting charging transaction:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Charging is only possible while the renter has the vehicle
+	var userID, vehicleID int
+	var startCharge float64
+	var vehicleConnector string
+	err = tx.QueryRow(`
+        SELECT r.user_id, r.vehicle_id, v.battery_level, v.connector_type
+        FROM Reservations r
+        JOIN Vehicles v ON r.vehicle_id = v.vehicle_id
+        WHERE r.reservation_id = ? AND r.status = 'InProgress'
+        FOR UPDATE`, request.ReservationID).Scan(&userID, &vehicleID, &startCharge, &vehicleConnector)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found or vehicle not picked up", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation for charging:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+	if userID != request.UserID {
+		http.Error(w, "Only the renter can charge this reservation's vehicle", http.StatusForbidden)
+		return
+	}
+	var alreadyCharging bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM ChargingSessions WHERE vehicle_id = ? AND status = 'Active')", vehicleID).Scan(&alreadyCharging); err != nil {
+		log.Println("Error checking active charging sessions:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+	if alreadyCharging {
+		http.Error(w, "Vehicle is already charging", http.StatusConflict)
+		return
+	}
+
+	var connectorType, connectorStatus string
+	err = tx.QueryRow("SELECT connector_type, status FROM ChargingConnectors WHERE connector_id = ? FOR UPDATE", request.ConnectorID).
+		Scan(&connectorType, &connectorStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Connector not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching connector:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+	if connectorStatus != "Available" {
+		http.Error(w, "Connector is not available", http.StatusConflict)
+		return
+	}
+	if connectorType != vehicleConnector {
+		http.Error(w, fmt.Sprintf("Vehicle needs a %s connector", vehicleConnector), http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO ChargingSessions (reservation_id, vehicle_id, connector_id, simulated, start_charge) VALUES (?, ?, ?, ?, ?)",
+		request.ReservationID, vehicleID, request.ConnectorID, request.Simulated, startCharge)
+	if err != nil {
+		log.Println("Error inserting charging session:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+	sessionID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("UPDATE ChargingConnectors SET status = 'Occupied' WHERE connector_id = ?", request.ConnectorID); err != nil {
+		log.Println("Error occupying connector:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing charging session:", err)
+		http.Error(w, "Error starting charging session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Charging session started",
+		"session_id": sessionID,
+	})
+}
+
+// StopSession ends a charging session, records the energy delivered and bills it to the
+// reservation. Real chargers report the metered energy; simulated sessions compute it from
+// the connector power and elapsed time.
+func StopSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+
+	var request struct {
+		EnergyKWh *float64 `json:"energy_kwh"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting charging transaction:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var session Session
+	var powerKW, pricePerKWh, capacityKWh float64
+	err = tx.QueryRow(`
+        SELECT s.session_id, s.reservation_id, s.vehicle_id, s.connector_id, s.simulated, s.started_at, s.start_charge,
+               c.power_kw, c.price_per_kwh, v.battery_capacity_kwh
+        FROM ChargingSessions s
+        JOIN ChargingConnectors c ON s.connector_id = c.connector_id
+        JOIN Vehicles v ON s.vehicle_id = v.vehicle_id
+        WHERE s.session_id = ? AND s.status = 'Active'
+        FOR UPDATE`, sessionID).Scan(&session.SessionID, &session.ReservationID, &session.VehicleID, &session.ConnectorID, &session.Simulated,
+		&session.StartedAt, &session.StartCharge, &powerKW, &pricePerKWh, &capacityKWh)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Active charging session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching charging session:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	maxEnergy := capacityKWh * (100 - session.StartCharge) / 100
+	switch {
+	case request.EnergyKWh != nil:
+		if *request.EnergyKWh < 0 || *request.EnergyKWh > maxEnergy+0.5 {
+			http.Error(w, "Reported energy is outside the battery's capacity", http.StatusBadRequest)
+			return
+		}
+		session.EnergyKWh = *request.EnergyKWh
+	case session.Simulated:
+		session.EnergyKWh = simulatedEnergy(powerKW, now.Sub(session.StartedAt), maxEnergy)
+	default:
+		http.Error(w, "Metered energy_kwh is required to stop a non-simulated session", http.StatusBadRequest)
+		return
+	}
+	session.EnergyKWh = round(math.Min(session.EnergyKWh, maxEnergy), 3)
+	session.Cost = round(session.EnergyKWh*pricePerKWh, 2)
+	endCharge := round(math.Min(100, session.StartCharge+session.EnergyKWh/capacityKWh*100), 2)
+	session.EndCharge = &endCharge
+	session.EndedAt = &now
+	session.Status = "Completed"
+
+	_, err = tx.Exec("UPDATE ChargingSessions SET status = 'Completed', ended_at = ?, end_charge = ?, energy_kwh = ?, cost = ? WHERE session_id = ?",
+		now, endCharge, session.EnergyKWh, session.Cost, session.SessionID)
+	if err != nil {
+		log.Println("Error completing charging session:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE ChargingConnectors SET status = 'Available' WHERE connector_id = ?", session.ConnectorID); err != nil {
+		log.Println("Error releasing connector:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE Vehicles SET battery_level = ? WHERE vehicle_id = ?", endCharge, session.VehicleID); err != nil {
+		log.Println("Error updating vehicle charge:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+
+	// Bill the energy to the reservation. The charge is queued with the session and sent once it
+	// is committed, and retried until the Payment Service accepts it.
+	billingRequestID := 0
+	if session.Cost > 0 {
+		description := fmt.Sprintf("Charging session #%d: %.3f kWh", session.SessionID, session.EnergyKWh)
+		billingRequestID, err = billing.QueueLineItem(tx, session.ReservationID, "Charging", description, session.Cost)
+		if err != nil {
+			log.Println("Error queueing charging session charge:", err)
+			http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec("UPDATE ChargingSessions SET billed = TRUE WHERE session_id = ?", session.SessionID); err != nil {
+			log.Println("Error marking charging session as billed:", err)
+			http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+			return
+		}
+		session.Billed = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing charging session:", err)
+		http.Error(w, "Error stopping charging session", http.StatusInternalServerError)
+		return
+	}
+
+	if billingRequestID != 0 {
+		if _, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error billing charging session %d, it will be retried: %v", session.SessionID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(session)
+}
+
+// simulatedEnergy computes the energy a simulated charger delivers over a duration
+func simulatedEnergy(powerKW float64, elapsed time.Duration, maxEnergy float64) float64 {
+	return math.Min(powerKW*simulatedChargerEfficiency*elapsed.Hours(), maxEnergy)
+}
+
+const sessionColumns = "session_id, reservation_id, vehicle_id, connector_id, simulated, status, started_at, ended_at, start_charge, end_charge, energy_kwh, cost, billed"
+
+func scanSession(scanner interface{ Scan(...interface{}) error }) (Session, error) {
+	var session Session
+	var endedAt sql.NullTime
+	var endCharge sql.NullFloat64
+	err := scanner.Scan(&session.SessionID, &session.ReservationID, &session.VehicleID, &session.ConnectorID, &session.Simulated, &session.Status,
+		&session.StartedAt, &endedAt, &session.StartCharge, &endCharge, &session.EnergyKWh, &session.Cost, &session.Billed)
+	if endedAt.Valid {
+		session.EndedAt = &endedAt.Time
+	}
+	if endCharge.Valid {
+		session.EndCharge = &endCharge.Float64
+	}
+	return session, err
+}
+
+// GetSession retrieves a charging session. Active simulated sessions report the energy delivered so far.
+func GetSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+
+	session, err := scanSession(db.QueryRow("SELECT "+sessionColumns+" FROM ChargingSessions WHERE session_id = ?", sessionID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Charging session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching charging session:", err)
+		http.Error(w, "Error fetching charging session", http.StatusInternalServerError)
+		return
+	}
+
+	if session.Status == "Active" && session.Simulated {
+		var powerKW, pricePerKWh, capacityKWh float64
+		err := db.QueryRow(`
+            SELECT c.power_kw, c.price_per_kwh, v.battery_capacity_kwh
+            FROM ChargingConnectors c, Vehicles v
+            WHERE c.connector_id = ? AND v.vehicle_id = ?`, session.ConnectorID, session.VehicleID).Scan(&powerKW, &pricePerKWh, &capacityKWh)
+		if err != nil {
+			log.Println("Error fetching charger details:", err)
+			http.Error(w, "Error fetching charging session", http.StatusInternalServerError)
+			return
+		}
+		maxEnergy := capacityKWh * (100 - session.StartCharge) / 100
+		session.EnergyKWh = round(simulatedEnergy(powerKW, time.Since(session.StartedAt), maxEnergy), 3)
+		session.Cost = round(session.EnergyKWh*pricePerKWh, 2)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(session)
+}
+
+// GetReservationSessions retrieves all charging sessions of a reservation
+func GetReservationSessions(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+sessionColumns+" FROM ChargingSessions WHERE reservation_id = ? ORDER BY started_at", reservationID)
+	if err != nil {
+		log.Printf("Error fetching charging sessions for reservation %d: %v", reservationID, err)
+		http.Error(w, "Error fetching charging sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			log.Println("Error scanning charging session:", err)
+			http.Error(w, "Error fetching charging sessions", http.StatusInternalServerError)
+			return
+		}
+		sessions = append(sessions, session)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,211 @@
+// Command telemetrysim generates realistic telemetry for the seeded fleet and posts it
+// to the Car Rental Service ingestion endpoint.
+//
+// Vehicles that are booked drive around their home station, using charge and adding
+// odometer distance; all other vehicles stay parked, locked and charging.
+//
+//	go run ./cmd/telemetrysim -interval 5s -duration 10m
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// vehicle holds the fields of the vehicle listing that the simulator needs
+type vehicle struct {
+	VehicleID          int     `json:"vehicle_id"`
+	AvailabilityStatus string  `json:"availability_status"`
+	Latitude           float64 `json:"latitude"`
+	Longitude          float64 `json:"longitude"`
+	CurrentCharge      float64 `json:"current_charge"`
+	MaxRangeKm         float64 `json:"max_range_km"`
+	OdometerKm         float64 `json:"odometer_km"`
+}
+
+// reading matches the payload accepted by POST /v1/telemetry
+type reading struct {
+	VehicleID     int       `json:"vehicle_id"`
+	RecordedAt    time.Time `json:"recorded_at"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	OdometerKm    float64   `json:"odometer_km"`
+	StateOfCharge float64   `json:"state_of_charge"`
+	SpeedKmh      float64   `json:"speed_kmh"`
+	IsLocked      bool      `json:"is_locked"`
+}
+
+// simulatedVehicle tracks the evolving state of one vehicle between ticks
+type simulatedVehicle struct {
+	vehicle
+	homeLat, homeLng float64
+	headingRad       float64
+	speedKmh         float64
+	driving          bool
+}
+
+// Simulation constants, chosen to resemble urban driving in Singapore
+const (
+	kmPerDegreeLat  = 111.32
+	maxDriftKm      = 15.0 // Drivers turn back towards home beyond this distance
+	chargePerHour   = 20.0 // Percent gained per hour while parked and plugged in
+	minDrivingSpeed = 20.0
+	maxDrivingSpeed = 80.0
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8081", "Car Rental Service base URL")
+	interval := flag.Duration("interval", 5*time.Second, "time between telemetry batches")
+	duration := flag.Duration("duration", 0, "how long to run (0 runs until stopped)")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+
+	fleet, err := loadFleet(*baseURL)
+	if err != nil {
+		log.Fatal("Error loading fleet: ", err)
+	}
+	if len(fleet) == 0 {
+		log.Fatal("No vehicles found to simulate")
+	}
+
+	vehicles := make([]*simulatedVehicle, 0, len(fleet))
+	for _, v := range fleet {
+		vehicles = append(vehicles, &simulatedVehicle{
+			vehicle:    v,
+			homeLat:    v.Latitude,
+			homeLng:    v.Longitude,
+			headingRad: rng.Float64() * 2 * math.Pi,
+			driving:    v.AvailabilityStatus == "InUse",
+		})
+	}
+	fmt.Printf("Simulating telemetry for %d vehicles every %s\n", len(vehicles), *interval)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	var deadline <-chan time.Time
+	if *duration > 0 {
+		deadline = time.After(*duration)
+	}
+
+	for {
+		select {
+		case <-deadline:
+			fmt.Println("Simulation finished")
+			return
+		case now := <-ticker.C:
+			batch := make([]reading, 0, len(vehicles))
+			for _, v := range vehicles {
+				v.step(rng, interval.Hours())
+				batch = append(batch, v.reading(now))
+			}
+			if err := postBatch(*baseURL, batch); err != nil {
+				log.Println("Error posting telemetry batch:", err)
+			}
+		}
+	}
+}
+
+// loadFleet fetches the vehicle listing from the Car Rental Service
+func loadFleet(baseURL string) ([]vehicle, error) {
+	resp, err := http.Get(baseURL + "/v1/vehicles")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var fleet []vehicle
+	err = json.NewDecoder(resp.Body).Decode(&fleet)
+	return fleet, err
+}
+
+// step advances a vehicle's state by the given number of hours
+func (v *simulatedVehicle) step(rng *rand.Rand, hours float64) {
+	if !v.driving {
+		v.speedKmh = 0
+		v.CurrentCharge = math.Min(100, v.CurrentCharge+chargePerHour*hours)
+		return
+	}
+
+	// Stop at traffic lights now and then, otherwise drift the speed and heading
+	if rng.Float64() < 0.15 {
+		v.speedKmh = 0
+	} else {
+		v.speedKmh = clamp(v.speedKmh+rng.NormFloat64()*10, minDrivingSpeed, maxDrivingSpeed)
+	}
+	v.headingRad += rng.NormFloat64() * 0.3
+
+	// Head back towards home when straying too far
+	northKm := (v.Latitude - v.homeLat) * kmPerDegreeLat
+	eastKm := (v.Longitude - v.homeLng) * kmPerDegreeLat * math.Cos(v.homeLat*math.Pi/180)
+	if math.Hypot(northKm, eastKm) > maxDriftKm {
+		v.headingRad = math.Atan2(-eastKm, -northKm)
+	}
+
+	distanceKm := v.speedKmh * hours
+	v.Latitude += distanceKm * math.Cos(v.headingRad) / kmPerDegreeLat
+	v.Longitude += distanceKm * math.Sin(v.headingRad) / (kmPerDegreeLat * math.Cos(v.Latitude*math.Pi/180))
+	v.OdometerKm += distanceKm
+	if v.MaxRangeKm > 0 {
+		v.CurrentCharge = math.Max(0, v.CurrentCharge-distanceKm/v.MaxRangeKm*100)
+	}
+
+	// A flat battery forces the driver to park and charge
+	if v.CurrentCharge < 5 {
+		v.driving = false
+	}
+}
+
+// reading captures the vehicle's current state as a telemetry sample
+func (v *simulatedVehicle) reading(at time.Time) reading {
+	return reading{
+		VehicleID:     v.VehicleID,
+		RecordedAt:    at.UTC(),
+		Latitude:      round(v.Latitude, 6),
+		Longitude:     round(v.Longitude, 6),
+		OdometerKm:    round(v.OdometerKm, 1),
+		StateOfCharge: round(v.CurrentCharge, 2),
+		SpeedKmh:      round(v.speedKmh, 1),
+		IsLocked:      !v.driving,
+	}
+}
+
+// postBatch sends a batch of readings to the ingestion endpoint
+func postBatch(baseURL string, batch []reading) error {
+	body, err := json.Marshal(map[string]interface{}{"readings": batch})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(baseURL+"/v1/telemetry", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func clamp(value, lower, upper float64) float64 {
+	return math.Max(lower, math.Min(upper, value))
+}
+
+func round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"carRentalService/telemetry"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Adapter delivers commands to vehicles. Implementations wrap a telematics provider;
+// SimulatedAdapter stands in for one during development.
+type Adapter interface {
+	// Deliver sends the command and returns once the vehicle has received it
+	Deliver(ctx context.Context, cmd Command) error
+	// AwaitAcknowledgement blocks until the vehicle confirms it carried out the command,
+	// returning a short result such as the reported location
+	AwaitAcknowledgement(ctx context.Context, cmd Command) (string, error)
+}
+
+// SimulatedAdapter pretends to talk to vehicles, with random latency and occasional failures
+type SimulatedAdapter struct {
+	FailureRate float64       // Chance between 0 and 1 that the vehicle rejects a command
+	MaxLatency  time.Duration // Commands are acknowledged immediately when this is 0 or less
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewSimulatedAdapter creates a simulated adapter with realistic latency and a small failure rate
+func NewSimulatedAdapter() *SimulatedAdapter {
+	return &SimulatedAdapter{
+		FailureRate: 0.05,
+		MaxLatency:  2 * time.Second,
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Deliver waits a random network delay before the simulated vehicle receives the command
+func (a *SimulatedAdapter) Deliver(ctx context.Context, cmd Command) error {
+	return a.wait(ctx)
+}
+
+// AwaitAcknowledgement waits for the simulated vehicle to carry out the command
+func (a *SimulatedAdapter) AwaitAcknowledgement(ctx context.Context, cmd Command) (string, error) {
+	if err := a.wait(ctx); err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	failed := a.rng.Float64() < a.FailureRate
+	a.mu.Unlock()
+	if failed {
+		return "", errors.New("vehicle rejected the command")
+	}
+
+	// The simulated vehicle reports its position from the latest telemetry
+	if cmd.CommandType == "Locate" {
+		reading, err := telemetry.LatestReading(cmd.VehicleID)
+		if err != nil {
+			return "", fmt.Errorf("vehicle position unavailable: %v", err)
+		}
+		return fmt.Sprintf("%.6f,%.6f", reading.Latitude, reading.Longitude), nil
+	}
+	return fmt.Sprintf("%s completed", cmd.CommandType), nil
+}
+
+// wait sleeps for a random latency, returning early if the context ends
+func (a *SimulatedAdapter) wait(ctx context.Context) error {
+	if a.MaxLatency <= 0 {
+		return ctx.Err()
+	}
+	a.mu.Lock()
+	latency := time.Duration(a.rng.Int63n(int64(a.MaxLatency)))
+	a.mu.Unlock()
+
+	select {
+	case <-time.After(latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
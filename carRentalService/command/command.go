@@ -0,0 +1,277 @@
+package command
+
+import (
+	"carRentalService/staff"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for vehicle command service
+var db *sql.DB
+
+// Initialize the database connection for vehicle command service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Vehicle Commands table connected successfully.")
+}
+
+// Adapter used to reach vehicles; replace with SetAdapter for a real telematics provider
+var adapter Adapter = NewSimulatedAdapter()
+
+// SetAdapter changes the adapter used to deliver commands to vehicles
+func SetAdapter(a Adapter) {
+	adapter = a
+}
+
+// Default time a command may take from queueing to acknowledgement
+const defaultCommandTimeout = 30 * time.Second
+
+// commandTimeout returns the command timeout, configurable in seconds with VEHICLE_COMMAND_TIMEOUT_SECONDS
+func commandTimeout() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("VEHICLE_COMMAND_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultCommandTimeout
+}
+
+// Commands renters may send during their reservation; the rest are for fleet staff only
+var commandTypes = map[string]bool{
+	"Lock":       true,
+	"Unlock":     true,
+	"Locate":     true,
+	"Honk":       true,
+	"Immobilise": false,
+	"Mobilise":   false,
+}
+
+// Command struct represents a remote command sent to a vehicle
+type Command struct {
+	CommandID      int        `json:"command_id"`
+	VehicleID      int        `json:"vehicle_id"`
+	UserID         int        `json:"user_id"`
+	CommandType    string     `json:"command_type"`
+	Status         string     `json:"status"`
+	Result         string     `json:"result,omitempty"`
+	FailureReason  string     `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+}
+
+// SendCommand queues a command for a vehicle. Renters may command the vehicle only during
+// their active reservation window; fleet staff may command any vehicle.
+func SendCommand(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicle_id"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		UserID      int    `json:"user_id"`
+		CommandType string `json:"command_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Error decoding command input:", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	renterAllowed, validType := commandTypes[request.CommandType]
+	if request.UserID == 0 || !validType {
+		http.Error(w, "Missing user_id or invalid command_type", http.StatusBadRequest)
+		return
+	}
+
+	var vehicleExists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Vehicles WHERE vehicle_id = ?)", vehicleID).Scan(&vehicleExists); err != nil {
+		log.Println("Error checking vehicle:", err)
+		http.Error(w, "Error sending command", http.StatusInternalServerError)
+		return
+	}
+	if !vehicleExists {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+
+	allowed, err := authorize(request.UserID, vehicleID, renterAllowed)
+	if err != nil {
+		log.Println("Error authorising vehicle command:", err)
+		http.Error(w, "Error sending command", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Commands are only allowed for the renter during an active reservation, or for fleet staff", http.StatusForbidden)
+		return
+	}
+
+	cmd := Command{
+		VehicleID:   vehicleID,
+		UserID:      request.UserID,
+		CommandType: request.CommandType,
+		Status:      "Queued",
+		CreatedAt:   time.Now(),
+	}
+	cmd.ExpiresAt = cmd.CreatedAt.Add(commandTimeout())
+
+	result, err := db.Exec("INSERT INTO VehicleCommands (vehicle_id, user_id, command_type, status, created_at, expires_at) VALUES (?, ?, ?, 'Queued', ?, ?)",
+		cmd.VehicleID, cmd.UserID, cmd.CommandType, cmd.CreatedAt, cmd.ExpiresAt)
+	if err != nil {
+		log.Println("Error queueing vehicle command:", err)
+		http.Error(w, "Error sending command", http.StatusInternalServerError)
+		return
+	}
+	commandID, _ := result.LastInsertId()
+	cmd.CommandID = int(commandID)
+
+	go execute(cmd)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(cmd)
+}
+
+// authorize checks whether a user may command a vehicle right now
+func authorize(userID int, vehicleID int, renterAllowed bool) (bool, error) {
+	isStaff, err := staff.IsFleetStaff(userID)
+	if err != nil || isStaff {
+		return isStaff, err
+	}
+	if !renterAllowed {
+		return false, nil
+	}
+
+	var renting bool
+	err = db.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM Reservations
+            WHERE user_id = ? AND vehicle_id = ?
+              AND (status = 'InProgress' OR (status = 'Confirmed' AND start_time <= NOW() AND end_time >= NOW()))
+        )`, userID, vehicleID).Scan(&renting)
+	return renting, err
+}
+
+// execute delivers a command through the adapter and tracks its status until it is
+// acknowledged, fails or times out
+func execute(cmd Command) {
+	ctx, cancel := context.WithDeadline(context.Background(), cmd.ExpiresAt)
+	defer cancel()
+
+	if err := adapter.Deliver(ctx, cmd); err != nil {
+		markFailed(cmd.CommandID, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE VehicleCommands SET status = 'Delivered', delivered_at = NOW() WHERE command_id = ?", cmd.CommandID); err != nil {
+		log.Printf("Error marking command %d delivered: %v", cmd.CommandID, err)
+	}
+
+	result, err := adapter.AwaitAcknowledgement(ctx, cmd)
+	if err != nil {
+		markFailed(cmd.CommandID, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE VehicleCommands SET status = 'Acknowledged', acknowledged_at = NOW(), result = ? WHERE command_id = ?", result, cmd.CommandID); err != nil {
+		log.Printf("Error marking command %d acknowledged: %v", cmd.CommandID, err)
+	}
+}
+
+// markFailed records why a command failed, reporting deadline overruns as timeouts
+func markFailed(commandID int, err error) {
+	reason := err.Error()
+	if err == context.DeadlineExceeded {
+		reason = "Timed out waiting for the vehicle"
+	}
+	if _, dbErr := db.Exec("UPDATE VehicleCommands SET status = 'Failed', failure_reason = ? WHERE command_id = ?", reason, commandID); dbErr != nil {
+		log.Printf("Error marking command %d failed: %v", commandID, dbErr)
+	}
+}
+
+// FailInterruptedCommands fails commands left in progress by a previous run of the service
+func FailInterruptedCommands() {
+	_, err := db.Exec("UPDATE VehicleCommands SET status = 'Failed', failure_reason = 'Interrupted by service restart' WHERE status IN ('Queued', 'Delivered')")
+	if err != nil {
+		log.Println("Error failing interrupted vehicle commands:", err)
+	}
+}
+
+const commandColumns = "command_id, vehicle_id, user_id, command_type, status, result, failure_reason, created_at, delivered_at, acknowledged_at, expires_at"
+
+func scanCommand(scanner interface{ Scan(...interface{}) error }) (Command, error) {
+	var cmd Command
+	var result, failureReason sql.NullString
+	var deliveredAt, acknowledgedAt sql.NullTime
+	err := scanner.Scan(&cmd.CommandID, &cmd.VehicleID, &cmd.UserID, &cmd.CommandType, &cmd.Status, &result, &failureReason,
+		&cmd.CreatedAt, &deliveredAt, &acknowledgedAt, &cmd.ExpiresAt)
+	cmd.Result = result.String
+	cmd.FailureReason = failureReason.String
+	if deliveredAt.Valid {
+		cmd.DeliveredAt = &deliveredAt.Time
+	}
+	if acknowledgedAt.Valid {
+		cmd.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	return cmd, err
+}
+
+// GetCommand retrieves the status of a vehicle command
+func GetCommand(w http.ResponseWriter, r *http.Request) {
+	commandID := mux.Vars(r)["command_id"]
+
+	cmd, err := scanCommand(db.QueryRow("SELECT "+commandColumns+" FROM VehicleCommands WHERE command_id = ?", commandID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Command not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching vehicle command:", err)
+		http.Error(w, "Error fetching command", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cmd)
+}
+
+// GetVehicleCommands retrieves the command history of a vehicle, newest first
+func GetVehicleCommands(w http.ResponseWriter, r *http.Request) {
+	vehicleID := mux.Vars(r)["vehicle_id"]
+
+	rows, err := db.Query("SELECT "+commandColumns+" FROM VehicleCommands WHERE vehicle_id = ? ORDER BY created_at DESC LIMIT 100", vehicleID)
+	if err != nil {
+		log.Printf("Error fetching commands for vehicle %s: %v", vehicleID, err)
+		http.Error(w, "Error fetching commands", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	commands := []Command{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			log.Println("Error scanning vehicle command:", err)
+			http.Error(w, "Error fetching commands", http.StatusInternalServerError)
+			return
+		}
+		commands = append(commands, cmd)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(commands)
+}
@@ -0,0 +1,510 @@
+package condition
+
+import (
+	"carRentalService/staff"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for condition report service
+var db *sql.DB
+
+// Initialize the database connection for condition report service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Condition Reports table connected successfully.")
+}
+
+// Limits for uploaded photo evidence
+const (
+	maxPhotoSize       = 10 << 20
+	maxPhotosPerUpload = 10
+)
+
+// UploadDir returns the directory where photo evidence is stored, configured with UPLOAD_DIR
+func UploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// Panels and interior items that can appear on a condition checklist
+var checklistItems = map[string]bool{
+	"FrontBumper":    true,
+	"RearBumper":     true,
+	"Bonnet":         true,
+	"Roof":           true,
+	"Boot":           true,
+	"FrontLeftDoor":  true,
+	"FrontRightDoor": true,
+	"RearLeftDoor":   true,
+	"RearRightDoor":  true,
+	"Windscreen":     true,
+	"Mirrors":        true,
+	"Wheels":         true,
+	"Seats":          true,
+	"Dashboard":      true,
+	"Carpets":        true,
+	"ChargingCable":  true,
+}
+
+// Valid damage severities, matching the DamageRecords table
+var severities = map[string]bool{"Minor": true, "Moderate": true, "Severe": true}
+
+// Photo types accepted as evidence, mapped to their file extension
+var photoTypes = map[string]string{"image/jpeg": ".jpg", "image/png": ".png"}
+
+// ChecklistItem is the condition of one panel or interior item
+type ChecklistItem struct {
+	Item        string `json:"item"`
+	Condition   string `json:"condition"` // "OK" or "Damaged"
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Photo is a piece of photo evidence attached to a condition report
+type Photo struct {
+	PhotoID    int       `json:"photo_id"`
+	URL        string    `json:"url"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// Report struct represents a vehicle condition report
+type Report struct {
+	ReportID      int             `json:"report_id"`
+	VehicleID     int             `json:"vehicle_id"`
+	ReservationID *int            `json:"reservation_id,omitempty"`
+	UserID        int             `json:"user_id"`
+	ReportType    string          `json:"report_type"`
+	Checklist     []ChecklistItem `json:"checklist"`
+	Notes         string          `json:"notes"`
+	Photos        []Photo         `json:"photos"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// Damage struct represents a damage record found on a vehicle
+type Damage struct {
+	DamageID      int        `json:"damage_id"`
+	VehicleID     int        `json:"vehicle_id"`
+	ReportID      int        `json:"report_id"`
+	ReservationID *int       `json:"reservation_id,omitempty"`
+	Item          string     `json:"item"`
+	Severity      string     `json:"severity"`
+	Description   string     `json:"description"`
+	Status        string     `json:"status"`
+	RepairedAt    *time.Time `json:"repaired_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CreateReport files a condition report. Renters file PickUp and Return reports for their
+// own reservation; staff file Inspection reports.
+func CreateReport(w http.ResponseWriter, r *http.Request) {
+	var report Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		log.Println("Error decoding condition report input:", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if report.VehicleID == 0 || report.UserID == 0 || len(report.Checklist) == 0 {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	for _, item := range report.Checklist {
+		if !checklistItems[item.Item] {
+			http.Error(w, fmt.Sprintf("Unknown checklist item: %s", item.Item), http.StatusBadRequest)
+			return
+		}
+		if item.Condition != "OK" && item.Condition != "Damaged" {
+			http.Error(w, fmt.Sprintf("Condition of %s must be OK or Damaged", item.Item), http.StatusBadRequest)
+			return
+		}
+		if item.Condition == "Damaged" && !severities[item.Severity] {
+			http.Error(w, fmt.Sprintf("Damage on %s needs a severity of Minor, Moderate or Severe", item.Item), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch report.ReportType {
+	case "PickUp", "Return":
+		if report.ReservationID == nil {
+			http.Error(w, "A reservation is required for pick-up and return reports", http.StatusBadRequest)
+			return
+		}
+		var ownsReservation bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Reservations WHERE reservation_id = ? AND user_id = ? AND vehicle_id = ?)",
+			*report.ReservationID, report.UserID, report.VehicleID).Scan(&ownsReservation)
+		if err != nil {
+			log.Println("Error checking reservation for condition report:", err)
+			http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+			return
+		}
+		if !ownsReservation {
+			http.Error(w, "Reservation not found for this user and vehicle", http.StatusForbidden)
+			return
+		}
+	case "Inspection":
+		isStaff, err := staff.IsFleetStaff(report.UserID)
+		if err != nil {
+			log.Println("Error checking staff role:", err)
+			http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+			return
+		}
+		if !isStaff {
+			http.Error(w, "Only fleet staff can file inspection reports", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "Report type must be PickUp, Return or Inspection", http.StatusBadRequest)
+		return
+	}
+
+	checklistJSON, err := json.Marshal(report.Checklist)
+	if err != nil {
+		http.Error(w, "Invalid checklist", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting condition report transaction:", err)
+		http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO ConditionReports (vehicle_id, reservation_id, user_id, report_type, checklist, notes) VALUES (?, ?, ?, ?, ?, ?)",
+		report.VehicleID, report.ReservationID, report.UserID, report.ReportType, checklistJSON, report.Notes)
+	if err != nil {
+		log.Println("Error inserting condition report:", err)
+		http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+		return
+	}
+	reportID, _ := result.LastInsertId()
+
+	// Damage already open on the same item was reported earlier, so only new damage is recorded
+	newDamage := []int64{}
+	severeDamage := false
+	for _, item := range report.Checklist {
+		if item.Condition != "Damaged" {
+			continue
+		}
+		var alreadyOpen bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM DamageRecords WHERE vehicle_id = ? AND item = ? AND status = 'Open')",
+			report.VehicleID, item.Item).Scan(&alreadyOpen)
+		if err != nil {
+			log.Println("Error checking existing damage:", err)
+			http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+			return
+		}
+		if alreadyOpen {
+			continue
+		}
+
+		result, err := tx.Exec("INSERT INTO DamageRecords (vehicle_id, report_id, reservation_id, item, severity, description) VALUES (?, ?, ?, ?, ?, ?)",
+			report.VehicleID, reportID, report.ReservationID, item.Item, item.Severity, item.Description)
+		if err != nil {
+			log.Println("Error inserting damage record:", err)
+			http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+			return
+		}
+		damageID, _ := result.LastInsertId()
+		newDamage = append(newDamage, damageID)
+		if item.Severity == "Severe" {
+			severeDamage = true
+		}
+	}
+
+	// Open severe damage takes the vehicle out of service until it is repaired
+	if severeDamage {
+		_, err = tx.Exec("UPDATE Vehicles SET availability_status = 'OutOfService' WHERE vehicle_id = ?", report.VehicleID)
+		if err != nil {
+			log.Printf("Error taking vehicle %d out of service: %v", report.VehicleID, err)
+			http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Vehicle %d taken out of service due to severe damage\n", report.VehicleID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing condition report:", err)
+		http.Error(w, "Error filing condition report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Condition report filed successfully",
+		"report_id":          reportID,
+		"new_damage_ids":     newDamage,
+		"vehicle_in_service": !severeDamage,
+	})
+}
+
+// UploadPhotos attaches photo evidence to a condition report from a multipart form field named "photos"
+func UploadPhotos(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(mux.Vars(r)["report_id"])
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	var reportExists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM ConditionReports WHERE report_id = ?)", reportID).Scan(&reportExists); err != nil {
+		log.Println("Error checking condition report:", err)
+		http.Error(w, "Error uploading photos", http.StatusInternalServerError)
+		return
+	}
+	if !reportExists {
+		http.Error(w, "Condition report not found", http.StatusNotFound)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotosPerUpload*maxPhotoSize)
+	if err := r.ParseMultipartForm(maxPhotoSize); err != nil {
+		http.Error(w, "Invalid or oversized upload", http.StatusBadRequest)
+		return
+	}
+	files := r.MultipartForm.File["photos"]
+	if len(files) == 0 || len(files) > maxPhotosPerUpload {
+		http.Error(w, fmt.Sprintf("Upload between 1 and %d photos", maxPhotosPerUpload), http.StatusBadRequest)
+		return
+	}
+
+	dir := filepath.Join(UploadDir(), "condition-reports", strconv.Itoa(reportID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Println("Error creating upload directory:", err)
+		http.Error(w, "Error uploading photos", http.StatusInternalServerError)
+		return
+	}
+
+	photos := []Photo{}
+	for _, header := range files {
+		extension, ok := photoTypes[header.Header.Get("Content-Type")]
+		if !ok || header.Size > maxPhotoSize {
+			http.Error(w, fmt.Sprintf("%s must be a JPEG or PNG image under 10MB", header.Filename), http.StatusBadRequest)
+			return
+		}
+
+		// Files are named by the server so user-supplied names never reach the filesystem
+		fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), extension)
+		if err := saveUpload(header, filepath.Join(dir, fileName)); err != nil {
+			log.Println("Error saving photo:", err)
+			http.Error(w, "Error uploading photos", http.StatusInternalServerError)
+			return
+		}
+
+		url := fmt.Sprintf("/uploads/condition-reports/%d/%s", reportID, fileName)
+		result, err := db.Exec("INSERT INTO ConditionPhotos (report_id, file_path) VALUES (?, ?)", reportID, url)
+		if err != nil {
+			log.Println("Error recording photo:", err)
+			http.Error(w, "Error uploading photos", http.StatusInternalServerError)
+			return
+		}
+		photoID, _ := result.LastInsertId()
+		photos = append(photos, Photo{PhotoID: int(photoID), URL: url, UploadedAt: time.Now()})
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(photos)
+}
+
+// saveUpload copies an uploaded file to the given path
+func saveUpload(header *multipart.FileHeader, path string) error {
+	src, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// GetReport retrieves a condition report with its checklist and photos
+func GetReport(w http.ResponseWriter, r *http.Request) {
+	reportID := mux.Vars(r)["report_id"]
+
+	var report Report
+	var reservationID sql.NullInt64
+	var checklistJSON []byte
+	var notes sql.NullString
+	err := db.QueryRow("SELECT report_id, vehicle_id, reservation_id, user_id, report_type, checklist, notes, created_at FROM ConditionReports WHERE report_id = ?", reportID).
+		Scan(&report.ReportID, &report.VehicleID, &reservationID, &report.UserID, &report.ReportType, &checklistJSON, &notes, &report.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Condition report not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching condition report:", err)
+		http.Error(w, "Error fetching condition report", http.StatusInternalServerError)
+		return
+	}
+	if reservationID.Valid {
+		id := int(reservationID.Int64)
+		report.ReservationID = &id
+	}
+	report.Notes = notes.String
+	if err := json.Unmarshal(checklistJSON, &report.Checklist); err != nil {
+		log.Println("Error decoding stored checklist:", err)
+		http.Error(w, "Error fetching condition report", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query("SELECT photo_id, file_path, uploaded_at FROM ConditionPhotos WHERE report_id = ? ORDER BY photo_id", reportID)
+	if err != nil {
+		log.Println("Error fetching condition report photos:", err)
+		http.Error(w, "Error fetching condition report", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report.Photos = []Photo{}
+	for rows.Next() {
+		var photo Photo
+		if err := rows.Scan(&photo.PhotoID, &photo.URL, &photo.UploadedAt); err != nil {
+			log.Println("Error scanning photo:", err)
+			http.Error(w, "Error fetching condition report", http.StatusInternalServerError)
+			return
+		}
+		report.Photos = append(report.Photos, photo)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetVehicleDamage retrieves damage records of a vehicle, optionally filtered by status
+func GetVehicleDamage(w http.ResponseWriter, r *http.Request) {
+	vehicleID := mux.Vars(r)["vehicle_id"]
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "Open" && status != "Repaired" {
+		http.Error(w, "Status must be Open or Repaired", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT damage_id, vehicle_id, report_id, reservation_id, item, severity, description, status, repaired_at, created_at
+        FROM DamageRecords
+        WHERE vehicle_id = ? AND (? = '' OR status = ?)
+        ORDER BY created_at DESC`, vehicleID, status, status)
+	if err != nil {
+		log.Printf("Error fetching damage for vehicle %s: %v", vehicleID, err)
+		http.Error(w, "Error fetching damage records", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	damages := []Damage{}
+	for rows.Next() {
+		var damage Damage
+		var reservationID sql.NullInt64
+		var description sql.NullString
+		var repairedAt sql.NullTime
+		if err := rows.Scan(&damage.DamageID, &damage.VehicleID, &damage.ReportID, &reservationID, &damage.Item, &damage.Severity,
+			&description, &damage.Status, &repairedAt, &damage.CreatedAt); err != nil {
+			log.Println("Error scanning damage record:", err)
+			http.Error(w, "Error fetching damage records", http.StatusInternalServerError)
+			return
+		}
+		if reservationID.Valid {
+			id := int(reservationID.Int64)
+			damage.ReservationID = &id
+		}
+		if repairedAt.Valid {
+			damage.RepairedAt = &repairedAt.Time
+		}
+		damage.Description = description.String
+		damages = append(damages, damage)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(damages)
+}
+
+// MarkDamageRepaired lets a fleet manager close a damage record. The vehicle returns to
+// service once it has no open severe damage left.
+func MarkDamageRepaired(w http.ResponseWriter, r *http.Request) {
+	damageID := mux.Vars(r)["damage_id"]
+
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	isManager, err := staff.IsFleetManager(request.UserID)
+	if err != nil {
+		log.Println("Error checking fleet manager role:", err)
+		http.Error(w, "Error updating damage record", http.StatusInternalServerError)
+		return
+	}
+	if !isManager {
+		http.Error(w, "Only fleet managers can mark damage as repaired", http.StatusForbidden)
+		return
+	}
+
+	var vehicleID int
+	err = db.QueryRow("SELECT vehicle_id FROM DamageRecords WHERE damage_id = ? AND status = 'Open'", damageID).Scan(&vehicleID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Damage record not found or already repaired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching damage record:", err)
+		http.Error(w, "Error updating damage record", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = db.Exec("UPDATE DamageRecords SET status = 'Repaired', repaired_at = NOW(), repaired_by = ? WHERE damage_id = ?", request.UserID, damageID)
+	if err != nil {
+		log.Println("Error marking damage repaired:", err)
+		http.Error(w, "Error updating damage record", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = db.Exec(`
+        UPDATE Vehicles SET availability_status = 'Available'
+        WHERE vehicle_id = ? AND availability_status = 'OutOfService'
+          AND NOT EXISTS (
+              SELECT 1 FROM DamageRecords WHERE vehicle_id = ? AND status = 'Open' AND severity = 'Severe'
+          )`, vehicleID, vehicleID)
+	if err != nil {
+		log.Printf("Error returning vehicle %d to service: %v", vehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Damage marked as repaired",
+	})
+}
@@ -0,0 +1,486 @@
+package geofence
+
+import (
+	"carRentalService/billing"
+	"carRentalService/geo"
+	"carRentalService/notify"
+	"carRentalService/staff"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for geofence service
+var db *sql.DB
+
+// Initialize the database connection for geofence service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Zones table connected successfully.")
+}
+
+// Zone types. Rented vehicles must stay inside at least one service area, if any are
+// defined, and must never enter a restricted zone.
+const (
+	ZoneServiceArea = "ServiceArea"
+	ZoneRestricted  = "Restricted"
+)
+
+// Violation types recorded against a reservation
+const (
+	ViolationLeftServiceArea       = "LeftServiceArea"
+	ViolationEnteredRestrictedZone = "EnteredRestrictedZone"
+)
+
+// Zone struct represents a polygon zone defined by a fleet manager
+type Zone struct {
+	ZoneID       int         `json:"zone_id"`
+	ZoneName     string      `json:"zone_name"`
+	ZoneType     string      `json:"zone_type"`
+	Polygon      []geo.Point `json:"polygon"`
+	ViolationFee float64     `json:"violation_fee"`
+	Active       bool        `json:"active"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// Violation struct represents a rented vehicle breaking a zone rule
+type Violation struct {
+	ViolationID   int        `json:"violation_id"`
+	ReservationID int        `json:"reservation_id"`
+	VehicleID     int        `json:"vehicle_id"`
+	ZoneID        *int       `json:"zone_id"`
+	ZoneName      *string    `json:"zone_name"`
+	ViolationType string     `json:"violation_type"`
+	Latitude      float64    `json:"latitude"`
+	Longitude     float64    `json:"longitude"`
+	DetectedAt    time.Time  `json:"detected_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	Fee           float64    `json:"fee"`
+	FeeStatus     string     `json:"fee_status"`
+}
+
+// Serialises position checks so concurrent telemetry batches cannot open duplicate violations
+var checkMutex sync.Mutex
+
+// validate checks that a zone has a known type, a usable polygon and a non-negative fee
+func (zone Zone) validate() error {
+	switch {
+	case zone.ZoneName == "":
+		return fmt.Errorf("missing zone_name")
+	case zone.ZoneType != ZoneServiceArea && zone.ZoneType != ZoneRestricted:
+		return fmt.Errorf("zone_type must be ServiceArea or Restricted")
+	case len(zone.Polygon) < 3:
+		return fmt.Errorf("polygon needs at least 3 points")
+	case zone.ViolationFee < 0:
+		return fmt.Errorf("violation_fee cannot be negative")
+	}
+	for i, point := range zone.Polygon {
+		if !geo.ValidCoordinates(point.Lat, point.Lng) {
+			return fmt.Errorf("polygon point %d is out of range", i)
+		}
+	}
+	return nil
+}
+
+const zoneColumns = "zone_id, zone_name, zone_type, polygon, violation_fee, active, created_at"
+
+func scanZone(scanner interface{ Scan(...interface{}) error }, zone *Zone) error {
+	var polygon []byte
+	if err := scanner.Scan(&zone.ZoneID, &zone.ZoneName, &zone.ZoneType, &polygon, &zone.ViolationFee, &zone.Active, &zone.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(polygon, &zone.Polygon)
+}
+
+// requireFleetManager checks that the given user is a fleet manager, writing an error response if not
+func requireFleetManager(w http.ResponseWriter, userID int) bool {
+	isManager, err := staff.IsFleetManager(userID)
+	if err != nil {
+		log.Println("Error checking fleet manager role:", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return false
+	}
+	if !isManager {
+		http.Error(w, "Only fleet managers can manage zones", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetZones retrieves every zone, including inactive ones
+func GetZones(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT " + zoneColumns + " FROM Zones ORDER BY zone_id")
+	if err != nil {
+		log.Println("Error fetching zones:", err)
+		http.Error(w, "Error fetching zones", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	zones := []Zone{}
+	for rows.Next() {
+		var zone Zone
+		if err := scanZone(rows, &zone); err != nil {
+			log.Println("Error scanning zone data:", err)
+			http.Error(w, "Error scanning zone data", http.StatusInternalServerError)
+			return
+		}
+		zones = append(zones, zone)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(zones)
+}
+
+// CreateZone defines a new service area or restricted zone
+func CreateZone(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID int `json:"user_id"`
+		Zone
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := request.Zone.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid zone: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !requireFleetManager(w, request.UserID) {
+		return
+	}
+
+	polygon, _ := json.Marshal(request.Polygon)
+	result, err := db.Exec("INSERT INTO Zones (zone_name, zone_type, polygon, violation_fee, created_by) VALUES (?, ?, ?, ?, ?)",
+		request.ZoneName, request.ZoneType, polygon, request.ViolationFee, request.UserID)
+	if err != nil {
+		log.Println("Error inserting zone:", err)
+		http.Error(w, "Error creating zone", http.StatusInternalServerError)
+		return
+	}
+	zoneID, _ := result.LastInsertId()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Zone created successfully",
+		"zone_id": zoneID,
+	})
+}
+
+// UpdateZone replaces a zone's definition. Setting active to false retires the zone
+// without losing the violations recorded against it.
+func UpdateZone(w http.ResponseWriter, r *http.Request) {
+	zoneID := mux.Vars(r)["zone_id"]
+
+	var request struct {
+		UserID int `json:"user_id"`
+		Zone
+	}
+	request.Active = true // Zones stay active unless the update says otherwise
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := request.Zone.validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid zone: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !requireFleetManager(w, request.UserID) {
+		return
+	}
+
+	polygon, _ := json.Marshal(request.Polygon)
+	result, err := db.Exec("UPDATE Zones SET zone_name = ?, zone_type = ?, polygon = ?, violation_fee = ?, active = ? WHERE zone_id = ?",
+		request.ZoneName, request.ZoneType, polygon, request.ViolationFee, request.Active, zoneID)
+	if err != nil {
+		log.Println("Error updating zone:", err)
+		http.Error(w, "Error updating zone", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM Zones WHERE zone_id = ?)", zoneID).Scan(&exists)
+		if !exists {
+			http.Error(w, "Zone not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Zone updated successfully",
+	})
+}
+
+// CheckPosition compares a vehicle position against the active zones. Only vehicles that have
+// been picked up on a reservation that is still in progress are checked. New violations are recorded
+// against the reservation and reported to staff; open violations are resolved once the
+// vehicle is back in compliance.
+func CheckPosition(vehicleID int, lat float64, lng float64, at time.Time) error {
+	checkMutex.Lock()
+	defer checkMutex.Unlock()
+
+	var reservationID int
+	err := db.QueryRow(`
+        SELECT reservation_id FROM Reservations
+        WHERE vehicle_id = ? AND status = 'InProgress' AND actual_pickup_at <= ?
+        LIMIT 1`, vehicleID, at).Scan(&reservationID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT " + zoneColumns + " FROM Zones WHERE active = TRUE")
+	if err != nil {
+		return err
+	}
+	var zones []Zone
+	for rows.Next() {
+		var zone Zone
+		if err := scanZone(rows, &zone); err != nil {
+			rows.Close()
+			return err
+		}
+		zones = append(zones, zone)
+	}
+	rows.Close()
+
+	position := geo.Point{Lat: lat, Lng: lng}
+	hasServiceArea, inServiceArea := false, false
+	serviceAreaFee := 0.0
+	inRestricted := make(map[int]Zone)
+	for _, zone := range zones {
+		inside := geo.InPolygon(position, zone.Polygon)
+		switch zone.ZoneType {
+		case ZoneServiceArea:
+			hasServiceArea = true
+			inServiceArea = inServiceArea || inside
+			// With several service areas, leaving all of them costs the highest configured fee
+			if zone.ViolationFee > serviceAreaFee {
+				serviceAreaFee = zone.ViolationFee
+			}
+		case ZoneRestricted:
+			if inside {
+				inRestricted[zone.ZoneID] = zone
+			}
+		}
+	}
+
+	// Open violations of this reservation, keyed by zone (0 for leaving the service area)
+	open := make(map[int]int)
+	rows, err = db.Query("SELECT violation_id, COALESCE(zone_id, 0) FROM ZoneViolations WHERE reservation_id = ? AND resolved_at IS NULL", reservationID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var violationID, zoneID int
+		if err := rows.Scan(&violationID, &zoneID); err != nil {
+			rows.Close()
+			return err
+		}
+		open[zoneID] = violationID
+	}
+	rows.Close()
+
+	outsideServiceArea := hasServiceArea && !inServiceArea
+	if _, isOpen := open[0]; outsideServiceArea && !isOpen {
+		if err := recordViolation(reservationID, vehicleID, nil, ViolationLeftServiceArea, "the service area", position, at, serviceAreaFee); err != nil {
+			return err
+		}
+	}
+	for zoneID, zone := range inRestricted {
+		if _, isOpen := open[zoneID]; !isOpen {
+			id := zoneID
+			if err := recordViolation(reservationID, vehicleID, &id, ViolationEnteredRestrictedZone, zone.ZoneName, position, at, zone.ViolationFee); err != nil {
+				return err
+			}
+		}
+	}
+
+	for zoneID, violationID := range open {
+		_, stillRestricted := inRestricted[zoneID]
+		if (zoneID == 0 && !outsideServiceArea) || (zoneID != 0 && !stillRestricted) {
+			if _, err := db.Exec("UPDATE ZoneViolations SET resolved_at = ? WHERE violation_id = ?", at, violationID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordViolation stores a new violation and alerts staff. Fees are held as Pending until the vehicle is returned.
+func recordViolation(reservationID int, vehicleID int, zoneID *int, violationType string, zoneName string, position geo.Point, at time.Time, fee float64) error {
+	feeStatus := "None"
+	if fee > 0 {
+		feeStatus = "Pending"
+	}
+	_, err := db.Exec(`
+        INSERT INTO ZoneViolations (reservation_id, vehicle_id, zone_id, violation_type, latitude, longitude, detected_at, fee, fee_status)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		reservationID, vehicleID, zoneID, violationType, position.Lat, position.Lng, at, fee, feeStatus)
+	if err != nil {
+		return err
+	}
+
+	action := "entered " + zoneName
+	if violationType == ViolationLeftServiceArea {
+		action = "left " + zoneName
+	}
+	log.Printf("Vehicle %d on reservation %d %s\n", vehicleID, reservationID, action)
+	notify.Staff(fmt.Sprintf("Geofence alert: vehicle %d %s", vehicleID, action), fmt.Sprintf(`
+		<p>Vehicle %d on reservation #%d %s at %s.</p>
+		<p>Last known position: <a href="https://maps.google.com/?q=%f,%f">%f, %f</a></p>
+	`, vehicleID, reservationID, action, at.Format(time.RFC1123), position.Lat, position.Lng, position.Lat, position.Lng))
+	return nil
+}
+
+// SettleViolationFees bills the pending violation fees of a reservation to its invoice. The fees
+// are queued for billing and marked Billed together, and sent once that is committed; charges that
+// fail to send are retried by the billing queue.
+func SettleViolationFees(reservationID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        SELECT v.violation_id, v.violation_type, v.detected_at, v.fee, z.zone_name
+        FROM ZoneViolations v
+        LEFT JOIN Zones z ON v.zone_id = z.zone_id
+        WHERE v.reservation_id = ? AND v.fee_status = 'Pending'
+        FOR UPDATE`, reservationID)
+	if err != nil {
+		return err
+	}
+	type pendingFee struct {
+		violationID int
+		description string
+		fee         float64
+	}
+	var pending []pendingFee
+	for rows.Next() {
+		var item pendingFee
+		var violationType string
+		var detectedAt time.Time
+		var zoneName sql.NullString
+		if err := rows.Scan(&item.violationID, &violationType, &detectedAt, &item.fee, &zoneName); err != nil {
+			rows.Close()
+			return err
+		}
+		if violationType == ViolationLeftServiceArea {
+			item.description = fmt.Sprintf("Left the service area at %s", detectedAt.Format("2006-01-02 15:04"))
+		} else {
+			item.description = fmt.Sprintf("Entered restricted zone %s at %s", zoneName.String, detectedAt.Format("2006-01-02 15:04"))
+		}
+		pending = append(pending, item)
+	}
+	rows.Close()
+
+	var billingRequestIDs []int
+	for _, item := range pending {
+		billingRequestID, err := billing.QueueLineItem(tx, reservationID, "GeofenceFee", item.description, item.fee)
+		if err != nil {
+			return fmt.Errorf("queueing violation %d fee: %w", item.violationID, err)
+		}
+		if _, err := tx.Exec("UPDATE ZoneViolations SET fee_status = 'Billed' WHERE violation_id = ?", item.violationID); err != nil {
+			return err
+		}
+		billingRequestIDs = append(billingRequestIDs, billingRequestID)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, billingRequestID := range billingRequestIDs {
+		if _, err := billing.Send(billingRequestID); err != nil {
+			log.Printf("Error billing geofence fee of reservation %d, it will be retried: %v", reservationID, err)
+		}
+	}
+	return nil
+}
+
+const violationQuery = `
+        SELECT v.violation_id, v.reservation_id, v.vehicle_id, v.zone_id, z.zone_name, v.violation_type,
+               v.latitude, v.longitude, v.detected_at, v.resolved_at, v.fee, v.fee_status
+        FROM ZoneViolations v
+        LEFT JOIN Zones z ON v.zone_id = z.zone_id`
+
+func scanViolation(rows *sql.Rows, violation *Violation) error {
+	return rows.Scan(&violation.ViolationID, &violation.ReservationID, &violation.VehicleID, &violation.ZoneID, &violation.ZoneName,
+		&violation.ViolationType, &violation.Latitude, &violation.Longitude, &violation.DetectedAt, &violation.ResolvedAt,
+		&violation.Fee, &violation.FeeStatus)
+}
+
+// writeViolations runs a violation query and writes the results as JSON
+func writeViolations(w http.ResponseWriter, query string, args ...interface{}) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching zone violations:", err)
+		http.Error(w, "Error fetching violations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	violations := []Violation{}
+	for rows.Next() {
+		var violation Violation
+		if err := scanViolation(rows, &violation); err != nil {
+			log.Println("Error scanning zone violation:", err)
+			http.Error(w, "Error scanning violation data", http.StatusInternalServerError)
+			return
+		}
+		violations = append(violations, violation)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(violations)
+}
+
+// GetReservationViolations retrieves the zone violations recorded against a reservation
+func GetReservationViolations(w http.ResponseWriter, r *http.Request) {
+	reservationID, err := strconv.Atoi(mux.Vars(r)["reservation_id"])
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	writeViolations(w, violationQuery+" WHERE v.reservation_id = ? ORDER BY v.detected_at", reservationID)
+}
+
+// GetOpenViolations retrieves unresolved violations across the fleet for staff (user_id query parameter)
+func GetOpenViolations(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "Missing or invalid user_id", http.StatusBadRequest)
+		return
+	}
+	isStaff, err := staff.IsFleetStaff(userID)
+	if err != nil {
+		log.Println("Error checking staff role:", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return
+	}
+	if !isStaff {
+		http.Error(w, "Only fleet staff can view fleet violations", http.StatusForbidden)
+		return
+	}
+	writeViolations(w, violationQuery+" WHERE v.resolved_at IS NULL ORDER BY v.detected_at DESC")
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+// Reservation statuses. A reservation is Pending until it is paid for, Confirmed until the
+// vehicle is picked up, and InProgress until it is returned. Pending reservations that are not
+// paid for before their hold expires become Expired.
+const (
+	Pending    = "Pending"
+	Confirmed  = "Confirmed"
+	InProgress = "InProgress"
+	Completed  = "Completed"
+	Cancelled  = "Cancelled"
+	NoShow     = "NoShow"
+	Expired    = "Expired"
+)
+
+// HoldingStatuses are the statuses of reservations that hold their vehicle for the reserved
+// period, formatted for use in an SQL IN clause
+const HoldingStatuses = "'Pending', 'Confirmed', 'InProgress'"
+
+// RentedStatuses are the statuses of reservations that count as paid rentals, formatted for use in an SQL IN clause
+const RentedStatuses = "'Confirmed', 'InProgress', 'Completed'"
+
+// UnexpiredHold is an SQL condition that leaves out Pending reservations whose hold has expired
+// but which the sweeper has not marked Expired yet, taking the current time. Holds are stored from
+// Go times, so they are compared with a Go time rather than the database's NOW(), which is in the
+// session time zone.
+const UnexpiredHold = "(status <> 'Pending' OR hold_expires_at IS NULL OR hold_expires_at > ?)"
+
+// BookableVehicleStatuses are the vehicle availability statuses that can take new reservations,
+// formatted for use in an SQL IN clause. A Booked or InUse vehicle has other reservations but can
+// still be booked for periods that do not overlap them.
+const BookableVehicleStatuses = "'Available', 'Booked', 'InUse'"
+
+var bookableVehicleStatuses = map[string]bool{
+	"Available": true,
+	"Booked":    true,
+	"InUse":     true,
+}
+
+// IsBookable reports whether a vehicle with an availability status can take new reservations
+func IsBookable(availabilityStatus string) bool {
+	return bookableVehicleStatuses[availabilityStatus]
+}
+
+// Allowed transitions from each status; Completed, Cancelled, NoShow and Expired are final
+var transitions = map[string][]string{
+	Pending:    {Confirmed, Cancelled, Expired},
+	Confirmed:  {InProgress, Cancelled, NoShow},
+	InProgress: {Completed},
+}
+
+// CanTransition reports whether a reservation may move from one status to another
+func CanTransition(from string, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether no further transitions are possible from a status
+func IsFinal(status string) bool {
+	return len(transitions[status]) == 0
+}
@@ -1,36 +1,163 @@
 package main
 
 import (
+	"carRentalService/analytics"
+	"carRentalService/availability"
+	"carRentalService/billing"
 	"carRentalService/booking"
+	"carRentalService/calendar"
+	"carRentalService/cancellation"
 	"carRentalService/car"
+	"carRentalService/charging"
+	"carRentalService/command"
+	"carRentalService/condition"
+	"carRentalService/geofence"
+	"carRentalService/maintenance"
+	"carRentalService/notify"
+	"carRentalService/pricing"
+	"carRentalService/staff"
+	"carRentalService/station"
+	"carRentalService/telemetry"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 func main() {
-	// Initialize the database connections for booking and car services
+	// Load environment variables; email alerts are skipped without a .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, email alerts will not be sent")
+	}
+
+	// Initialize the database connections for each service
 	car.InitDB()
 	booking.InitDB()
+	station.InitDB()
+	maintenance.InitDB()
+	telemetry.InitDB()
+	condition.InitDB()
+	staff.InitDB()
+	charging.InitDB()
+	command.InitDB()
+	analytics.InitDB()
+	geofence.InitDB()
+	notify.InitDB()
+	pricing.InitDB()
+	availability.InitDB()
+	cancellation.InitDB()
+	calendar.InitDB()
+	billing.InitDB()
+
+	// Start background jobs
+	maintenance.StartScheduler(time.Hour)
+	telemetry.StartRetentionPruner(time.Hour)
+	command.FailInterruptedCommands()
+	booking.StartNoShowMonitor(5 * time.Minute)
+	booking.StartWaitlistMonitor(time.Minute)
+	booking.StartHoldSweeper(time.Minute)
+	booking.StartReturnFeeSweeper(5 * time.Minute)
+	billing.StartRetrier(time.Minute)
 
 	// Create a new router
 	r := mux.NewRouter()
 
 	// Car Rental Service Routes
-	r.HandleFunc("/v1/vehicles", car.GetAllVehicles).Methods("GET") // Retrieves a list of all available vehicles
+	r.HandleFunc("/v1/vehicles", car.GetAllVehicles).Methods("GET")                                    // Retrieves a list of all available vehicles
+	r.HandleFunc("/v1/vehicles/nearby", car.GetNearbyVehicles).Methods("GET")                          // Retrieves available vehicles near a location, sorted by distance
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/calendar", availability.GetVehicleCalendar).Methods("GET") // Retrieves a vehicle's occupied intervals and free slots
+
+	// Maintenance Service Routes
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/maintenance", maintenance.ScheduleMaintenance).Methods("POST")    // Schedules a maintenance window for a vehicle
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/maintenance", maintenance.GetVehicleMaintenance).Methods("GET")   // Retrieves the maintenance history of a vehicle
+	r.HandleFunc("/v1/maintenance/{maintenance_id}/complete", maintenance.CompleteMaintenance).Methods("PUT") // Marks a maintenance record as completed
+	r.HandleFunc("/v1/maintenance/{maintenance_id}/cancel", maintenance.CancelMaintenance).Methods("PUT")     // Cancels a scheduled maintenance record
+	r.HandleFunc("/v1/fleet/maintenance", maintenance.GetFleetMaintenance).Methods("GET")                     // Lists upcoming and overdue maintenance for each vehicle
+
+	// Telemetry Service Routes
+	r.HandleFunc("/v1/telemetry", telemetry.IngestTelemetry).Methods("POST")                                // Ingests a batch of vehicle telemetry readings
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/telemetry/latest", telemetry.GetLatestTelemetry).Methods("GET") // Retrieves the latest telemetry reading of a vehicle
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/telemetry", telemetry.GetTelemetryHistory).Methods("GET")       // Retrieves a vehicle's telemetry history over a time window
+
+	// Condition Report Service Routes
+	r.HandleFunc("/v1/condition-reports", condition.CreateReport).Methods("POST")                                      // Files a pick-up, return or inspection condition report
+	r.HandleFunc("/v1/condition-reports/{report_id}", condition.GetReport).Methods("GET")                              // Retrieves a condition report with its checklist and photos
+	r.HandleFunc("/v1/condition-reports/{report_id}/photos", condition.UploadPhotos).Methods("POST")                   // Uploads photo evidence for a condition report
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/damages", condition.GetVehicleDamage).Methods("GET")                       // Retrieves damage records of a vehicle
+	r.HandleFunc("/v1/damages/{damage_id}/repair", condition.MarkDamageRepaired).Methods("PUT")                        // Marks a damage record as repaired
+	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(condition.UploadDir())))) // Serves uploaded photo evidence
+
+	// Charging Service Routes
+	r.HandleFunc("/v1/charging-stations", charging.GetChargingStations).Methods("GET")                              // Retrieves all charging stations with their connectors
+	r.HandleFunc("/v1/charging/sessions", charging.StartSession).Methods("POST")                                    // Starts a charging session during a reservation
+	r.HandleFunc("/v1/charging/sessions/{session_id}", charging.GetSession).Methods("GET")                          // Retrieves a charging session
+	r.HandleFunc("/v1/charging/sessions/{session_id}/stop", charging.StopSession).Methods("PUT")                    // Stops a charging session and bills the energy delivered
+	r.HandleFunc("/v1/bookings/{reservation_id}/charging-sessions", charging.GetReservationSessions).Methods("GET") // Retrieves all charging sessions of a reservation
+
+	// Vehicle Command Service Routes
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/commands", command.SendCommand).Methods("POST")       // Sends a remote command (lock, unlock, locate, honk, immobilise) to a vehicle
+	r.HandleFunc("/v1/vehicles/{vehicle_id}/commands", command.GetVehicleCommands).Methods("GET") // Retrieves the command history of a vehicle
+	r.HandleFunc("/v1/commands/{command_id}", command.GetCommand).Methods("GET")                  // Retrieves the status of a vehicle command
+
+	// Analytics Service Routes (fleet managers only)
+	r.HandleFunc("/v1/analytics/utilisation", analytics.GetUtilisation).Methods("GET") // Retrieves utilisation per vehicle per day or week
+	r.HandleFunc("/v1/analytics/revenue", analytics.GetRevenue).Methods("GET")         // Retrieves invoiced revenue per vehicle
+	r.HandleFunc("/v1/analytics/summary", analytics.GetSummary).Methods("GET")         // Retrieves average rental length and cancellation rate
+	r.HandleFunc("/v1/analytics/peak-hours", analytics.GetPeakHours).Methods("GET")    // Retrieves reservation demand for each hour of the day
+
+	// Geofence Service Routes
+	r.HandleFunc("/v1/zones", geofence.GetZones).Methods("GET")                                                // Retrieves all service area and restricted zones
+	r.HandleFunc("/v1/zones", geofence.CreateZone).Methods("POST")                                             // Defines a new zone (fleet managers only)
+	r.HandleFunc("/v1/zones/{zone_id}", geofence.UpdateZone).Methods("PUT")                                    // Updates or deactivates a zone (fleet managers only)
+	r.HandleFunc("/v1/fleet/violations", geofence.GetOpenViolations).Methods("GET")                            // Lists unresolved zone violations across the fleet (staff only)
+	r.HandleFunc("/v1/bookings/{reservation_id}/violations", geofence.GetReservationViolations).Methods("GET") // Retrieves the zone violations recorded against a reservation
+
+	// Station Service Routes
+	r.HandleFunc("/v1/stations", station.GetAllStations).Methods("GET")          // Retrieves a list of all pick-up stations
+	r.HandleFunc("/v1/stations/{station_id}", station.GetStation).Methods("GET") // Retrieves details of a specific pick-up station by its ID
 
 	// Booking Service Routes
-	r.HandleFunc("/v1/bookings/reserve", booking.MakeReservation).Methods("POST")                      // Creates a new reservation for a vehicle
-	r.HandleFunc("/v1/bookings/{reservation_id}", booking.GetReservation).Methods("GET")               // Retrieves details of a specific reservation by its ID
-	r.HandleFunc("/v1/reservations/{reservation_id}/cancel", booking.CancelReservation).Methods("PUT") // Cancels a specific reservation by its ID
-	r.HandleFunc("/v1/bookings/user/{user_id}", booking.GetUserReservations).Methods("GET")            // Retrieves all reservations for a specific user by their user ID
-	r.HandleFunc("/v1/bookings/{reservation_id}", booking.UpdateReservation).Methods("PUT")            // Updates the details of a specific reservation by its ID
-
-	// Start the server on port 8081
-	handler := cors.Default().Handler(r)
+	r.HandleFunc("/v1/bookings/series", booking.CreateSeries).Methods("POST")                                // Books a recurring reservation series and reports conflicting occurrences
+	r.HandleFunc("/v1/bookings/series/{series_id}", booking.GetSeries).Methods("GET")                        // Retrieves a recurring series with its occurrences
+	r.HandleFunc("/v1/bookings/series/{series_id}", booking.UpdateSeries).Methods("PUT")                     // Changes the times or vehicle of every upcoming occurrence of a series
+	r.HandleFunc("/v1/bookings/series/{series_id}/cancel", booking.CancelSeries).Methods("PUT")              // Cancels every upcoming occurrence of a series
+	r.HandleFunc("/v1/bookings/groups", booking.CreateGroup).Methods("POST")                                 // Books several vehicles for the same period, all or nothing
+	r.HandleFunc("/v1/bookings/groups/{group_id}", booking.GetGroup).Methods("GET")                          // Retrieves a group booking with its reservations
+	r.HandleFunc("/v1/bookings/quote", booking.QuoteReservation).Methods("POST")                             // Prices a rental without booking it, returning a quote honoured for a few minutes
+	r.HandleFunc("/v1/bookings/reserve", booking.MakeReservation).Methods("POST")                            // Creates a new reservation for a vehicle
+	r.HandleFunc("/v1/bookings/{reservation_id}", booking.GetReservation).Methods("GET")                     // Retrieves details of a specific reservation by its ID
+	r.HandleFunc("/v1/reservations/{reservation_id}/cancel", booking.CancelReservation).Methods("PUT")       // Cancels a specific reservation by its ID
+	r.HandleFunc("/v1/reservations/{reservation_id}/cancel", booking.GetCancellationQuote).Methods("GET")    // Shows the fee and refund for cancelling a reservation now
+	r.HandleFunc("/v1/bookings/user/{user_id}", booking.GetUserReservations).Methods("GET")                  // Retrieves a filtered, sorted page of a user's reservations with their payment state
+	r.HandleFunc("/v1/bookings/{reservation_id}", booking.UpdateReservation).Methods("PUT")                  // Updates the details of a specific reservation by its ID
+	r.HandleFunc("/v1/bookings/{reservation_id}/pickup", booking.PickUpReservation).Methods("PUT")           // Records the pick-up of a confirmed reservation's vehicle
+	r.HandleFunc("/v1/bookings/{reservation_id}/return", booking.ReturnReservation).Methods("PUT")           // Records the return of a reservation's vehicle and completes the reservation
+	r.HandleFunc("/v1/bookings/{reservation_id}/extend", booking.ExtendReservation).Methods("POST")          // Extends the end time of a reservation and charges the extra time
+	r.HandleFunc("/v1/bookings/{reservation_id}/late-return", booking.GetLateReturn).Methods("GET")          // Retrieves the late return of a reservation, or the one that delayed it
+	r.HandleFunc("/v1/bookings/{reservation_id}/substitute/accept", booking.AcceptSubstitute).Methods("PUT") // Switches a reservation delayed by a late return to the substitute vehicle offered
+
+	// Waitlist Routes
+	r.HandleFunc("/v1/waitlist", booking.JoinWaitlist).Methods("POST")                            // Joins the waitlist for a vehicle, or any vehicle of a class, for a period
+	r.HandleFunc("/v1/waitlist/user/{user_id}", booking.GetUserWaitlist).Methods("GET")           // Retrieves a user's waitlist entries and offers
+	r.HandleFunc("/v1/waitlist/{waitlist_id}/accept", booking.AcceptWaitlistOffer).Methods("PUT") // Books the vehicle held for a waitlist offer
+	r.HandleFunc("/v1/waitlist/{waitlist_id}/cancel", booking.LeaveWaitlist).Methods("PUT")       // Leaves the waitlist, declining any offer being held
+
+	// Calendar Routes
+	r.HandleFunc("/v1/calendar/user/{user_id}", calendar.GetFeed).Methods("GET")                            // Retrieves the address of a user's reservation calendar feed
+	r.HandleFunc("/v1/calendar/user/{user_id}/reset", calendar.ResetFeed).Methods("PUT")                    // Replaces a user's calendar feed address, disabling the old one
+	r.HandleFunc("/v1/calendar/feeds/{token:[0-9a-f]+}.ics", calendar.ServeFeed).Methods("GET")             // Serves a user's reservations as an iCalendar feed
+	r.HandleFunc("/v1/bookings/{reservation_id}/calendar.ics", calendar.DownloadReservation).Methods("GET") // Downloads a reservation as an .ics file
+
+	// Cancellation Policy Routes
+	r.HandleFunc("/v1/cancellation-policies", cancellation.GetPolicies).Methods("GET")                    // Retrieves the cancellation policy of each membership tier
+	r.HandleFunc("/v1/cancellation-policies/{membership_tier}", cancellation.UpdatePolicy).Methods("PUT") // Sets the cancellation policy of a membership tier (fleet managers only)
+
+	// Start the server on port 8081, letting browsers read the reservation history total
+	handler := cors.New(cors.Options{ExposedHeaders: []string{"X-Total-Count"}}).Handler(r)
 	fmt.Println("Car Rental Service is running on port 8081")
 	log.Fatal(http.ListenAndServe(":8081", handler))
 }
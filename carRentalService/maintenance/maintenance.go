@@ -0,0 +1,467 @@
+package maintenance
+
+import (
+	"carRentalService/lifecycle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for maintenance service
+var db *sql.DB
+
+// Initialize the database connection for maintenance service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Maintenance table connected successfully.")
+}
+
+// Automatically triggered services are planned this far ahead, for this long
+const (
+	autoServiceLeadTime = 24 * time.Hour
+	autoServiceDuration = 4 * time.Hour
+)
+
+// Valid maintenance types, matching the MaintenanceRecords table
+var maintenanceTypes = map[string]bool{
+	"Service":      true,
+	"Repair":       true,
+	"Inspection":   true,
+	"TyreChange":   true,
+	"BatteryCheck": true,
+}
+
+// Record struct represents a maintenance record for a vehicle
+type Record struct {
+	MaintenanceID   int        `json:"maintenance_id"`
+	VehicleID       int        `json:"vehicle_id"`
+	MaintenanceType string     `json:"maintenance_type"`
+	Status          string     `json:"status"`
+	PlannedStart    time.Time  `json:"planned_start"`
+	PlannedEnd      time.Time  `json:"planned_end"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	Notes           string     `json:"notes"`
+	Automatic       bool       `json:"triggered_automatically"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// VehicleServiceStatus summarises upcoming and overdue maintenance for one vehicle
+type VehicleServiceStatus struct {
+	VehicleID           int      `json:"vehicle_id"`
+	VehicleName         string   `json:"vehicle_name"`
+	OdometerKm          float64  `json:"odometer_km"`
+	KmSinceService      float64  `json:"km_since_service"`
+	RentalHoursSince    float64  `json:"rental_hours_since_service"`
+	ServiceIntervalKm   float64  `json:"service_interval_km"`
+	ServiceIntervalHrs  float64  `json:"service_interval_hours"`
+	ServiceDue          bool     `json:"service_due"`
+	UpcomingMaintenance []Record `json:"upcoming"`
+	OverdueMaintenance  []Record `json:"overdue"`
+}
+
+const recordColumns = "maintenance_id, vehicle_id, maintenance_type, status, planned_start, planned_end, completed_at, notes, triggered_automatically, created_at"
+
+// scanRecord scans a row selected with recordColumns into a maintenance record
+func scanRecord(rows *sql.Rows) (Record, error) {
+	var record Record
+	var completedAt sql.NullTime
+	var notes sql.NullString
+	err := rows.Scan(&record.MaintenanceID, &record.VehicleID, &record.MaintenanceType, &record.Status,
+		&record.PlannedStart, &record.PlannedEnd, &completedAt, &notes, &record.Automatic, &record.CreatedAt)
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	record.Notes = notes.String
+	return record, err
+}
+
+// HasConflict reports whether a scheduled or in-progress maintenance window overlaps the given period
+func HasConflict(vehicleID int, start, end time.Time) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM MaintenanceRecords
+            WHERE vehicle_id = ? AND status IN ('Scheduled', 'InProgress')
+              AND planned_start < ? AND planned_end > ?
+        )`, vehicleID, end, start).Scan(&exists)
+	return exists, err
+}
+
+// ScheduleMaintenance creates a maintenance window for a vehicle
+func ScheduleMaintenance(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicle_id"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		MaintenanceType string    `json:"maintenance_type"`
+		PlannedStart    time.Time `json:"planned_start"`
+		PlannedEnd      time.Time `json:"planned_end"`
+		Notes           string    `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Error decoding maintenance input:", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if !maintenanceTypes[request.MaintenanceType] {
+		http.Error(w, "Invalid maintenance type", http.StatusBadRequest)
+		return
+	}
+	if request.PlannedStart.IsZero() || !request.PlannedEnd.After(request.PlannedStart) {
+		http.Error(w, "Planned end must be after planned start", http.StatusBadRequest)
+		return
+	}
+
+	var vehicleExists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Vehicles WHERE vehicle_id = ?)", vehicleID).Scan(&vehicleExists); err != nil {
+		log.Println("Error checking vehicle:", err)
+		http.Error(w, "Error scheduling maintenance", http.StatusInternalServerError)
+		return
+	}
+	if !vehicleExists {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+
+	// Do not take the vehicle away from renters who already hold a reservation
+	var reservationConflict bool
+	err = db.QueryRow(`
+        SELECT EXISTS(
+            SELECT 1 FROM Reservations
+            WHERE vehicle_id = ? AND status IN (`+lifecycle.HoldingStatuses+`) AND start_time < ? AND end_time > ?
+        )`, vehicleID, request.PlannedEnd, request.PlannedStart).Scan(&reservationConflict)
+	if err != nil {
+		log.Println("Error checking reservations for maintenance window:", err)
+		http.Error(w, "Error scheduling maintenance", http.StatusInternalServerError)
+		return
+	}
+	if reservationConflict {
+		http.Error(w, "Maintenance window overlaps an active reservation", http.StatusConflict)
+		return
+	}
+
+	maintenanceID, err := insertRecord(vehicleID, request.MaintenanceType, request.PlannedStart, request.PlannedEnd, request.Notes, false)
+	if err != nil {
+		log.Println("Error inserting maintenance record:", err)
+		http.Error(w, "Error scheduling maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Maintenance scheduled successfully",
+		"maintenance_id": maintenanceID,
+	})
+}
+
+func insertRecord(vehicleID int, maintenanceType string, start, end time.Time, notes string, automatic bool) (int64, error) {
+	result, err := db.Exec("INSERT INTO MaintenanceRecords (vehicle_id, maintenance_type, planned_start, planned_end, notes, triggered_automatically) VALUES (?, ?, ?, ?, ?, ?)",
+		vehicleID, maintenanceType, start, end, notes, automatic)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetVehicleMaintenance retrieves the maintenance history of a vehicle, newest first
+func GetVehicleMaintenance(w http.ResponseWriter, r *http.Request) {
+	vehicleID := mux.Vars(r)["vehicle_id"]
+
+	rows, err := db.Query("SELECT "+recordColumns+" FROM MaintenanceRecords WHERE vehicle_id = ? ORDER BY planned_start DESC", vehicleID)
+	if err != nil {
+		log.Printf("Error fetching maintenance for vehicle %s: %v", vehicleID, err)
+		http.Error(w, "Error fetching maintenance records", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			log.Println("Error scanning maintenance record:", err)
+			http.Error(w, "Error fetching maintenance records", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, record)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
+
+// CompleteMaintenance marks a maintenance record as completed and returns the vehicle to service
+func CompleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	maintenanceID := mux.Vars(r)["maintenance_id"]
+
+	var request struct {
+		Notes string `json:"notes"`
+	}
+	// The body is optional; an empty body leaves the notes unchanged
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var vehicleID int
+	var maintenanceType string
+	err := db.QueryRow("SELECT vehicle_id, maintenance_type FROM MaintenanceRecords WHERE maintenance_id = ? AND status IN ('Scheduled', 'InProgress')", maintenanceID).
+		Scan(&vehicleID, &maintenanceType)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Maintenance record not found or already completed/cancelled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching maintenance record:", err)
+		http.Error(w, "Error completing maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = db.Exec(`
+        UPDATE MaintenanceRecords
+        SET status = 'Completed', completed_at = NOW(), notes = IF(? = '', notes, ?)
+        WHERE maintenance_id = ?`, request.Notes, request.Notes, maintenanceID)
+	if err != nil {
+		log.Println("Error completing maintenance record:", err)
+		http.Error(w, "Error completing maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	// A completed service resets the odometer and rental-hour counters
+	if maintenanceType == "Service" {
+		_, err = db.Exec("UPDATE Vehicles SET last_service_odometer_km = odometer_km, last_service_at = NOW() WHERE vehicle_id = ?", vehicleID)
+		if err != nil {
+			log.Printf("Error resetting service counters for vehicle %d: %v", vehicleID, err)
+			http.Error(w, "Error updating vehicle service counters", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := releaseVehicle(vehicleID); err != nil {
+		log.Printf("Error returning vehicle %d to service: %v", vehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Maintenance completed successfully",
+	})
+}
+
+// CancelMaintenance cancels a maintenance window that has not been completed
+func CancelMaintenance(w http.ResponseWriter, r *http.Request) {
+	maintenanceID := mux.Vars(r)["maintenance_id"]
+
+	var vehicleID int
+	err := db.QueryRow("SELECT vehicle_id FROM MaintenanceRecords WHERE maintenance_id = ? AND status IN ('Scheduled', 'InProgress')", maintenanceID).Scan(&vehicleID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Maintenance record not found or already completed/cancelled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching maintenance record:", err)
+		http.Error(w, "Error cancelling maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.Exec("UPDATE MaintenanceRecords SET status = 'Cancelled' WHERE maintenance_id = ?", maintenanceID); err != nil {
+		log.Println("Error cancelling maintenance record:", err)
+		http.Error(w, "Error cancelling maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	if err := releaseVehicle(vehicleID); err != nil {
+		log.Printf("Error returning vehicle %d to service: %v", vehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Maintenance cancelled successfully",
+	})
+}
+
+// releaseVehicle returns a vehicle to service once no maintenance is in progress, as Booked if it
+// still has reservations and Available otherwise
+func releaseVehicle(vehicleID int) error {
+	_, err := db.Exec(`
+        UPDATE Vehicles SET availability_status = IF(
+            EXISTS (SELECT 1 FROM Reservations WHERE vehicle_id = ? AND status IN (`+lifecycle.HoldingStatuses+`)),
+            'Booked', 'Available')
+        WHERE vehicle_id = ? AND availability_status = 'Maintenance'
+          AND NOT EXISTS (
+              SELECT 1 FROM MaintenanceRecords WHERE vehicle_id = ? AND status = 'InProgress'
+          )`, vehicleID, vehicleID, vehicleID)
+	return err
+}
+
+// GetFleetMaintenance lists upcoming and overdue maintenance for every vehicle
+func GetFleetMaintenance(w http.ResponseWriter, r *http.Request) {
+	statuses, err := fleetServiceStatus()
+	if err != nil {
+		log.Println("Error fetching fleet maintenance:", err)
+		http.Error(w, "Error fetching fleet maintenance", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query("SELECT " + recordColumns + " FROM MaintenanceRecords WHERE status IN ('Scheduled', 'InProgress') ORDER BY planned_start")
+	if err != nil {
+		log.Println("Error fetching open maintenance records:", err)
+		http.Error(w, "Error fetching fleet maintenance", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	byVehicle := make(map[int]*VehicleServiceStatus, len(statuses))
+	for i := range statuses {
+		byVehicle[statuses[i].VehicleID] = &statuses[i]
+	}
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			log.Println("Error scanning maintenance record:", err)
+			http.Error(w, "Error fetching fleet maintenance", http.StatusInternalServerError)
+			return
+		}
+
+		status, ok := byVehicle[record.VehicleID]
+		if !ok {
+			continue
+		}
+		// Scheduled work that should have started, or work running past its window, is overdue
+		overdue := (record.Status == "Scheduled" && record.PlannedStart.Before(now)) || record.PlannedEnd.Before(now)
+		if overdue {
+			status.OverdueMaintenance = append(status.OverdueMaintenance, record)
+		} else {
+			status.UpcomingMaintenance = append(status.UpcomingMaintenance, record)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// fleetServiceStatus computes odometer and rental-hour usage since the last service for every vehicle
+func fleetServiceStatus() ([]VehicleServiceStatus, error) {
+	rows, err := db.Query(`
+        SELECT v.vehicle_id, v.vehicle_name, v.odometer_km, v.odometer_km - v.last_service_odometer_km,
+               COALESCE((
+                   SELECT SUM(TIMESTAMPDIFF(MINUTE, COALESCE(r.actual_pickup_at, r.start_time), COALESCE(r.actual_return_at, r.end_time))) / 60
+                   FROM Reservations r
+                   WHERE r.vehicle_id = v.vehicle_id AND r.status = 'Completed' AND r.start_time >= v.last_service_at
+               ), 0),
+               v.service_interval_km, v.service_interval_hours
+        FROM Vehicles v
+        ORDER BY v.vehicle_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := []VehicleServiceStatus{}
+	for rows.Next() {
+		status := VehicleServiceStatus{UpcomingMaintenance: []Record{}, OverdueMaintenance: []Record{}}
+		if err := rows.Scan(&status.VehicleID, &status.VehicleName, &status.OdometerKm, &status.KmSinceService,
+			&status.RentalHoursSince, &status.ServiceIntervalKm, &status.ServiceIntervalHrs); err != nil {
+			return nil, err
+		}
+		status.ServiceDue = status.KmSinceService >= status.ServiceIntervalKm || status.RentalHoursSince >= status.ServiceIntervalHrs
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
+
+// StartScheduler periodically starts due maintenance windows and schedules services for
+// vehicles that have passed their odometer or rental-hour thresholds
+func StartScheduler(interval time.Duration) {
+	go func() {
+		for {
+			runScheduler()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func runScheduler() {
+	if err := startDueWindows(time.Now()); err != nil {
+		log.Println("Error starting due maintenance windows:", err)
+	}
+
+	statuses, err := fleetServiceStatus()
+	if err != nil {
+		log.Println("Error checking fleet service thresholds:", err)
+		return
+	}
+	for _, status := range statuses {
+		if !status.ServiceDue {
+			continue
+		}
+		if err := scheduleAutomaticService(status); err != nil {
+			log.Printf("Error scheduling automatic service for vehicle %d: %v", status.VehicleID, err)
+		}
+	}
+}
+
+// startDueWindows takes vehicles out of service once their maintenance window begins. A Booked
+// vehicle only has reservations for other periods, as windows cannot overlap reservations, so it
+// is taken out of service too; a vehicle still in use is left until it is returned.
+func startDueWindows(now time.Time) error {
+	_, err := db.Exec(`
+        UPDATE MaintenanceRecords m
+        JOIN Vehicles v ON m.vehicle_id = v.vehicle_id
+        SET m.status = 'InProgress', v.availability_status = 'Maintenance'
+        WHERE m.status = 'Scheduled' AND m.planned_start <= ? AND v.availability_status IN ('Available', 'Booked')`, now)
+	return err
+}
+
+// scheduleAutomaticService plans a service after the vehicle's last active reservation,
+// unless one is already scheduled
+func scheduleAutomaticService(status VehicleServiceStatus) error {
+	var alreadyScheduled bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM MaintenanceRecords WHERE vehicle_id = ? AND maintenance_type = 'Service' AND status IN ('Scheduled', 'InProgress'))",
+		status.VehicleID).Scan(&alreadyScheduled)
+	if err != nil || alreadyScheduled {
+		return err
+	}
+
+	start := time.Now().Add(autoServiceLeadTime)
+	var lastReservationEnd sql.NullTime
+	err = db.QueryRow("SELECT MAX(end_time) FROM Reservations WHERE vehicle_id = ? AND status IN ("+lifecycle.HoldingStatuses+")", status.VehicleID).Scan(&lastReservationEnd)
+	if err != nil {
+		return err
+	}
+	if lastReservationEnd.Valid && lastReservationEnd.Time.After(start) {
+		start = lastReservationEnd.Time
+	}
+	start = start.Truncate(time.Hour).Add(time.Hour)
+
+	notes := fmt.Sprintf("Automatically scheduled: %.0f km and %.1f rental hours since last service", status.KmSinceService, status.RentalHoursSince)
+	_, err = insertRecord(status.VehicleID, "Service", start, start.Add(autoServiceDuration), notes, true)
+	if err == nil {
+		log.Printf("Scheduled automatic service for vehicle %d at %s", status.VehicleID, start.Format(time.RFC3339))
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package maintenance
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the database named by ELECTRIGO_TEST_DSN, skipping the test when it is not set.
+// The database must be loaded from seed.sql, e.g.
+// ELECTRIGO_TEST_DSN="user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+func openTestDB(t *testing.T) {
+	dsn := os.Getenv("ELECTRIGO_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ELECTRIGO_TEST_DSN not set; skipping database test")
+	}
+	var err error
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+}
+
+func TestDueWindowStartsOnVehicleWithLaterReservation(t *testing.T) {
+	openTestDB(t)
+
+	const vehicleID = 5
+
+	var originalStatus string
+	if err := db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&originalStatus); err != nil {
+		t.Fatalf("fetching test vehicle: %v", err)
+	}
+
+	// A reservation well after the window leaves the vehicle Booked
+	start := time.Now().AddDate(5, 3, 0).Truncate(time.Hour)
+	result, err := db.Exec("INSERT INTO Reservations (user_id, vehicle_id, pickup_station_id, start_time, end_time, status, total_cost) VALUES (1, ?, 4, ?, ?, 'Confirmed', 44)",
+		vehicleID, start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("creating reservation: %v", err)
+	}
+	reservationID, _ := result.LastInsertId()
+	now := time.Now()
+	maintenanceID, err := insertRecord(vehicleID, "Inspection", now.Add(-time.Hour), now.Add(time.Hour), "Test window", false)
+	if err != nil {
+		t.Fatalf("scheduling maintenance: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM MaintenanceRecords WHERE maintenance_id = ?", maintenanceID)
+		db.Exec("DELETE FROM Reservations WHERE reservation_id = ?", reservationID)
+		db.Exec("UPDATE Vehicles SET availability_status = ? WHERE vehicle_id = ?", originalStatus, vehicleID)
+	})
+	if _, err := db.Exec("UPDATE Vehicles SET availability_status = 'Booked' WHERE vehicle_id = ?", vehicleID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := startDueWindows(now); err != nil {
+		t.Fatalf("starting due windows: %v", err)
+	}
+	var recordStatus, vehicleStatus string
+	if err := db.QueryRow("SELECT status FROM MaintenanceRecords WHERE maintenance_id = ?", maintenanceID).Scan(&recordStatus); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&vehicleStatus); err != nil {
+		t.Fatal(err)
+	}
+	if recordStatus != "InProgress" || vehicleStatus != "Maintenance" {
+		t.Fatalf("after the window began: maintenance %s and vehicle %s, want InProgress and Maintenance", recordStatus, vehicleStatus)
+	}
+
+	// Once the work is done the vehicle goes back to Booked for its later reservation
+	if _, err := db.Exec("UPDATE MaintenanceRecords SET status = 'Completed' WHERE maintenance_id = ?", maintenanceID); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseVehicle(vehicleID); err != nil {
+		t.Fatalf("releasing vehicle: %v", err)
+	}
+	if err := db.QueryRow("SELECT availability_status FROM Vehicles WHERE vehicle_id = ?", vehicleID).Scan(&vehicleStatus); err != nil {
+		t.Fatal(err)
+	}
+	if vehicleStatus != "Booked" {
+		t.Errorf("after the maintenance: vehicle %s, want Booked", vehicleStatus)
+	}
+}
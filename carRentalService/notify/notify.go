@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"gopkg.in/gomail.v2"
+)
+
+// DB variable for global database connection to the account database for contact details
+var db *sql.DB
+
+// Initialize the database connection for notifications
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_AccountDB"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Account Database for notifications connected successfully.")
+}
+
+// User emails a user in the background. Failures are logged rather than returned so that
+// notifications never block the operation that triggered them.
+func User(userID int, subject string, body string) {
+	go func() {
+		var email, name string
+		err := db.QueryRow("SELECT email, CONCAT(first_name, ' ', last_name) FROM Users WHERE user_id = ?", userID).Scan(&email, &name)
+		if err != nil {
+			log.Printf("Error fetching contact details for user %d: %v", userID, err)
+			return
+		}
+		if err := send(email, subject, fmt.Sprintf("<p>Dear %s,</p>%s<p>Thank you,<br>The ElectriGo Team</p>", name, body)); err != nil {
+			log.Printf("Error emailing user %d: %v", userID, err)
+		}
+	}()
+}
+
+// Staff emails every fleet staff member and fleet manager in the background
+func Staff(subject string, body string) {
+	go func() {
+		rows, err := db.Query("SELECT email FROM Users WHERE role IN ('Staff', 'FleetManager')")
+		if err != nil {
+			log.Println("Error fetching staff contact details:", err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var email string
+			if err := rows.Scan(&email); err != nil {
+				log.Println("Error scanning staff email:", err)
+				return
+			}
+			if err := send(email, subject, body); err != nil {
+				log.Printf("Error emailing staff member %s: %v", email, err)
+			}
+		}
+	}()
+}
+
+// send delivers an HTML email through Gmail using the GMAIL_EMAIL and GMAIL_APP_PASSWORD credentials
+func send(to string, subject string, body string) error {
+	mail := gomail.NewMessage()
+	mail.SetHeader("From", os.Getenv("GMAIL_EMAIL"))
+	mail.SetHeader("To", to)
+	mail.SetHeader("Subject", subject)
+	mail.SetBody("text/html", body)
+
+	dialer := gomail.NewDialer("smtp.gmail.com", 587, os.Getenv("GMAIL_EMAIL"), os.Getenv("GMAIL_APP_PASSWORD"))
+	if err := dialer.DialAndSend(mail); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package pricing
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+	_ "time/tzdata" // The business time zone must load on hosts without time zone data
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DB variable for global database connection for pricing service
+var db *sql.DB
+
+// Initialize the database connection for pricing service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for RatePlans table connected successfully.")
+
+	// Load the business time zone now so that an invalid BUSINESS_TIMEZONE stops the service at startup
+	Location()
+}
+
+// Rentals are priced in the business's time zone unless BUSINESS_TIMEZONE names another
+const defaultBusinessTimezone = "Asia/Singapore"
+
+var (
+	location     *time.Location
+	locationOnce sync.Once
+)
+
+// Location returns the time zone that peak hours, weekends, public holidays and rental days are
+// reckoned in, configurable with BUSINESS_TIMEZONE as an IANA name such as Asia/Singapore
+func Location() *time.Location {
+	locationOnce.Do(func() {
+		name := os.Getenv("BUSINESS_TIMEZONE")
+		if name == "" {
+			name = defaultBusinessTimezone
+		}
+		var err error
+		if location, err = time.LoadLocation(name); err != nil {
+			log.Fatalf("Invalid BUSINESS_TIMEZONE %q: %v", name, err)
+		}
+	})
+	return location
+}
+
+// Rate categories, in order of precedence: a holiday is never also priced as a weekend or peak hour
+const (
+	RateHoliday = "Holiday"
+	RateWeekend = "Weekend"
+	RatePeak    = "Peak"
+	RateOffPeak = "OffPeak"
+)
+
+// Length of a rental day, week and month used for the daily cap and the weekly and monthly rates
+const (
+	rentalDay       = 24 * time.Hour
+	daysPerWeek     = 7
+	daysPerMonth    = 30
+	dateLayout      = "2006-01-02"
+	breakdownLayout = "Mon 2 Jan 15:04"
+)
+
+// Plan is the rate plan of a vehicle class. Rates are multiples of the vehicle's hourly_rate,
+// so vehicles in the same class keep their own base price.
+type Plan struct {
+	VehicleClass      string  `json:"vehicle_class"`
+	PeakMultiplier    float64 `json:"peak_multiplier"`
+	WeekendMultiplier float64 `json:"weekend_multiplier"`
+	HolidayMultiplier float64 `json:"holiday_multiplier"`
+	PeakStartHour     int     `json:"peak_start_hour"`
+	PeakEndHour       int     `json:"peak_end_hour"`
+	DailyCapHours     float64 `json:"daily_cap_hours"`   // A rental day never costs more than this many base hours; 0 disables the cap
+	WeeklyRateDays    float64 `json:"weekly_rate_days"`  // A full week costs at most this many capped days; 0 disables the weekly rate
+	MonthlyRateDays   float64 `json:"monthly_rate_days"` // A full 30 days cost at most this many capped days; 0 disables the monthly rate
+}
+
+// Item is a stretch of the rental charged at a single rate
+type Item struct {
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Hours       float64   `json:"hours"`
+	HourlyRate  float64   `json:"hourly_rate"`
+	Amount      float64   `json:"amount"`
+}
+
+// Adjustment is a discount applied by the daily cap or the weekly or monthly rate
+type Adjustment struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// Quote is the itemised price of a rental
+type Quote struct {
+	VehicleClass string       `json:"vehicle_class"`
+	BaseRate     float64      `json:"base_hourly_rate"`
+	Items        []Item       `json:"items"`
+	Adjustments  []Adjustment `json:"adjustments"`
+	Subtotal     float64      `json:"subtotal"`
+	Total        float64      `json:"total"`
+}
+
+// Rates are what rentals of a vehicle are priced with: its class's rate plan, its hourly rate and
+// the public holidays in the rental period. Quotes carry them so a booking is priced as quoted.
+type Rates struct {
+	Plan       Plan              `json:"plan"`
+	HourlyRate float64           `json:"hourly_rate"`
+	Holidays   map[string]string `json:"holidays,omitempty"`
+}
+
+// QuoteVehicle prices a rental of a vehicle using its class's rate plan and the public holidays in the period.
+// Vehicles without a rate plan are charged their flat hourly rate.
+func QuoteVehicle(vehicleID int, start time.Time, end time.Time) (Quote, error) {
+	rates, err := VehicleRates(vehicleID, start, end)
+	if err != nil {
+		return Quote{}, err
+	}
+	return rates.Quote(start, end), nil
+}
+
+// VehicleRates loads the current rates of a vehicle for a rental period
+func VehicleRates(vehicleID int, start time.Time, end time.Time) (Rates, error) {
+	var rates Rates
+	plan := &rates.Plan
+	err := db.QueryRow(`
+        SELECT v.hourly_rate, v.vehicle_class,
+               COALESCE(p.peak_multiplier, 1), COALESCE(p.weekend_multiplier, 1), COALESCE(p.holiday_multiplier, 1),
+               COALESCE(p.peak_start_hour, 0), COALESCE(p.peak_end_hour, 0),
+               COALESCE(p.daily_cap_hours, 0), COALESCE(p.weekly_rate_days, 0), COALESCE(p.monthly_rate_days, 0)
+        FROM Vehicles v
+        LEFT JOIN RatePlans p ON v.vehicle_class = p.vehicle_class
+        WHERE v.vehicle_id = ?`, vehicleID).
+		Scan(&rates.HourlyRate, &plan.VehicleClass, &plan.PeakMultiplier, &plan.WeekendMultiplier, &plan.HolidayMultiplier,
+			&plan.PeakStartHour, &plan.PeakEndHour, &plan.DailyCapHours, &plan.WeeklyRateDays, &plan.MonthlyRateDays)
+	if err != nil {
+		return Rates{}, err
+	}
+
+	rates.Holidays, err = holidaysBetween(start, end)
+	if err != nil {
+		return Rates{}, err
+	}
+	return rates, nil
+}
+
+// Quote prices a rental with the rates, in the business time zone
+func (rates Rates) Quote(start time.Time, end time.Time) Quote {
+	return Calculate(rates.Plan, rates.HourlyRate, start, end, rates.Holidays, Location())
+}
+
+// holidaysBetween returns the names of public holidays falling within a period, keyed by date
+func holidaysBetween(start time.Time, end time.Time) (map[string]string, error) {
+	rows, err := db.Query("SELECT holiday_date, holiday_name FROM PublicHolidays WHERE holiday_date BETWEEN ? AND ?",
+		start.In(Location()).Format(dateLayout), end.In(Location()).Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := make(map[string]string)
+	for rows.Next() {
+		var date time.Time
+		var name string
+		if err := rows.Scan(&date, &name); err != nil {
+			return nil, err
+		}
+		holidays[date.Format(dateLayout)] = name
+	}
+	return holidays, nil
+}
+
+// Calculate prices a rental. The rental is split wherever the rate changes (peak hours, midnight
+// and rental-day boundaries), each rental day is capped, and whole months and then whole weeks are
+// charged at most the monthly and weekly rates. Times are priced in the time zone loc, in which
+// the holidays' dates are also given.
+func Calculate(plan Plan, hourlyRate float64, start time.Time, end time.Time, holidays map[string]string, loc *time.Location) Quote {
+	quote := Quote{VehicleClass: plan.VehicleClass, BaseRate: hourlyRate, Items: []Item{}, Adjustments: []Adjustment{}}
+	start, end = start.In(loc), end.In(loc)
+	if !end.After(start) {
+		return quote
+	}
+
+	days := int(math.Ceil(end.Sub(start).Hours() / rentalDay.Hours()))
+	dayTotals := make([]float64, days)
+
+	for cursor := start; cursor.Before(end); {
+		day := int(cursor.Sub(start) / rentalDay)
+		category, description, multiplier := plan.rateAt(cursor, holidays)
+
+		next := earliest(end, start.Add(time.Duration(day+1)*rentalDay), plan.nextBoundary(cursor))
+		hours := next.Sub(cursor).Hours()
+		rate := hourlyRate * multiplier
+		amount := hours * rate
+
+		// Extend the previous item when the rate is unchanged within the same rental day
+		if last := len(quote.Items) - 1; last >= 0 && quote.Items[last].Category == category &&
+			quote.Items[last].Description == description && int(quote.Items[last].Start.Sub(start)/rentalDay) == day {
+			quote.Items[last].End = next
+			quote.Items[last].Hours += hours
+			quote.Items[last].Amount += amount
+		} else {
+			quote.Items = append(quote.Items, Item{Category: category, Description: description, Start: cursor, End: next, Hours: hours, HourlyRate: roundCents(rate), Amount: amount})
+		}
+		dayTotals[day] += amount
+		quote.Subtotal += amount
+		cursor = next
+	}
+	for i := range quote.Items {
+		quote.Items[i].Hours = math.Round(quote.Items[i].Hours*100) / 100
+		quote.Items[i].Amount = roundCents(quote.Items[i].Amount)
+	}
+
+	// Cap each rental day
+	dailyCap := hourlyRate * plan.DailyCapHours
+	if plan.DailyCapHours <= 0 {
+		dailyCap = hourlyRate * rentalDay.Hours()
+	}
+	for day, total := range dayTotals {
+		if plan.DailyCapHours > 0 && total > dailyCap {
+			quote.Adjustments = append(quote.Adjustments, Adjustment{
+				Description: fmt.Sprintf("Daily cap on day %d (%s)", day+1, start.Add(time.Duration(day)*rentalDay).Format(breakdownLayout)),
+				Amount:      dailyCap - total,
+			})
+			dayTotals[day] = dailyCap
+		}
+	}
+
+	// Charge whole months, then whole weeks of the remaining days, at most their flat rate
+	day := applyPeriodRate(&quote, dayTotals, 0, daysPerMonth, dailyCap*plan.MonthlyRateDays, "Monthly rate")
+	applyPeriodRate(&quote, dayTotals, day, daysPerWeek, dailyCap*plan.WeeklyRateDays, "Weekly rate")
+
+	quote.Subtotal = roundCents(quote.Subtotal)
+	quote.Total = quote.Subtotal
+	for i := range quote.Adjustments {
+		quote.Adjustments[i].Amount = roundCents(quote.Adjustments[i].Amount)
+		quote.Total += quote.Adjustments[i].Amount
+	}
+	quote.Total = roundCents(quote.Total)
+	return quote
+}
+
+// applyPeriodRate charges consecutive whole periods of rental days from the first day at most the
+// period rate, returning the first day after the last whole period. A rate of 0 disables it.
+func applyPeriodRate(quote *Quote, dayTotals []float64, first int, periodDays int, rate float64, name string) int {
+	if rate <= 0 {
+		return first
+	}
+	for ; first+periodDays <= len(dayTotals); first += periodDays {
+		total := 0.0
+		for _, amount := range dayTotals[first : first+periodDays] {
+			total += amount
+		}
+		if total > rate {
+			quote.Adjustments = append(quote.Adjustments, Adjustment{
+				Description: fmt.Sprintf("%s for days %d-%d", name, first+1, first+periodDays),
+				Amount:      rate - total,
+			})
+		}
+	}
+	return first
+}
+
+// rateAt returns the rate category, description and multiplier in force at a time
+func (plan Plan) rateAt(at time.Time, holidays map[string]string) (string, string, float64) {
+	if name, ok := holidays[at.Format(dateLayout)]; ok {
+		return RateHoliday, "Public holiday: " + name, plan.HolidayMultiplier
+	}
+	if at.Weekday() == time.Saturday || at.Weekday() == time.Sunday {
+		return RateWeekend, "Weekend", plan.WeekendMultiplier
+	}
+	if plan.isPeakHour(at.Hour()) {
+		return RatePeak, "Peak hours", plan.PeakMultiplier
+	}
+	return RateOffPeak, "Off-peak hours", 1
+}
+
+// isPeakHour reports whether an hour of the day falls in the peak window, which may wrap past midnight
+func (plan Plan) isPeakHour(hour int) bool {
+	if plan.PeakStartHour == plan.PeakEndHour {
+		return false
+	}
+	if plan.PeakStartHour < plan.PeakEndHour {
+		return hour >= plan.PeakStartHour && hour < plan.PeakEndHour
+	}
+	return hour >= plan.PeakStartHour || hour < plan.PeakEndHour
+}
+
+// nextBoundary returns the next time after at where the rate can change: midnight or the start or end of peak hours
+func (plan Plan) nextBoundary(at time.Time) time.Time {
+	midnight := time.Date(at.Year(), at.Month(), at.Day()+1, 0, 0, 0, 0, at.Location())
+	next := midnight
+	for _, hour := range []int{plan.PeakStartHour, plan.PeakEndHour} {
+		boundary := time.Date(at.Year(), at.Month(), at.Day(), hour, 0, 0, 0, at.Location())
+		if boundary.After(at) && boundary.Before(next) {
+			next = boundary
+		}
+	}
+	return next
+}
+
+// earliest returns the earliest of the given times
+func earliest(times ...time.Time) time.Time {
+	result := times[0]
+	for _, t := range times[1:] {
+		if t.Before(result) {
+			result = t
+		}
+	}
+	return result
+}
+
+// roundCents rounds an amount to the nearest cent
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,152 @@
+package pricing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPlan charges 1.5x between 7:00 and 10:00 on weekdays, 1.25x at weekends and 2x on public
+// holidays, caps a rental day at 10 base hours, and charges at most 5 capped days a week and 18 a month
+var testPlan = Plan{
+	VehicleClass:      "Standard",
+	PeakMultiplier:    1.5,
+	WeekendMultiplier: 1.25,
+	HolidayMultiplier: 2,
+	PeakStartHour:     7,
+	PeakEndHour:       10,
+	DailyCapHours:     10,
+	WeeklyRateDays:    5,
+	MonthlyRateDays:   18,
+}
+
+const testHourlyRate = 10
+
+func TestCalculate(t *testing.T) {
+	singapore, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 January 2025 is a Monday
+	at := func(day int, hour int) time.Time {
+		return time.Date(2025, 1, day, hour, 0, 0, 0, singapore)
+	}
+	newYear := map[string]string{"2025-01-01": "New Year's Day"}
+
+	tests := []struct {
+		name           string
+		plan           Plan
+		start, end     time.Time
+		holidays       map[string]string
+		wantCategories []string
+		wantSubtotal   float64
+		wantTotal      float64
+	}{
+		{"off-peak", testPlan, at(6, 12), at(6, 14), nil, []string{RateOffPeak}, 20, 20},
+		{"across peak hours", testPlan, at(6, 6), at(6, 11), nil, []string{RateOffPeak, RatePeak, RateOffPeak}, 65, 65},
+		{"weekend hours are not peak", testPlan, at(11, 7), at(11, 9), nil, []string{RateWeekend}, 25, 25},
+		{"holiday hours are not peak", testPlan, at(1, 8), at(1, 10), newYear, []string{RateHoliday}, 40, 40},
+		{"split at midnight into the weekend", testPlan, at(10, 22), at(11, 2), nil, []string{RateOffPeak, RateWeekend}, 45, 45},
+		{"split at midnight into a holiday", testPlan, time.Date(2024, 12, 31, 23, 0, 0, 0, singapore), at(1, 1), newYear, []string{RateOffPeak, RateHoliday}, 30, 30},
+		// 7 off-peak, 3 peak and 14 off-peak hours cost 255, capped at 100
+		{"daily cap", testPlan, at(6, 0), at(7, 0), nil, []string{RateOffPeak, RatePeak, RateOffPeak}, 255, 100},
+		{"daily cap on a rental day across midnight", testPlan, at(6, 12), at(7, 12), nil, []string{RateOffPeak, RatePeak, RateOffPeak}, 255, 100},
+		{"capped first day and a partial second day", testPlan, at(6, 20), at(7, 22), nil, nil, 275, 120},
+		// Weekdays of 255 and weekend days of 300 are each capped at 100, then 500 a week and 1800 a month
+		{"weekly rate", testPlan, at(6, 0), at(13, 0), nil, nil, 1875, 500},
+		{"weekly rate and a remaining day", testPlan, at(6, 0), at(14, 0), nil, nil, 2130, 600},
+		{"monthly rate", testPlan, at(6, 0), time.Date(2025, 2, 5, 0, 0, 0, 0, singapore), nil, nil, 8010, 1800},
+		{"monthly rate then weekly rate", testPlan, at(6, 0), time.Date(2025, 2, 12, 0, 0, 0, 0, singapore), nil, nil, 9885, 2300},
+		{"without a plan", Plan{PeakMultiplier: 1, WeekendMultiplier: 1, HolidayMultiplier: 1}, at(6, 0), at(13, 0), nil, nil, 1680, 1680},
+		{"end before start", testPlan, at(6, 14), at(6, 12), nil, []string{}, 0, 0},
+	}
+	for _, test := range tests {
+		quote := Calculate(test.plan, testHourlyRate, test.start, test.end, test.holidays, singapore)
+		if quote.Subtotal != test.wantSubtotal || quote.Total != test.wantTotal {
+			t.Errorf("%s: subtotal %.2f, total %.2f, want %.2f and %.2f", test.name, quote.Subtotal, quote.Total, test.wantSubtotal, test.wantTotal)
+		}
+		if test.wantCategories == nil {
+			continue
+		}
+		categories := []string{}
+		for _, item := range quote.Items {
+			categories = append(categories, item.Category)
+		}
+		if !reflect.DeepEqual(categories, test.wantCategories) {
+			t.Errorf("%s: item categories %v, want %v", test.name, categories, test.wantCategories)
+		}
+	}
+}
+
+func TestCalculateItemsCoverRental(t *testing.T) {
+	start := time.Date(2025, 1, 10, 5, 30, 0, 0, time.UTC)
+	end := start.Add(50 * time.Hour)
+	quote := Calculate(testPlan, testHourlyRate, start, end, nil, time.UTC)
+
+	cursor := start
+	hours := 0.0
+	for _, item := range quote.Items {
+		if !item.Start.Equal(cursor) {
+			t.Fatalf("item %+v starts at %v, want %v", item, item.Start, cursor)
+		}
+		cursor = item.End
+		hours += item.Hours
+	}
+	if !cursor.Equal(end) || hours != 50 {
+		t.Errorf("items end at %v after %.2f hours, want %v after 50", cursor, hours, end)
+	}
+}
+
+func TestCalculateUsesLocation(t *testing.T) {
+	singapore, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 23:00 UTC on Monday is 07:00 on Tuesday in Singapore
+	start := time.Date(2025, 1, 6, 23, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		loc          *time.Location
+		wantCategory string
+		wantTotal    float64
+	}{
+		{singapore, RatePeak, 15},
+		{time.UTC, RateOffPeak, 10},
+	}
+	for _, test := range tests {
+		quote := Calculate(testPlan, testHourlyRate, start, end, nil, test.loc)
+		if len(quote.Items) != 1 || quote.Items[0].Category != test.wantCategory || quote.Total != test.wantTotal {
+			t.Errorf("in %s: got items %+v and total %.2f, want one %s item and %.2f", test.loc, quote.Items, quote.Total, test.wantCategory, test.wantTotal)
+			continue
+		}
+		if quote.Items[0].Start.Location() != test.loc {
+			t.Errorf("in %s: item starts in %s", test.loc, quote.Items[0].Start.Location())
+		}
+	}
+}
+
+func TestIsPeakHour(t *testing.T) {
+	overnight := Plan{PeakStartHour: 22, PeakEndHour: 2}
+	none := Plan{PeakStartHour: 8, PeakEndHour: 8}
+	tests := []struct {
+		plan Plan
+		hour int
+		want bool
+	}{
+		{testPlan, 6, false},
+		{testPlan, 7, true},
+		{testPlan, 9, true},
+		{testPlan, 10, false},
+		{overnight, 21, false},
+		{overnight, 23, true},
+		{overnight, 1, true},
+		{overnight, 2, false},
+		{none, 8, false},
+	}
+	for _, test := range tests {
+		if got := test.plan.isPeakHour(test.hour); got != test.want {
+			t.Errorf("isPeakHour(%d) with peak %d-%d = %v, want %v", test.hour, test.plan.PeakStartHour, test.plan.PeakEndHour, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies supported in a rule
+const (
+	Daily  = "DAILY"
+	Weekly = "WEEKLY"
+)
+
+// A series may have at most MaxOccurrences occurrences, all within MaxSpan of the first
+const (
+	MaxOccurrences = 100
+	MaxSpan        = 366 * 24 * time.Hour
+)
+
+// Weekday codes used by BYDAY
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is a recurrence rule in a subset of the iCalendar RRULE format, for example
+// FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20250131 or FREQ=DAILY;INTERVAL=2;COUNT=10.
+// Every rule must end with UNTIL or COUNT.
+type Rule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Until    time.Time // Occurrences starting after Until are excluded; zero when COUNT is used
+	Count    int
+}
+
+// Parse reads a rule, with or without a leading "RRULE:"
+func Parse(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return rule, fmt.Errorf("empty rule")
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		name, setting, found := strings.Cut(part, "=")
+		if !found {
+			return rule, fmt.Errorf("malformed part %q", part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(setting)
+			if rule.Freq != Daily && rule.Freq != Weekly {
+				return rule, fmt.Errorf("FREQ must be DAILY or WEEKLY")
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(setting)
+			if err != nil || interval < 1 {
+				return rule, fmt.Errorf("INTERVAL must be a positive number")
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			for _, code := range strings.Split(strings.ToUpper(setting), ",") {
+				weekday, ok := weekdays[code]
+				if !ok {
+					return rule, fmt.Errorf("unknown day %q in BYDAY", code)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "UNTIL":
+			until, err := parseUntil(setting)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = until
+		case "COUNT":
+			count, err := strconv.Atoi(setting)
+			if err != nil || count < 1 {
+				return rule, fmt.Errorf("COUNT must be a positive number")
+			}
+			rule.Count = count
+		default:
+			return rule, fmt.Errorf("unsupported part %s", name)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return rule, fmt.Errorf("missing FREQ")
+	case rule.Until.IsZero() && rule.Count == 0:
+		return rule, fmt.Errorf("rule must end with UNTIL or COUNT")
+	case !rule.Until.IsZero() && rule.Count != 0:
+		return rule, fmt.Errorf("UNTIL and COUNT cannot be used together")
+	case rule.Count > MaxOccurrences:
+		return rule, fmt.Errorf("COUNT cannot be more than %d", MaxOccurrences)
+	}
+	return rule, nil
+}
+
+// parseUntil reads an UNTIL date (20060102, inclusive of the whole day in local time) or UTC date-time (20060102T150405Z)
+func parseUntil(value string) (time.Time, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return until, nil
+	}
+	if until, err := time.ParseInLocation("20060102", value, time.Local); err == nil {
+		return until.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be a date such as 20250131 or a UTC time such as 20250131T235959Z")
+}
+
+// Occurrences returns the start times of the series beginning at start, which is always the first
+// occurrence. Later occurrences keep the clock time of start, and the series stops at Until or
+// Count, after MaxOccurrences, or at MaxSpan from start, whichever comes first.
+func (rule Rule) Occurrences(start time.Time) []time.Time {
+	occurrences := []time.Time{start}
+	limit := MaxOccurrences
+	if rule.Count > 0 {
+		limit = rule.Count
+	}
+	last := start.Add(MaxSpan)
+	if !rule.Until.IsZero() && rule.Until.Before(last) {
+		last = rule.Until
+	}
+
+	// Days of the week the rule repeats on; a rule without BYDAY repeats on the day it starts
+	onDay := make(map[time.Weekday]bool)
+	for _, weekday := range rule.ByDay {
+		onDay[weekday] = true
+	}
+	if len(onDay) == 0 && rule.Freq == Weekly {
+		onDay[start.Weekday()] = true
+	}
+
+	// Weekly rules count weeks from the Monday of the first occurrence's week
+	daysSinceMonday := (int(start.Weekday()) + 6) % 7
+	for day := 1; len(occurrences) < limit; day++ {
+		candidate := dayAt(start, day)
+		if candidate.After(last) {
+			break
+		}
+		switch rule.Freq {
+		case Daily:
+			if day%rule.Interval != 0 || (len(onDay) > 0 && !onDay[candidate.Weekday()]) {
+				continue
+			}
+		case Weekly:
+			week := (daysSinceMonday + day) / 7
+			if week%rule.Interval != 0 || !onDay[candidate.Weekday()] {
+				continue
+			}
+		}
+		occurrences = append(occurrences, candidate)
+	}
+	return occurrences
+}
+
+// dayAt returns the time days after start on the calendar, at the same clock time
+func dayAt(start time.Time, days int) time.Time {
+	return time.Date(start.Year(), start.Month(), start.Day()+days, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+}
+
+// String formats the rule in RRULE form
+func (rule Rule) String() string {
+	parts := []string{"FREQ=" + rule.Freq}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if len(rule.ByDay) > 0 {
+		codes := make([]string, len(rule.ByDay))
+		for i, weekday := range rule.ByDay {
+			codes[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if rule.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	} else {
+		parts = append(parts, "UNTIL="+rule.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,161 @@
+package recurrence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Rule
+	}{
+		{"FREQ=DAILY;COUNT=3", Rule{Freq: Daily, Interval: 1, Count: 3}},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=mo,fr;COUNT=4", Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Friday}, Count: 4}},
+		{"freq=weekly;until=20250131T120000Z", Rule{Freq: Weekly, Interval: 1, Until: time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)}},
+		{"FREQ=DAILY;UNTIL=20250131", Rule{Freq: Daily, Interval: 1, Until: time.Date(2025, 1, 31, 23, 59, 59, 0, time.Local)}},
+		{"FREQ=DAILY;COUNT=100", Rule{Freq: Daily, Interval: 1, Count: MaxOccurrences}},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.value)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.value, err)
+			continue
+		}
+		if !rule.Until.Equal(test.want.Until) {
+			t.Errorf("Parse(%q).Until = %v, want %v", test.value, rule.Until, test.want.Until)
+		}
+		rule.Until, test.want.Until = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(rule, test.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.value, rule, test.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"RRULE:",
+		"FREQ=MONTHLY;COUNT=2",
+		"FREQ=DAILY",
+		"INTERVAL=2;COUNT=2",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250131",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=101",
+		"FREQ=DAILY;INTERVAL=0;COUNT=2",
+		"FREQ=WEEKLY;BYDAY=MO,XX;COUNT=2",
+		"FREQ=DAILY;UNTIL=2025-01-31",
+		"FREQ=DAILY;COUNT",
+		"FREQ=DAILY;BYMONTH=1;COUNT=2",
+	} {
+		if rule, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", value, rule)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	monday := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	wednesday := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+	on := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 9, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{"daily count", "FREQ=DAILY;COUNT=3", monday, []time.Time{on(1, 6), on(1, 7), on(1, 8)}},
+		{"daily interval", "FREQ=DAILY;INTERVAL=2;COUNT=3", monday, []time.Time{on(1, 6), on(1, 8), on(1, 10)}},
+		{"daily until is inclusive", "FREQ=DAILY;UNTIL=20250109T090000Z", monday, []time.Time{on(1, 6), on(1, 7), on(1, 8), on(1, 9)}},
+		{"daily until before the clock time", "FREQ=DAILY;UNTIL=20250109T085959Z", monday, []time.Time{on(1, 6), on(1, 7), on(1, 8)}},
+		{"daily byday", "FREQ=DAILY;BYDAY=SA,SU;UNTIL=20250112T235959Z", monday, []time.Time{on(1, 6), on(1, 11), on(1, 12)}},
+		{"weekly repeats on the start day", "FREQ=WEEKLY;COUNT=3", monday, []time.Time{on(1, 6), on(1, 13), on(1, 20)}},
+		{"weekly interval", "FREQ=WEEKLY;INTERVAL=2;COUNT=3", monday, []time.Time{on(1, 6), on(1, 20), on(2, 3)}},
+		{"weekly byday", "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=5", monday, []time.Time{on(1, 6), on(1, 8), on(1, 10), on(1, 13), on(1, 15)}},
+		{"weekly byday and interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4", monday, []time.Time{on(1, 6), on(1, 7), on(1, 9), on(1, 21)}},
+		{"weekly byday until", "FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20250116T000000Z", monday, []time.Time{on(1, 6), on(1, 7), on(1, 9), on(1, 14)}},
+		{"start not on a byday day", "FREQ=WEEKLY;BYDAY=MO;COUNT=3", wednesday, []time.Time{on(1, 8), on(1, 13), on(1, 20)}},
+		{"start not on a byday day with interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;COUNT=3", wednesday, []time.Time{on(1, 8), on(1, 20), on(2, 3)}},
+		{"count of one", "FREQ=DAILY;COUNT=1", monday, []time.Time{on(1, 6)}},
+		{"until before start", "FREQ=DAILY;UNTIL=20250101T000000Z", monday, []time.Time{on(1, 6)}},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.rule)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned error: %v", test.name, test.rule, err)
+		}
+		if got := rule.Occurrences(test.start); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Occurrences = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOccurrencesAreCapped(t *testing.T) {
+	start := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		rule      string
+		wantCount int
+		wantLast  time.Time
+	}{
+		// 100 days from 6 January is 15 April
+		{"at MaxOccurrences", "FREQ=DAILY;UNTIL=20271231T000000Z", MaxOccurrences, time.Date(2025, 4, 15, 9, 0, 0, 0, time.UTC)},
+		// 52 weeks later is the last Monday within 366 days
+		{"at MaxSpan", "FREQ=WEEKLY;UNTIL=20271231T000000Z", 53, time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.rule)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned error: %v", test.name, test.rule, err)
+		}
+		occurrences := rule.Occurrences(start)
+		if len(occurrences) != test.wantCount {
+			t.Fatalf("%s: got %d occurrences, want %d", test.name, len(occurrences), test.wantCount)
+		}
+		if last := occurrences[len(occurrences)-1]; !last.Equal(test.wantLast) {
+			t.Errorf("%s: last occurrence = %v, want %v", test.name, last, test.wantLast)
+		}
+		if span := occurrences[len(occurrences)-1].Sub(start); span > MaxSpan {
+			t.Errorf("%s: occurrences span %v, more than MaxSpan", test.name, span)
+		}
+	}
+}
+
+func TestOccurrencesKeepClockTimeAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available:", err)
+	}
+	rule, err := Parse("FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks go forward on 9 March 2025
+	start := time.Date(2025, 3, 8, 9, 0, 0, 0, newYork)
+	for i, occurrence := range rule.Occurrences(start) {
+		if occurrence.Hour() != 9 || occurrence.Day() != 8+i {
+			t.Errorf("occurrence %d = %v, want 9:00 on %d March", i, occurrence, 8+i)
+		}
+	}
+}
+
+func TestStringRoundTrips(t *testing.T) {
+	for _, value := range []string{
+		"FREQ=DAILY;COUNT=3",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=4",
+		"FREQ=WEEKLY;BYDAY=TU;UNTIL=20250131T120000Z",
+	} {
+		rule, err := Parse(value)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", value, err)
+		}
+		if got := rule.String(); got != value {
+			t.Errorf("Parse(%q).String() = %q", value, got)
+		}
+	}
+}
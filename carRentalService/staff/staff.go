@@ -0,0 +1,59 @@
+package staff
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// DB variable for global database connection to the account database for staff lookups
+var db *sql.DB
+
+// Initialize the database connection for staff lookups
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_AccountDB"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Account Database for staff roles connected successfully.")
+}
+
+// Roles stored in the Users table
+const (
+	RoleCustomer     = "Customer"
+	RoleStaff        = "Staff"
+	RoleFleetManager = "FleetManager"
+)
+
+// Role returns the role of a user, or sql.ErrNoRows if the user does not exist
+func Role(userID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM Users WHERE user_id = ?", userID).Scan(&role)
+	return role, err
+}
+
+// IsFleetStaff reports whether a user is fleet staff, including fleet managers
+func IsFleetStaff(userID int) (bool, error) {
+	role, err := Role(userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return role == RoleStaff || role == RoleFleetManager, err
+}
+
+// IsFleetManager reports whether a user is a fleet manager
+func IsFleetManager(userID int) (bool, error) {
+	role, err := Role(userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return role == RoleFleetManager, err
+}
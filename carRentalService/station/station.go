@@ -0,0 +1,86 @@
+package station
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for station service
+var db *sql.DB
+
+// Initialize the database connection for station service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Stations table connected successfully.")
+}
+
+// Station struct represents a pick-up station where vehicles are based
+type Station struct {
+	StationID   int     `json:"station_id"`
+	StationName string  `json:"station_name"`
+	Address     string  `json:"address"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+// GetAllStations retrieves every pick-up station
+func GetAllStations(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT station_id, station_name, address, latitude, longitude FROM Stations")
+	if err != nil {
+		log.Println("Error fetching stations:", err)
+		http.Error(w, "Error fetching stations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var stations []Station
+	for rows.Next() {
+		var station Station
+		if err := rows.Scan(&station.StationID, &station.StationName, &station.Address, &station.Latitude, &station.Longitude); err != nil {
+			log.Println("Error scanning station data:", err)
+			http.Error(w, "Error scanning station data", http.StatusInternalServerError)
+			return
+		}
+		stations = append(stations, station)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stations)
+}
+
+// GetStation retrieves a single pick-up station by its ID
+func GetStation(w http.ResponseWriter, r *http.Request) {
+	stationID := mux.Vars(r)["station_id"]
+
+	var station Station
+	err := db.QueryRow("SELECT station_id, station_name, address, latitude, longitude FROM Stations WHERE station_id = ?", stationID).
+		Scan(&station.StationID, &station.StationName, &station.Address, &station.Latitude, &station.Longitude)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching station:", err)
+		http.Error(w, "Error fetching station", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(station)
+}
@@ -0,0 +1,295 @@
+package telemetry
+
+import (
+	"carRentalService/geo"
+	"carRentalService/geofence"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// DB variable for global database connection for telemetry service
+var db *sql.DB
+
+// Initialize the database connection for telemetry service
+func InitDB() {
+	var err error
+	// Connect to the MySQL database
+	dsn := "user:password@tcp(localhost:3306)/ElectriGo_VehicleDB?parseTime=true"
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Vehicle Database for Telemetry table connected successfully.")
+}
+
+// Limits on ingestion batches and history queries
+const (
+	maxBatchSize        = 1000
+	defaultHistoryLimit = 500
+	maxHistoryLimit     = 5000
+	defaultRetention    = 7 * 24 * time.Hour
+	pruneBatchSize      = 10000
+)
+
+// Reading struct represents a single telemetry sample reported by a vehicle
+type Reading struct {
+	VehicleID     int       `json:"vehicle_id"`
+	RecordedAt    time.Time `json:"recorded_at"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	OdometerKm    float64   `json:"odometer_km"`
+	StateOfCharge float64   `json:"state_of_charge"`
+	SpeedKmh      float64   `json:"speed_kmh"`
+	IsLocked      bool      `json:"is_locked"`
+}
+
+// validate checks that a reading is complete and within physical limits
+func (reading Reading) validate() error {
+	switch {
+	case reading.VehicleID == 0:
+		return fmt.Errorf("missing vehicle_id")
+	case reading.RecordedAt.IsZero():
+		return fmt.Errorf("missing recorded_at")
+	case reading.RecordedAt.After(time.Now().Add(5 * time.Minute)):
+		return fmt.Errorf("recorded_at is in the future")
+	case !geo.ValidCoordinates(reading.Latitude, reading.Longitude):
+		return fmt.Errorf("coordinates out of range")
+	case reading.OdometerKm < 0:
+		return fmt.Errorf("odometer_km cannot be negative")
+	case reading.StateOfCharge < 0 || reading.StateOfCharge > 100:
+		return fmt.Errorf("state_of_charge must be between 0 and 100")
+	case reading.SpeedKmh < 0:
+		return fmt.Errorf("speed_kmh cannot be negative")
+	}
+	return nil
+}
+
+// IngestTelemetry stores a batch of telemetry readings and updates each vehicle's latest state
+func IngestTelemetry(w http.ResponseWriter, r *http.Request) {
+	var batch struct {
+		Readings []Reading `json:"readings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		log.Println("Error decoding telemetry batch:", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if len(batch.Readings) == 0 {
+		http.Error(w, "Batch contains no readings", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Readings) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Batch exceeds the maximum of %d readings", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	latest := make(map[int]Reading)
+	for i, reading := range batch.Readings {
+		if err := reading.validate(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid reading at index %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		if current, ok := latest[reading.VehicleID]; !ok || reading.RecordedAt.After(current.RecordedAt) {
+			latest[reading.VehicleID] = reading
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting telemetry transaction:", err)
+		http.Error(w, "Error storing telemetry", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Insert the whole batch with a single multi-row statement
+	placeholders := make([]string, 0, len(batch.Readings))
+	args := make([]interface{}, 0, len(batch.Readings)*8)
+	for _, reading := range batch.Readings {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, reading.VehicleID, reading.RecordedAt, reading.Latitude, reading.Longitude,
+			reading.OdometerKm, reading.StateOfCharge, reading.SpeedKmh, reading.IsLocked)
+	}
+	_, err = tx.Exec("INSERT INTO VehicleTelemetry (vehicle_id, recorded_at, latitude, longitude, odometer_km, state_of_charge, speed_kmh, is_locked) VALUES "+
+		strings.Join(placeholders, ", "), args...)
+	if err != nil {
+		log.Println("Error inserting telemetry:", err)
+		http.Error(w, "Error storing telemetry (check that every vehicle exists)", http.StatusBadRequest)
+		return
+	}
+
+	// Only move the vehicle's state forward if no newer reading has already been stored
+	for vehicleID, reading := range latest {
+		_, err = tx.Exec(`
+            UPDATE Vehicles
+            SET battery_level = ?, odometer_km = GREATEST(odometer_km, ?)
+            WHERE vehicle_id = ?
+              AND NOT EXISTS (SELECT 1 FROM VehicleTelemetry WHERE vehicle_id = ? AND recorded_at > ?)`,
+			reading.StateOfCharge, reading.OdometerKm, vehicleID, vehicleID, reading.RecordedAt)
+		if err != nil {
+			log.Printf("Error updating state of vehicle %d from telemetry: %v", vehicleID, err)
+			http.Error(w, "Error storing telemetry", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing telemetry:", err)
+		http.Error(w, "Error storing telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	// Check each vehicle's newest position against the geofence zones
+	for vehicleID, reading := range latest {
+		if err := geofence.CheckPosition(vehicleID, reading.Latitude, reading.Longitude, reading.RecordedAt); err != nil {
+			log.Printf("Error checking geofence for vehicle %d: %v", vehicleID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Telemetry stored successfully",
+		"accepted": len(batch.Readings),
+	})
+}
+
+const readingColumns = "vehicle_id, recorded_at, latitude, longitude, odometer_km, state_of_charge, speed_kmh, is_locked"
+
+func scanReading(scanner interface{ Scan(...interface{}) error }, reading *Reading) error {
+	return scanner.Scan(&reading.VehicleID, &reading.RecordedAt, &reading.Latitude, &reading.Longitude,
+		&reading.OdometerKm, &reading.StateOfCharge, &reading.SpeedKmh, &reading.IsLocked)
+}
+
+// LatestReading returns the most recent telemetry reading of a vehicle
+func LatestReading(vehicleID int) (Reading, error) {
+	var reading Reading
+	row := db.QueryRow("SELECT "+readingColumns+" FROM VehicleTelemetry WHERE vehicle_id = ? ORDER BY recorded_at DESC LIMIT 1", vehicleID)
+	err := scanReading(row, &reading)
+	return reading, err
+}
+
+// GetLatestTelemetry retrieves the latest known state of a vehicle
+func GetLatestTelemetry(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicle_id"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	reading, err := LatestReading(vehicleID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No telemetry found for vehicle", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching latest telemetry for vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Error fetching telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reading)
+}
+
+// GetTelemetryHistory retrieves a vehicle's telemetry over a window, oldest first.
+// The window defaults to the last hour.
+func GetTelemetryHistory(w http.ResponseWriter, r *http.Request) {
+	vehicleID := mux.Vars(r)["vehicle_id"]
+	query := r.URL.Query()
+
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	var err error
+	if toParam := query.Get("to"); toParam != "" {
+		if to, err = time.Parse(time.RFC3339, toParam); err != nil {
+			http.Error(w, "Invalid to format", http.StatusBadRequest)
+			return
+		}
+		from = to.Add(-time.Hour)
+	}
+	if fromParam := query.Get("from"); fromParam != "" {
+		if from, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			http.Error(w, "Invalid from format", http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := db.Query("SELECT "+readingColumns+" FROM VehicleTelemetry WHERE vehicle_id = ? AND recorded_at >= ? AND recorded_at < ? ORDER BY recorded_at LIMIT ?",
+		vehicleID, from, to, limit)
+	if err != nil {
+		log.Printf("Error fetching telemetry history for vehicle %s: %v", vehicleID, err)
+		http.Error(w, "Error fetching telemetry", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	readings := []Reading{}
+	for rows.Next() {
+		var reading Reading
+		if err := scanReading(rows, &reading); err != nil {
+			log.Println("Error scanning telemetry:", err)
+			http.Error(w, "Error fetching telemetry", http.StatusInternalServerError)
+			return
+		}
+		readings = append(readings, reading)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(readings)
+}
+
+// StartRetentionPruner periodically deletes telemetry older than the retention period,
+// configured in days with TELEMETRY_RETENTION_DAYS
+func StartRetentionPruner(interval time.Duration) {
+	retention := defaultRetention
+	if days, err := strconv.Atoi(os.Getenv("TELEMETRY_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	go func() {
+		for {
+			pruneTelemetry(time.Now().Add(-retention))
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// pruneTelemetry deletes readings older than the cutoff in batches to keep locks short
+func pruneTelemetry(cutoff time.Time) {
+	for {
+		result, err := db.Exec("DELETE FROM VehicleTelemetry WHERE recorded_at < ? LIMIT ?", cutoff, pruneBatchSize)
+		if err != nil {
+			log.Println("Error pruning telemetry:", err)
+			return
+		}
+		if deleted, _ := result.RowsAffected(); deleted < pruneBatchSize {
+			return
+		}
+	}
+}
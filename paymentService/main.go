@@ -25,9 +25,15 @@ func main() {
 	r := mux.NewRouter()
 
 	// Payment Service Routes
-	r.HandleFunc("/v1/payments/make", payment.MakePayment).Methods("POST")                // Processes a payment for a reservation
-	r.HandleFunc("/v1/invoices/user/{user_id}", payment.GetInvoicesByUser).Methods("GET") // Retrieves all invoices for a specific user by their user ID
-	r.HandleFunc("/v1/promotions/apply", payment.ApplyPromoCode).Methods("POST")          // Applies a promotional code to a reservation
+	r.HandleFunc("/v1/payments/make", payment.MakePayment).Methods("POST")                                                 // Processes a payment for a reservation
+	r.HandleFunc("/v1/payments/preview", payment.PreviewPayment).Methods("POST")                                           // Works out what paying for a reservation or group booking would charge
+	r.HandleFunc("/v1/invoices/user/{user_id}", payment.GetInvoicesByUser).Methods("GET")                                  // Retrieves all invoices for a specific user by their user ID
+	r.HandleFunc("/v1/promotions/apply", payment.ApplyPromoCode).Methods("POST")                                           // Previews the discounts a promotional code gives on an unpaid reservation
+	r.HandleFunc("/v1/invoices/line-items", payment.AddLineItem).Methods("POST")                                           // Adds a charge (e.g. a charging session) to a reservation's invoice
+	r.HandleFunc("/v1/invoices/supplementary", payment.CreateSupplementaryInvoice).Methods("POST")                         // Bills charges raised after a rental has ended on a new invoice
+	r.HandleFunc("/v1/invoices/reservation/{reservation_id}/line-items", payment.GetLineItemsByReservation).Methods("GET") // Retrieves all line items charged to a reservation
+	r.HandleFunc("/v1/payments/refunds", payment.IssueRefund).Methods("POST")                                              // Refunds part of a reservation's invoice
+	r.HandleFunc("/v1/payments/refunds/reservation/{reservation_id}", payment.GetRefundsByReservation).Methods("GET")      // Retrieves all refunds issued for a reservation
 
 	// Start the server on port 8082
 	handler := cors.Default().Handler(r)
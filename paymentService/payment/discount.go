@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+)
+
+// errPromoCodeInvalid is returned when a promo code does not exist or is not valid today
+var errPromoCodeInvalid = errors.New("promo code is invalid or expired")
+
+// errPromoCodeMismatch is returned when a reservation booked with a quoted promo code is paid with another
+var errPromoCodeMismatch = errors.New("reservation was booked with a different promo code")
+
+// bookedPromoCode returns the promo code a reservation is discounted with: the one of the quote it
+// was booked with, which cannot be swapped for another, or else the one given at checkout
+func bookedPromoCode(booked sql.NullString, given string) (string, error) {
+	if !booked.Valid {
+		return given, nil
+	}
+	if given != "" && given != booked.String {
+		return "", errPromoCodeMismatch
+	}
+	return booked.String, nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// rentalDiscount is the membership and promo code discount on a rental cost
+type rentalDiscount struct {
+	membershipTier    string
+	membershipPercent float64
+	membership        float64
+	promoPercent      float64
+	promo             float64
+}
+
+// total returns the combined discount
+func (d rentalDiscount) total() float64 {
+	return d.membership + d.promo
+}
+
+// rentalDiscounts works out the membership and promo code discounts on a rental cost from the
+// user's membership tier, whose discount is read from MembershipTiers, and the promo code, if
+// given. As in price quotes, the membership discount is taken first and the promo code applies
+// to the rest.
+func rentalDiscounts(q queryer, userID int, promoCode string, rentalCost float64) (rentalDiscount, error) {
+	var discount rentalDiscount
+	err := q.QueryRow(`
+        SELECT u.membership_tier, COALESCE(t.discount_percent, 0)
+        FROM ElectriGo_AccountDB.Users u
+        LEFT JOIN ElectriGo_AccountDB.MembershipTiers t ON t.membership_tier = u.membership_tier
+        WHERE u.user_id = ?`, userID).Scan(&discount.membershipTier, &discount.membershipPercent)
+	if err != nil {
+		return discount, err
+	}
+
+	if promoCode != "" {
+		err = q.QueryRow("SELECT discount_percentage FROM Promotions WHERE promo_code = ? AND CURDATE() BETWEEN valid_from AND valid_until", promoCode).Scan(&discount.promoPercent)
+		if err == sql.ErrNoRows {
+			return discount, errPromoCodeInvalid
+		} else if err != nil {
+			return discount, err
+		}
+	}
+
+	discount.membership = math.Round(rentalCost*discount.membershipPercent) / 100
+	discount.promo = math.Round((rentalCost-discount.membership)*discount.promoPercent) / 100
+	return discount, nil
+}
@@ -0,0 +1,211 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// groupMember is an unpaid reservation of a group booking
+type groupMember struct {
+	reservationID int
+	totalCost     float64
+}
+
+// makeGroupPayment pays for every unpaid reservation of a group booking on one combined invoice.
+// The membership and promo code discounts are worked out on the reservations' rental cost and
+// shared between the reservations in proportion to their cost, and each reservation's share is
+// recorded as a Rental line item so that it can be refunded on its own when that reservation is
+// cancelled.
+func makeGroupPayment(w http.ResponseWriter, paymentReq paymentRequest) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the group's reservations so their holds cannot expire while the payment is being recorded
+	rows, err := tx.Query(`
+        SELECT reservation_id, status, total_cost, COALESCE(hold_expires_at <= ?, FALSE)
+        FROM ElectriGo_VehicleDB.Reservations
+        WHERE group_id = ?
+        ORDER BY reservation_id
+        FOR UPDATE`, time.Now(), paymentReq.GroupID)
+	if err != nil {
+		log.Println("Error fetching group reservations:", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	expiredID := 0
+	var members []groupMember
+	for rows.Next() {
+		var member groupMember
+		var status string
+		var holdExpired bool
+		if err := rows.Scan(&member.reservationID, &status, &member.totalCost, &holdExpired); err != nil {
+			rows.Close()
+			log.Println("Error scanning group reservation:", err)
+			http.Error(w, "Error processing payment", http.StatusInternalServerError)
+			return
+		}
+		found = true
+		if status != "Pending" {
+			continue
+		}
+		if holdExpired {
+			expiredID = member.reservationID
+		}
+		members = append(members, member)
+	}
+	rows.Close()
+
+	if !found {
+		http.Error(w, "Group booking not found", http.StatusNotFound)
+		return
+	}
+	if expiredID != 0 {
+		http.Error(w, fmt.Sprintf("The hold on reservation %d has expired; please book again", expiredID), http.StatusConflict)
+		return
+	}
+	if len(members) == 0 {
+		http.Error(w, "No reservations in this group booking are awaiting payment", http.StatusConflict)
+		return
+	}
+
+	var userEmail, userName string
+	err = tx.QueryRow("SELECT email, CONCAT(first_name, ' ', last_name) FROM ElectriGo_AccountDB.Users WHERE user_id = ?", paymentReq.UserID).Scan(&userEmail, &userName)
+	if err != nil {
+		log.Println("Error fetching user details:", err)
+		http.Error(w, "Error fetching user details", http.StatusInternalServerError)
+		return
+	}
+
+	// Line items added before payment (e.g. charging sessions) are billed on this invoice
+	placeholders := "?" + strings.Repeat(", ?", len(members)-1)
+	reservationIDs := make([]interface{}, len(members))
+	rentalCost := 0.0
+	for i, member := range members {
+		reservationIDs[i] = member.reservationID
+		rentalCost += member.totalCost
+	}
+	var pendingLineItems float64
+	err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM InvoiceLineItems WHERE invoice_id IS NULL AND reservation_id IN ("+placeholders+")", reservationIDs...).
+		Scan(&pendingLineItems)
+	if err != nil {
+		log.Println("Error fetching pending line items:", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	// Discounts apply to the rental cost only
+	rentalDiscount, err := rentalDiscounts(tx, paymentReq.UserID, paymentReq.PromoCode, rentalCost)
+	if err == errPromoCodeInvalid {
+		http.Error(w, "Promo code is invalid or expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error calculating discounts:", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	discount := math.Min(rentalDiscount.total(), rentalCost)
+	totalCost := math.Round((rentalCost+pendingLineItems)*100) / 100
+	finalAmount := math.Round((totalCost-discount)*100) / 100
+
+	result, err := tx.Exec(
+		"INSERT INTO Invoices (group_id, user_id, invoice_type, total_cost, membership_discount, promo_discount, final_amount) VALUES (?, ?, 'Rental', ?, ?, ?, ?)",
+		paymentReq.GroupID, paymentReq.UserID, totalCost, rentalDiscount.membership, rentalDiscount.promo, finalAmount,
+	)
+	if err != nil {
+		log.Println("Error creating invoice:", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	invoiceID, _ := result.LastInsertId()
+
+	_, err = tx.Exec("UPDATE InvoiceLineItems SET invoice_id = ? WHERE invoice_id IS NULL AND reservation_id IN ("+placeholders+")",
+		append([]interface{}{invoiceID}, reservationIDs...)...)
+	if err != nil {
+		log.Println("Error attaching line items to invoice:", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	// Record each reservation's share of the rental cost after discounts; the last one takes the
+	// rounding difference so the shares add up to the invoice
+	remainingDiscount := discount
+	for i, member := range members {
+		memberDiscount := remainingDiscount
+		if i < len(members)-1 && rentalCost > 0 {
+			memberDiscount = math.Round(discount*member.totalCost/rentalCost*100) / 100
+		}
+		remainingDiscount -= memberDiscount
+		share := math.Round((member.totalCost-memberDiscount)*100) / 100
+
+		_, err := tx.Exec("INSERT INTO InvoiceLineItems (reservation_id, invoice_id, item_type, description, amount) VALUES (?, ?, 'Rental', ?, ?)",
+			member.reservationID, invoiceID, fmt.Sprintf("Vehicle rental for reservation #%d", member.reservationID), share)
+		if err != nil {
+			log.Println("Error recording reservation share of group invoice:", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec("UPDATE ElectriGo_VehicleDB.Reservations SET total_cost = ? WHERE reservation_id = ?", share, member.reservationID)
+		if err != nil {
+			log.Printf("Error updating reservation total cost: %v", err)
+			http.Error(w, "Error updating reservation total cost", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Record the payment transaction
+	_, err = tx.Exec("INSERT INTO PaymentTransactions (user_id, invoice_id, payment_method, payment_status) VALUES (?, ?, ?, 'Completed')",
+		paymentReq.UserID, invoiceID, paymentReq.PaymentMethod)
+	if err != nil {
+		log.Println("Error processing payment:", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+
+	// Payment confirms every pending reservation of the group and ends their holds
+	_, err = tx.Exec("UPDATE ElectriGo_VehicleDB.Reservations SET status = 'Confirmed', hold_expires_at = NULL WHERE group_id = ? AND status = 'Pending'", paymentReq.GroupID)
+	if err != nil {
+		log.Printf("Error confirming group booking %d: %v", paymentReq.GroupID, err)
+		http.Error(w, "Error confirming reservations", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error confirming group booking %d: %v", paymentReq.GroupID, err)
+		http.Error(w, "Error confirming reservations", http.StatusInternalServerError)
+		return
+	}
+
+	invoice := Invoice{
+		InvoiceID:          int(invoiceID),
+		GroupID:            &paymentReq.GroupID,
+		UserID:             paymentReq.UserID,
+		InvoiceType:        "Rental",
+		TotalCost:          totalCost,
+		MembershipDiscount: rentalDiscount.membership,
+		PromoDiscount:      rentalDiscount.promo,
+		FinalAmount:        finalAmount,
+		IssuedAt:           time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err := SendInvoiceEmail(invoice, rentalDiscount.promo, userEmail, userName); err != nil {
+		log.Printf("Error sending invoice email: %v", err)
+		// Continue; don't fail the entire operation if email fails
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      fmt.Sprintf("Payment processed successfully for %d reservations.", len(members)),
+		"invoice_id":   invoiceID,
+		"final_amount": finalAmount,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"time"
@@ -38,11 +39,15 @@ type Payment struct {
 	UserID        int    `json:"user_id"`
 }
 
-// Invoice Struct
+// Invoice Struct. Each paid reservation has one Rental invoice, or shares the combined Rental
+// invoice of its group booking, and charges raised after the rental has ended, such as
+// late-return penalties, are billed on Supplementary invoices.
 type Invoice struct {
 	InvoiceID          int     `json:"invoice_id"`
-	ReservationID      int     `json:"reservation_id"`
+	ReservationID      *int    `json:"reservation_id"` // NULL on the combined invoice of a group booking
+	GroupID            *int    `json:"group_id,omitempty"`
 	UserID             int     `json:"user_id"`
+	InvoiceType        string  `json:"invoice_type"`
 	TotalCost          float64 `json:"total_cost"`
 	MembershipDiscount float64 `json:"membership_discount"`
 	PromoDiscount      float64 `json:"promo_discount"`
@@ -58,6 +63,45 @@ type Promotion struct {
 	ValidUntil         string  `json:"valid_until"`
 }
 
+// LineItem struct represents an additional charge on a reservation's invoice,
+// such as energy used in charging sessions
+type LineItem struct {
+	LineItemID    int     `json:"line_item_id"`
+	ReservationID int     `json:"reservation_id"`
+	InvoiceID     *int    `json:"invoice_id,omitempty"`
+	ItemType      string  `json:"item_type"`
+	Description   string  `json:"description"`
+	Amount        float64 `json:"amount"`
+	RequestKey    string  `json:"request_key,omitempty"` // A charge sent again with the same key is only added once
+	CreatedAt     string  `json:"created_at"`
+}
+
+// Refund struct represents money returned to the user against a reservation's invoice
+type Refund struct {
+	RefundID      int     `json:"refund_id"`
+	InvoiceID     int     `json:"invoice_id"`
+	ReservationID int     `json:"reservation_id"`
+	Amount        float64 `json:"amount"`
+	Reason        string  `json:"reason"`
+	RequestKey    string  `json:"request_key,omitempty"` // A refund sent again with the same key is only paid once
+	CreatedAt     string  `json:"created_at"`
+}
+
+// rentalInvoiceOf is an SQL condition matching the Rental invoice that bills a reservation, its
+// own or its group booking's, taking the reservation ID twice
+const rentalInvoiceOf = `invoice_type = 'Rental'
+        AND (reservation_id = ? OR group_id = (SELECT group_id FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ?))`
+
+// Line item types that can be charged to a reservation, matching the InvoiceLineItems table. Rental
+// items are only created for each reservation's share of a group invoice.
+var lineItemTypes = map[string]bool{
+	"Charging":     true,
+	"GeofenceFee":  true,
+	"Extension":    true,
+	"Modification": true,
+	"LateReturn":   true,
+}
+
 // Function to create an invoice for a reservation
 func CreateInvoice(reservationID int, userID int, totalCost float64, discount float64) (int64, error) {
 	finalAmount := totalCost - discount
@@ -74,45 +118,112 @@ func CreateInvoice(reservationID int, userID int, totalCost float64, discount fl
 	return invoiceID, nil
 }
 
-func MakePayment(w http.ResponseWriter, r *http.Request) {
-	var paymentReq struct {
-		ReservationID      int     `json:"reservation_id"`
-		PaymentMethod      string  `json:"payment_method"`
-		UserID             int     `json:"user_id"`
-		TotalCost          float64 `json:"total_cost"`          // Total cost calculated by the frontend
-		MembershipDiscount float64 `json:"membership_discount"` // Membership discount from frontend
-		PromoDiscount      float64 `json:"promo_discount"`      // Promo discount from frontend
-	}
+// paymentRequest is the request body for paying for a reservation or a group booking
+type paymentRequest struct {
+	ReservationID int    `json:"reservation_id"`
+	GroupID       int    `json:"group_id"` // Pays for every reservation of a group booking instead
+	PaymentMethod string `json:"payment_method"`
+	UserID        int    `json:"user_id"`
+	PromoCode     string `json:"promo_code"` // Optional; discounts are worked out from it and the membership tier
+}
 
+func MakePayment(w http.ResponseWriter, r *http.Request) {
+	var paymentReq paymentRequest
 	err := json.NewDecoder(r.Body).Decode(&paymentReq)
 	if err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
+	if paymentReq.GroupID != 0 {
+		makeGroupPayment(w, paymentReq)
+		return
+	}
+
+	// Lock the reservation so its hold cannot expire while the payment is being recorded
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Cancelled, missed and expired reservations can no longer be paid for
+	var reservationStatus string
+	var holdExpired bool
+	var groupID *int
+	var rentalCost float64
+	var bookedPromo sql.NullString
+	err = tx.QueryRow("SELECT status, COALESCE(hold_expires_at <= ?, FALSE), group_id, total_cost, promo_code FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ? FOR UPDATE", time.Now(), paymentReq.ReservationID).
+		Scan(&reservationStatus, &holdExpired, &groupID, &rentalCost, &bookedPromo)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error fetching reservation status:", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+	if reservationStatus == "Cancelled" || reservationStatus == "NoShow" || reservationStatus == "Expired" {
+		http.Error(w, fmt.Sprintf("A %s reservation cannot be paid for", reservationStatus), http.StatusConflict)
+		return
+	}
+	if reservationStatus == "Pending" && holdExpired {
+		http.Error(w, "The hold on this reservation has expired; please book again", http.StatusConflict)
+		return
+	}
+	if groupID != nil {
+		http.Error(w, fmt.Sprintf("This reservation is part of group booking %d; pay for the group instead", *groupID), http.StatusConflict)
+		return
+	}
 
 	// Check if an invoice already exists for the reservation
 	var existingInvoiceID int
-	err = db.QueryRow("SELECT invoice_id FROM Invoices WHERE reservation_id = ?", paymentReq.ReservationID).Scan(&existingInvoiceID)
+	var newInvoice *Invoice
+	var userEmail, userName string
+	err = tx.QueryRow("SELECT invoice_id FROM Invoices WHERE reservation_id = ? AND invoice_type = 'Rental'", paymentReq.ReservationID).Scan(&existingInvoiceID)
 
 	if err == sql.ErrNoRows {
 		// Create a new invoice if none exists
 
 		// Fetch user email and name
-		var userEmail, userName string
-		err = db.QueryRow("SELECT email, CONCAT(first_name, ' ', last_name) FROM ElectriGo_AccountDB.Users WHERE user_id = ?", paymentReq.UserID).Scan(&userEmail, &userName)
+		err = tx.QueryRow("SELECT email, CONCAT(first_name, ' ', last_name) FROM ElectriGo_AccountDB.Users WHERE user_id = ?", paymentReq.UserID).Scan(&userEmail, &userName)
 		if err != nil {
 			log.Println("Error fetching user details:", err)
 			http.Error(w, "Error fetching user details", http.StatusInternalServerError)
 			return
 		}
 
-		// Calculate the final amount based on discounts
-		finalAmount := paymentReq.TotalCost - paymentReq.MembershipDiscount - paymentReq.PromoDiscount
+		// Line items added before payment (e.g. charging sessions) are billed on this invoice
+		pendingLineItems, err := pendingLineItemTotal(tx, paymentReq.ReservationID)
+		if err != nil {
+			log.Println("Error fetching pending line items:", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+
+		// The reservation's rental cost, as quoted at booking, is discounted; line items are not
+		promoCode, err := bookedPromoCode(bookedPromo, paymentReq.PromoCode)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("This reservation was booked with promo code %s and cannot be paid with another", bookedPromo.String), http.StatusConflict)
+			return
+		}
+		discount, err := rentalDiscounts(tx, paymentReq.UserID, promoCode, rentalCost)
+		if err == errPromoCodeInvalid {
+			http.Error(w, "Promo code is invalid or expired", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error calculating discounts:", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+		totalCost := math.Round((rentalCost+pendingLineItems)*100) / 100
+		finalAmount := math.Round((totalCost-discount.total())*100) / 100
 
 		// Create the invoice
-		result, err := db.Exec(
+		result, err := tx.Exec(
 			"INSERT INTO Invoices (reservation_id, user_id, total_cost, membership_discount, promo_discount, final_amount) VALUES (?, ?, ?, ?, ?, ?)",
-			paymentReq.ReservationID, paymentReq.UserID, paymentReq.TotalCost, paymentReq.MembershipDiscount, paymentReq.PromoDiscount, finalAmount,
+			paymentReq.ReservationID, paymentReq.UserID, totalCost, discount.membership, discount.promo, finalAmount,
 		)
 		if err != nil {
 			log.Println("Error creating invoice:", err)
@@ -123,26 +234,28 @@ func MakePayment(w http.ResponseWriter, r *http.Request) {
 		invoiceID, _ := result.LastInsertId()
 		existingInvoiceID = int(invoiceID)
 
-		// Send the invoice email
-		invoice := Invoice{
+		_, err = tx.Exec("UPDATE InvoiceLineItems SET invoice_id = ? WHERE reservation_id = ? AND invoice_id IS NULL", existingInvoiceID, paymentReq.ReservationID)
+		if err != nil {
+			log.Println("Error attaching line items to invoice:", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+
+		// The invoice is emailed once the payment is committed
+		newInvoice = &Invoice{
 			InvoiceID:          existingInvoiceID,
-			ReservationID:      paymentReq.ReservationID,
+			ReservationID:      &paymentReq.ReservationID,
 			UserID:             paymentReq.UserID,
-			TotalCost:          paymentReq.TotalCost,
-			MembershipDiscount: paymentReq.MembershipDiscount,
-			PromoDiscount:      paymentReq.PromoDiscount,
+			InvoiceType:        "Rental",
+			TotalCost:          totalCost,
+			MembershipDiscount: discount.membership,
+			PromoDiscount:      discount.promo,
 			FinalAmount:        finalAmount,
 			IssuedAt:           time.Now().Format("2006-01-02 15:04:05"),
 		}
 
-		err = SendInvoiceEmail(invoice, paymentReq.PromoDiscount, userEmail, userName)
-		if err != nil {
-			log.Printf("Error sending invoice email: %v", err)
-			// Continue; don't fail the entire operation if email fails
-		}
-
 		// Update the reservation's total cost
-		_, err = db.Exec(
+		_, err = tx.Exec(
 			"UPDATE ElectriGo_VehicleDB.Reservations SET total_cost = ? WHERE reservation_id = ?",
 			finalAmount, paymentReq.ReservationID,
 		)
@@ -158,7 +271,7 @@ func MakePayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Record the payment transaction
-	_, err = db.Exec("INSERT INTO PaymentTransactions (user_id, invoice_id, payment_method, payment_status) VALUES (?, ?, ?, 'Completed')",
+	_, err = tx.Exec("INSERT INTO PaymentTransactions (user_id, invoice_id, payment_method, payment_status) VALUES (?, ?, ?, 'Completed')",
 		paymentReq.UserID, existingInvoiceID, paymentReq.PaymentMethod)
 	if err != nil {
 		log.Println("Error processing payment:", err)
@@ -166,6 +279,26 @@ func MakePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Payment confirms a pending reservation and ends its hold
+	_, err = tx.Exec("UPDATE ElectriGo_VehicleDB.Reservations SET status = 'Confirmed', hold_expires_at = NULL WHERE reservation_id = ? AND status = 'Pending'", paymentReq.ReservationID)
+	if err != nil {
+		log.Printf("Error confirming reservation %d: %v", paymentReq.ReservationID, err)
+		http.Error(w, "Error confirming reservation", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error confirming reservation %d: %v", paymentReq.ReservationID, err)
+		http.Error(w, "Error confirming reservation", http.StatusInternalServerError)
+		return
+	}
+
+	if newInvoice != nil {
+		if err := SendInvoiceEmail(*newInvoice, newInvoice.PromoDiscount, userEmail, userName); err != nil {
+			log.Printf("Error sending invoice email: %v", err)
+			// Continue; don't fail the entire operation if email fails
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -173,6 +306,14 @@ func MakePayment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// pendingLineItemTotal returns the total of the line items added to a reservation before it is
+// invoiced, which are billed on its invoice without discounts
+func pendingLineItemTotal(q queryer, reservationID int) (float64, error) {
+	var total float64
+	err := q.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM InvoiceLineItems WHERE reservation_id = ? AND invoice_id IS NULL", reservationID).Scan(&total)
+	return total, err
+}
+
 // GetInvoicesByUser fetches all invoices for a specific user
 func GetInvoicesByUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -180,7 +321,7 @@ func GetInvoicesByUser(w http.ResponseWriter, r *http.Request) {
 
 	var invoices []Invoice
 	query := `
-        SELECT invoice_id, reservation_id, user_id, total_cost, membership_discount, final_amount, issued_at
+        SELECT invoice_id, reservation_id, group_id, user_id, invoice_type, total_cost, membership_discount, final_amount, issued_at
         FROM Invoices
         WHERE user_id = ?
     `
@@ -195,7 +336,7 @@ func GetInvoicesByUser(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var invoice Invoice
-		if err := rows.Scan(&invoice.InvoiceID, &invoice.ReservationID, &invoice.UserID, &invoice.TotalCost, &invoice.MembershipDiscount, &invoice.FinalAmount, &invoice.IssuedAt); err != nil {
+		if err := rows.Scan(&invoice.InvoiceID, &invoice.ReservationID, &invoice.GroupID, &invoice.UserID, &invoice.InvoiceType, &invoice.TotalCost, &invoice.MembershipDiscount, &invoice.FinalAmount, &invoice.IssuedAt); err != nil {
 			log.Printf("Error scanning invoice data: %v", err)
 			http.Error(w, "Error processing invoices", http.StatusInternalServerError)
 			return
@@ -214,6 +355,14 @@ func GetInvoicesByUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func SendInvoiceEmail(invoice Invoice, promoDiscount float64, userEmail string, userName string) error {
+	// The invoice is for a reservation, or for every reservation of a group booking
+	booking := ""
+	if invoice.ReservationID != nil {
+		booking = fmt.Sprintf("Reservation #%d", *invoice.ReservationID)
+	} else if invoice.GroupID != nil {
+		booking = fmt.Sprintf("Group Booking #%d", *invoice.GroupID)
+	}
+
 	// Construct the email body with detailed invoice information
 	emailBody := fmt.Sprintf(`
 		<h2>ElectriGo Invoice</h2>
@@ -223,7 +372,7 @@ func SendInvoiceEmail(invoice Invoice, promoDiscount float64, userEmail string,
 		<table border="1" cellpadding="5" cellspacing="0">
 			<tr>
 				<th>Invoice ID</th>
-				<th>Reservation ID</th>
+				<th>Booking</th>
 				<th>Base Cost</th>
 				<th>Membership Discount</th>
 				<th>Promo Discount</th>
@@ -232,7 +381,7 @@ func SendInvoiceEmail(invoice Invoice, promoDiscount float64, userEmail string,
 			</tr>
 			<tr>
 				<td>%d</td>
-				<td>%d</td>
+				<td>%s</td>
 				<td>$%.2f</td>
 				<td>-$%.2f</td>
 				<td>-$%.2f</td>
@@ -243,13 +392,13 @@ func SendInvoiceEmail(invoice Invoice, promoDiscount float64, userEmail string,
 		
 		<p>If you have any questions, feel free to contact us at support@electrigo.com or from the sender email address.</p>
 		<p>Thank you for choosing ElectriGo!</p>
-	`, userName, invoice.InvoiceID, invoice.ReservationID, invoice.TotalCost, invoice.MembershipDiscount, promoDiscount, invoice.FinalAmount, invoice.IssuedAt)
+	`, userName, invoice.InvoiceID, booking, invoice.TotalCost, invoice.MembershipDiscount, promoDiscount, invoice.FinalAmount, invoice.IssuedAt)
 
 	// Set up the email message
 	mail := gomail.NewMessage()
 	mail.SetHeader("From", os.Getenv("GMAIL_EMAIL"))
 	mail.SetHeader("To", userEmail)
-	mail.SetHeader("Subject", fmt.Sprintf("ElectriGo Invoice for Reservation #%d", invoice.ReservationID))
+	mail.SetHeader("Subject", fmt.Sprintf("ElectriGo Invoice for %s", booking))
 	mail.SetBody("text/html", emailBody)
 
 	// Configure the SMTP server
@@ -264,6 +413,8 @@ func SendInvoiceEmail(invoice Invoice, promoDiscount float64, userEmail string,
 	return nil
 }
 
+// ApplyPromoCode previews the discounts a promo code gives on an unpaid reservation. Nothing is
+// saved: the promo code is given again at payment, when the discounts are worked out the same way.
 func ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
 	type PromoRequest struct {
 		PromoCode     string `json:"promo_code"`
@@ -273,6 +424,8 @@ func ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
 	type PromoResponse struct {
 		DiscountPercentage  float64 `json:"discount_percentage"`
 		DiscountAmount      float64 `json:"discount_amount"`
+		MembershipDiscount  float64 `json:"membership_discount"`
+		TotalCost           float64 `json:"total_cost"` // Rental cost and line items before discounts
 		TotalCostAfterPromo float64 `json:"total_cost_after_promo"`
 	}
 
@@ -288,13 +441,15 @@ func ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 1: Fetch reservation total cost
-	var totalCost float64
+	// Step 1: Fetch the reservation's rental cost, which stays undiscounted until payment
+	var userID int
+	var rentalCost float64
+	var bookedPromo sql.NullString
 	err := db.QueryRow(`
-        SELECT total_cost 
+        SELECT user_id, total_cost, promo_code 
         FROM ElectriGo_VehicleDB.Reservations 
         WHERE reservation_id = ?
-    `, req.ReservationID).Scan(&totalCost)
+    `, req.ReservationID).Scan(&userID, &rentalCost, &bookedPromo)
 
 	if err == sql.ErrNoRows {
 		log.Printf("Reservation %d not found", req.ReservationID)
@@ -306,49 +461,430 @@ func ApplyPromoCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 2: Validate promo code
-	var discountPercentage float64
-	var validFrom, validUntil string
-	err = db.QueryRow(`
-        SELECT discount_percentage, valid_from, valid_until 
-        FROM Promotions 
-        WHERE promo_code = ? AND CURDATE() BETWEEN valid_from AND valid_until
-    `, req.PromoCode).Scan(&discountPercentage, &validFrom, &validUntil)
+	var invoiced bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM Invoices WHERE "+rentalInvoiceOf+")", req.ReservationID, req.ReservationID).Scan(&invoiced)
+	if err != nil {
+		log.Printf("Error checking for existing invoice: %v", err)
+		http.Error(w, "Error fetching reservation", http.StatusInternalServerError)
+		return
+	}
+	if invoiced {
+		http.Error(w, "This reservation has already been paid for", http.StatusConflict)
+		return
+	}
 
-	if err == sql.ErrNoRows {
+	// Step 2: Validate the promo code and work out the discounts as payment does
+	if _, err := bookedPromoCode(bookedPromo, req.PromoCode); err != nil {
+		http.Error(w, fmt.Sprintf("This reservation was booked with promo code %s and cannot be paid with another", bookedPromo.String), http.StatusConflict)
+		return
+	}
+	discount, err := rentalDiscounts(db, userID, req.PromoCode, rentalCost)
+	if err == errPromoCodeInvalid {
 		log.Printf("Invalid or expired promo code: %s", req.PromoCode)
 		http.Error(w, "Promo code is invalid or expired", http.StatusNotFound)
 		return
 	} else if err != nil {
-		log.Printf("Error fetching promo code: %v", err)
+		log.Printf("Error calculating discounts: %v", err)
 		http.Error(w, "Error validating promo code", http.StatusInternalServerError)
 		return
 	}
+	pendingLineItems, err := pendingLineItemTotal(db, req.ReservationID)
+	if err != nil {
+		log.Printf("Error fetching pending line items: %v", err)
+		http.Error(w, "Error fetching reservation", http.StatusInternalServerError)
+		return
+	}
+	totalCost := math.Round((rentalCost+pendingLineItems)*100) / 100
 
-	// Step 3: Calculate discount and updated cost
-	discountAmount := totalCost * (discountPercentage / 100)
-	totalCostAfterPromo := totalCost - discountAmount
+	// Step 3: Respond with discount details
+	response := PromoResponse{
+		DiscountPercentage:  discount.promoPercent,
+		DiscountAmount:      discount.promo,
+		MembershipDiscount:  discount.membership,
+		TotalCost:           totalCost,
+		TotalCostAfterPromo: math.Round((totalCost-discount.total())*100) / 100,
+	}
 
-	// Step 4: Update the reservation total cost in the database
-	_, err = db.Exec(`
-        UPDATE ElectriGo_VehicleDB.Reservations 
-        SET total_cost = ? 
-        WHERE reservation_id = ?
-    `, totalCostAfterPromo, req.ReservationID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AddLineItem adds a charge to a reservation. If the reservation has already been invoiced the
+// charge is added to that invoice, otherwise it is billed when the invoice is created at payment.
+func AddLineItem(w http.ResponseWriter, r *http.Request) {
+	var item LineItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		log.Printf("Error decoding line item: %v", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if item.ReservationID == 0 || item.Description == "" || item.Amount <= 0 {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	if !lineItemTypes[item.ItemType] {
+		http.Error(w, "Invalid line item type", http.StatusBadRequest)
+		return
+	}
 
+	var reservationExists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ?)", item.ReservationID).Scan(&reservationExists)
 	if err != nil {
-		log.Printf("Error updating reservation total cost in Reservations table: %v", err)
-		http.Error(w, "Error updating reservation total cost", http.StatusInternalServerError)
+		log.Printf("Error checking reservation: %v", err)
+		http.Error(w, "Error adding line item", http.StatusInternalServerError)
+		return
+	}
+	if !reservationExists {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
 		return
 	}
 
-	// Step 5: Respond with discount details
-	response := PromoResponse{
-		DiscountPercentage:  discountPercentage,
-		DiscountAmount:      discountAmount,
-		TotalCostAfterPromo: totalCostAfterPromo,
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting line item transaction: %v", err)
+		http.Error(w, "Error adding line item", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var invoiceID sql.NullInt64
+	err = tx.QueryRow("SELECT invoice_id FROM Invoices WHERE "+rentalInvoiceOf+" FOR UPDATE", item.ReservationID, item.ReservationID).Scan(&invoiceID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking for existing invoice: %v", err)
+		http.Error(w, "Error adding line item", http.StatusInternalServerError)
+		return
+	}
+
+	// A retried charge returns the line item added the first time
+	if item.RequestKey != "" {
+		var lineItemID int
+		err := tx.QueryRow("SELECT line_item_id, invoice_id FROM InvoiceLineItems WHERE request_key = ?", item.RequestKey).Scan(&lineItemID, &invoiceID)
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":      "Line item already added",
+				"line_item_id": lineItemID,
+				"invoiced":     invoiceID.Valid,
+			})
+			return
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error checking for existing line item: %v", err)
+			http.Error(w, "Error adding line item", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := tx.Exec("INSERT INTO InvoiceLineItems (reservation_id, invoice_id, item_type, description, amount, request_key) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''))",
+		item.ReservationID, invoiceID, item.ItemType, item.Description, item.Amount, item.RequestKey)
+	if err != nil {
+		log.Printf("Error inserting line item: %v", err)
+		http.Error(w, "Error adding line item", http.StatusInternalServerError)
+		return
+	}
+	lineItemID, _ := result.LastInsertId()
+
+	// Add the charge to an invoice that has already been issued
+	if invoiceID.Valid {
+		_, err = tx.Exec("UPDATE Invoices SET total_cost = total_cost + ?, final_amount = final_amount + ? WHERE invoice_id = ?",
+			item.Amount, item.Amount, invoiceID.Int64)
+		if err != nil {
+			log.Printf("Error updating invoice totals: %v", err)
+			http.Error(w, "Error adding line item", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing line item: %v", err)
+		http.Error(w, "Error adding line item", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Line item added successfully",
+		"line_item_id": lineItemID,
+		"invoiced":     invoiceID.Valid,
+	})
+}
+
+// GetLineItemsByReservation fetches all line items charged to a reservation
+func GetLineItemsByReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := mux.Vars(r)["reservation_id"]
+
+	rows, err := db.Query("SELECT line_item_id, reservation_id, invoice_id, item_type, description, amount, created_at FROM InvoiceLineItems WHERE reservation_id = ? ORDER BY created_at", reservationID)
+	if err != nil {
+		log.Printf("Error fetching line items for reservation %s: %v", reservationID, err)
+		http.Error(w, "Error fetching line items", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []LineItem{}
+	for rows.Next() {
+		var item LineItem
+		var invoiceID sql.NullInt64
+		if err := rows.Scan(&item.LineItemID, &item.ReservationID, &invoiceID, &item.ItemType, &item.Description, &item.Amount, &item.CreatedAt); err != nil {
+			log.Printf("Error scanning line item: %v", err)
+			http.Error(w, "Error fetching line items", http.StatusInternalServerError)
+			return
+		}
+		if invoiceID.Valid {
+			id := int(invoiceID.Int64)
+			item.InvoiceID = &id
+		}
+		items = append(items, item)
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(items)
+}
+
+// CreateSupplementaryInvoice bills charges raised after a rental has ended, such as a late-return
+// penalty, on a new Supplementary invoice for the reservation and emails it to the renter
+func CreateSupplementaryInvoice(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ReservationID int        `json:"reservation_id"`
+		LineItems     []LineItem `json:"line_items"`
+		RequestKey    string     `json:"request_key"` // Optional; a request sent again with the same key returns the first invoice
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding supplementary invoice: %v", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if request.ReservationID == 0 || len(request.LineItems) == 0 {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+	var totalCost float64
+	for _, item := range request.LineItems {
+		if item.Description == "" || item.Amount <= 0 {
+			http.Error(w, "Missing or invalid line item fields", http.StatusBadRequest)
+			return
+		}
+		if !lineItemTypes[item.ItemType] {
+			http.Error(w, "Invalid line item type", http.StatusBadRequest)
+			return
+		}
+		totalCost += item.Amount
+	}
+	totalCost = math.Round(totalCost*100) / 100
+
+	if request.RequestKey != "" {
+		var invoiceID int
+		var finalAmount float64
+		err := db.QueryRow("SELECT invoice_id, final_amount FROM Invoices WHERE request_key = ?", request.RequestKey).Scan(&invoiceID, &finalAmount)
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":      "Supplementary invoice already created",
+				"invoice_id":   invoiceID,
+				"final_amount": finalAmount,
+			})
+			return
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error checking for existing supplementary invoice: %v", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var userID int
+	var userEmail, userName string
+	err := db.QueryRow(`
+        SELECT u.user_id, u.email, CONCAT(u.first_name, ' ', u.last_name)
+        FROM ElectriGo_VehicleDB.Reservations r
+        JOIN ElectriGo_AccountDB.Users u ON r.user_id = u.user_id
+        WHERE r.reservation_id = ?`, request.ReservationID).Scan(&userID, &userEmail, &userName)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching reservation for supplementary invoice: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting supplementary invoice transaction: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO Invoices (reservation_id, user_id, invoice_type, total_cost, final_amount, request_key) VALUES (?, ?, 'Supplementary', ?, ?, NULLIF(?, ''))",
+		request.ReservationID, userID, totalCost, totalCost, request.RequestKey)
+	if err != nil {
+		log.Printf("Error creating supplementary invoice: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	invoiceID, _ := result.LastInsertId()
+
+	for _, item := range request.LineItems {
+		_, err := tx.Exec("INSERT INTO InvoiceLineItems (reservation_id, invoice_id, item_type, description, amount) VALUES (?, ?, ?, ?, ?)",
+			request.ReservationID, invoiceID, item.ItemType, item.Description, item.Amount)
+		if err != nil {
+			log.Printf("Error inserting supplementary line item: %v", err)
+			http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing supplementary invoice: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	invoice := Invoice{
+		InvoiceID:     int(invoiceID),
+		ReservationID: &request.ReservationID,
+		UserID:        userID,
+		InvoiceType:   "Supplementary",
+		TotalCost:     totalCost,
+		FinalAmount:   totalCost,
+		IssuedAt:      time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if err := SendInvoiceEmail(invoice, 0, userEmail, userName); err != nil {
+		log.Printf("Error sending supplementary invoice email: %v", err)
+		// Continue; don't fail the entire operation if email fails
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Supplementary invoice created successfully",
+		"invoice_id":   invoiceID,
+		"final_amount": totalCost,
+	})
+}
+
+// IssueRefund refunds part of a reservation's invoice. The refund is capped at the amount paid
+// less earlier refunds, and the amount actually refunded is returned.
+func IssueRefund(w http.ResponseWriter, r *http.Request) {
+	var refund Refund
+	if err := json.NewDecoder(r.Body).Decode(&refund); err != nil {
+		log.Printf("Error decoding refund: %v", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if refund.ReservationID == 0 || refund.Reason == "" || refund.Amount <= 0 {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting refund transaction: %v", err)
+		http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the invoice so concurrent refunds cannot together exceed the amount paid
+	var finalAmount float64
+	var groupID *int
+	err = tx.QueryRow("SELECT invoice_id, final_amount, group_id FROM Invoices WHERE "+rentalInvoiceOf+" FOR UPDATE", refund.ReservationID, refund.ReservationID).
+		Scan(&refund.InvoiceID, &finalAmount, &groupID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No invoice found for reservation", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching invoice for refund: %v", err)
+		http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+		return
+	}
+
+	// A retried refund returns the refund paid the first time
+	if refund.RequestKey != "" {
+		var refundID int
+		var amount float64
+		err := tx.QueryRow("SELECT refund_id, amount FROM Refunds WHERE request_key = ?", refund.RequestKey).Scan(&refundID, &amount)
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":   "Refund already issued",
+				"refund_id": refundID,
+				"amount":    amount,
+			})
+			return
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error checking for existing refund: %v", err)
+			http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// A reservation in a group booking can only be refunded its own share of the combined invoice
+	var refunded float64
+	if groupID == nil {
+		err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM Refunds WHERE invoice_id = ?", refund.InvoiceID).Scan(&refunded)
+	} else {
+		err = tx.QueryRow(`
+            SELECT COALESCE((SELECT SUM(amount) FROM InvoiceLineItems WHERE invoice_id = ? AND reservation_id = ?), 0),
+                   COALESCE((SELECT SUM(amount) FROM Refunds WHERE invoice_id = ? AND reservation_id = ?), 0)`,
+			refund.InvoiceID, refund.ReservationID, refund.InvoiceID, refund.ReservationID).Scan(&finalAmount, &refunded)
+	}
+	if err != nil {
+		log.Printf("Error fetching earlier refunds: %v", err)
+		http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+		return
+	}
+	refund.Amount = math.Round(math.Min(refund.Amount, finalAmount-refunded)*100) / 100
+	if refund.Amount <= 0 {
+		http.Error(w, "Invoice has already been fully refunded", http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO Refunds (invoice_id, reservation_id, amount, reason, request_key) VALUES (?, ?, ?, ?, NULLIF(?, ''))",
+		refund.InvoiceID, refund.ReservationID, refund.Amount, refund.Reason, refund.RequestKey)
+	if err != nil {
+		log.Printf("Error inserting refund: %v", err)
+		http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+		return
+	}
+	refundID, _ := result.LastInsertId()
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing refund: %v", err)
+		http.Error(w, "Error issuing refund", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Refund issued successfully",
+		"refund_id": refundID,
+		"amount":    refund.Amount,
+	})
+}
+
+// GetRefundsByReservation fetches all refunds issued for a reservation
+func GetRefundsByReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := mux.Vars(r)["reservation_id"]
+
+	rows, err := db.Query("SELECT refund_id, invoice_id, reservation_id, amount, reason, created_at FROM Refunds WHERE reservation_id = ? ORDER BY created_at", reservationID)
+	if err != nil {
+		log.Printf("Error fetching refunds for reservation %s: %v", reservationID, err)
+		http.Error(w, "Error fetching refunds", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		var refund Refund
+		if err := rows.Scan(&refund.RefundID, &refund.InvoiceID, &refund.ReservationID, &refund.Amount, &refund.Reason, &refund.CreatedAt); err != nil {
+			log.Printf("Error scanning refund: %v", err)
+			http.Error(w, "Error fetching refunds", http.StatusInternalServerError)
+			return
+		}
+		refunds = append(refunds, refund)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(refunds)
 }
@@ -0,0 +1,125 @@
+package payment
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the database named by ELECTRIGO_BILLING_TEST_DSN, skipping the test when it is not set.
+// The database must be loaded from seed.sql, e.g.
+// ELECTRIGO_BILLING_TEST_DSN="user:password@tcp(localhost:3306)/ElectriGo_BillingDB"
+func openTestDB(t *testing.T) {
+	dsn := os.Getenv("ELECTRIGO_BILLING_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ELECTRIGO_BILLING_TEST_DSN not set; skipping database test")
+	}
+	var err error
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+}
+
+// post calls a handler with a JSON body and returns the recorded response
+func post(handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload)))
+	return recorder
+}
+
+func TestPromoCodeIsDiscountedOnceAtPayment(t *testing.T) {
+	openTestDB(t)
+
+	// User 2 is a Premium member, with 10% off the rental cost
+	const userID = 2
+	const rentalCost = 100
+	promoCode := fmt.Sprintf("TEST%d", time.Now().UnixNano())
+
+	_, err := db.Exec("INSERT INTO Promotions (promo_code, discount_percentage, valid_from, valid_until) VALUES (?, 20, CURDATE(), CURDATE())", promoCode)
+	if err != nil {
+		t.Fatalf("creating promo code: %v", err)
+	}
+	start := time.Now().AddDate(5, 2, 0).Truncate(time.Hour)
+	result, err := db.Exec(`
+        INSERT INTO ElectriGo_VehicleDB.Reservations (user_id, vehicle_id, pickup_station_id, start_time, end_time, status, total_cost)
+        VALUES (?, 5, 4, ?, ?, 'Pending', ?)`, userID, start, start.Add(4*time.Hour), rentalCost)
+	if err != nil {
+		t.Fatalf("creating reservation: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	reservationID := int(id)
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM Invoices WHERE reservation_id = ?", reservationID)
+		db.Exec("DELETE FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ?", reservationID)
+		db.Exec("DELETE FROM Promotions WHERE promo_code = ?", promoCode)
+	})
+
+	// Applying the promo code previews the discounts, however often it is applied
+	for i := 0; i < 2; i++ {
+		recorder := post(ApplyPromoCode, map[string]interface{}{"promo_code": promoCode, "reservation_id": reservationID})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("applying promo code: %d %s", recorder.Code, recorder.Body.String())
+		}
+		var preview struct {
+			DiscountAmount      float64 `json:"discount_amount"`
+			MembershipDiscount  float64 `json:"membership_discount"`
+			TotalCostAfterPromo float64 `json:"total_cost_after_promo"`
+		}
+		json.NewDecoder(recorder.Body).Decode(&preview)
+		if preview.MembershipDiscount != 10 || preview.DiscountAmount != 18 || preview.TotalCostAfterPromo != 72 {
+			t.Errorf("preview %d: got %+v, want membership discount 10, promo discount 18 and total 72", i+1, preview)
+		}
+	}
+
+	// Checkout shows the payment preview, which must match the invoice
+	recorder := post(PreviewPayment, map[string]interface{}{"reservation_id": reservationID, "user_id": userID, "promo_code": promoCode})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("previewing payment: %d %s", recorder.Code, recorder.Body.String())
+	}
+	var preview PaymentPreview
+	json.NewDecoder(recorder.Body).Decode(&preview)
+	if preview.MembershipDiscountPercentage != 10 || preview.PromoDiscount != 18 || preview.FinalAmount != 72 {
+		t.Errorf("payment preview: got %+v, want a 10%% membership discount, promo discount 18 and final amount 72", preview)
+	}
+
+	var storedCost float64
+	if err := db.QueryRow("SELECT total_cost FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ?", reservationID).Scan(&storedCost); err != nil {
+		t.Fatal(err)
+	}
+	if storedCost != rentalCost {
+		t.Fatalf("applying the promo code changed the reservation's cost to %.2f", storedCost)
+	}
+
+	recorder = post(MakePayment, map[string]interface{}{
+		"reservation_id": reservationID,
+		"payment_method": "PayNow",
+		"user_id":        userID,
+		"promo_code":     promoCode,
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("paying: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	var totalCost, membershipDiscount, promoDiscount, finalAmount float64
+	err = db.QueryRow("SELECT total_cost, membership_discount, promo_discount, final_amount FROM Invoices WHERE reservation_id = ? AND invoice_type = 'Rental'", reservationID).
+		Scan(&totalCost, &membershipDiscount, &promoDiscount, &finalAmount)
+	if err != nil {
+		t.Fatalf("fetching invoice: %v", err)
+	}
+	if totalCost != 100 || membershipDiscount != 10 || promoDiscount != 18 || finalAmount != 72 {
+		t.Errorf("invoice: total %.2f, membership discount %.2f, promo discount %.2f, final amount %.2f, want 100, 10, 18 and 72",
+			totalCost, membershipDiscount, promoDiscount, finalAmount)
+	}
+}
@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// PaymentPreview is what paying for a reservation or group booking would charge, worked out as
+// MakePayment does so that checkout shows the amounts that will be invoiced
+type PaymentPreview struct {
+	MembershipTier               string  `json:"membership_tier"`
+	MembershipDiscountPercentage float64 `json:"membership_discount_percentage"`
+	MembershipDiscount           float64 `json:"membership_discount"`
+	PromoCode                    string  `json:"promo_code,omitempty"`
+	PromoDiscountPercentage      float64 `json:"promo_discount_percentage"`
+	PromoDiscount                float64 `json:"promo_discount"`
+	RentalCost                   float64 `json:"rental_cost"`
+	LineItems                    float64 `json:"line_items"` // Charges added before payment, which are not discounted
+	TotalCost                    float64 `json:"total_cost"` // Rental cost and line items before discounts
+	FinalAmount                  float64 `json:"final_amount"`
+}
+
+// PreviewPayment works out the invoice a payment would create for an unpaid reservation or the
+// unpaid reservations of a group booking, with the user's membership discount and the promo
+// code, if given; a reservation booked with a quoted promo code is previewed with that one.
+// Nothing is saved.
+func PreviewPayment(w http.ResponseWriter, r *http.Request) {
+	var req paymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 || (req.ReservationID == 0 && req.GroupID == 0) {
+		http.Error(w, "Missing or invalid input fields", http.StatusBadRequest)
+		return
+	}
+
+	var rentalCost, pendingLineItems float64
+	if req.GroupID != 0 {
+		rows, err := db.Query("SELECT reservation_id, total_cost FROM ElectriGo_VehicleDB.Reservations WHERE group_id = ? AND status = 'Pending'", req.GroupID)
+		if err != nil {
+			log.Println("Error fetching group reservations:", err)
+			http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+			return
+		}
+		var reservationIDs []interface{}
+		for rows.Next() {
+			var reservationID int
+			var totalCost float64
+			if err := rows.Scan(&reservationID, &totalCost); err != nil {
+				rows.Close()
+				log.Println("Error scanning group reservation:", err)
+				http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+				return
+			}
+			reservationIDs = append(reservationIDs, reservationID)
+			rentalCost += totalCost
+		}
+		rows.Close()
+		if len(reservationIDs) == 0 {
+			http.Error(w, "No reservations in this group booking are awaiting payment", http.StatusNotFound)
+			return
+		}
+
+		placeholders := "?" + strings.Repeat(", ?", len(reservationIDs)-1)
+		err = db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM InvoiceLineItems WHERE invoice_id IS NULL AND reservation_id IN ("+placeholders+")", reservationIDs...).
+			Scan(&pendingLineItems)
+		if err != nil {
+			log.Println("Error fetching pending line items:", err)
+			http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var groupID *int
+		var bookedPromo sql.NullString
+		err := db.QueryRow("SELECT total_cost, group_id, promo_code FROM ElectriGo_VehicleDB.Reservations WHERE reservation_id = ?", req.ReservationID).
+			Scan(&rentalCost, &groupID, &bookedPromo)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reservation not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error fetching reservation:", err)
+			http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+			return
+		}
+		if groupID != nil {
+			http.Error(w, "This reservation is part of a group booking; preview the group instead", http.StatusConflict)
+			return
+		}
+		req.PromoCode, err = bookedPromoCode(bookedPromo, req.PromoCode)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("This reservation was booked with promo code %s and cannot be paid with another", bookedPromo.String), http.StatusConflict)
+			return
+		}
+
+		var invoiced bool
+		err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM Invoices WHERE "+rentalInvoiceOf+")", req.ReservationID, req.ReservationID).Scan(&invoiced)
+		if err != nil {
+			log.Println("Error checking for existing invoice:", err)
+			http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+			return
+		}
+		if invoiced {
+			http.Error(w, "This reservation has already been paid for", http.StatusConflict)
+			return
+		}
+
+		pendingLineItems, err = pendingLineItemTotal(db, req.ReservationID)
+		if err != nil {
+			log.Println("Error fetching pending line items:", err)
+			http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	discount, err := rentalDiscounts(db, req.UserID, req.PromoCode, rentalCost)
+	if err == errPromoCodeInvalid {
+		http.Error(w, "Promo code is invalid or expired", http.StatusNotFound)
+		return
+	} else if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Error calculating discounts:", err)
+		http.Error(w, "Error previewing payment", http.StatusInternalServerError)
+		return
+	}
+	totalCost := math.Round((rentalCost+pendingLineItems)*100) / 100
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PaymentPreview{
+		MembershipTier:               discount.membershipTier,
+		MembershipDiscountPercentage: discount.membershipPercent,
+		MembershipDiscount:           discount.membership,
+		PromoCode:                    req.PromoCode,
+		PromoDiscountPercentage:      discount.promoPercent,
+		PromoDiscount:                discount.promo,
+		RentalCost:                   rentalCost,
+		LineItems:                    pendingLineItems,
+		TotalCost:                    totalCost,
+		FinalAmount:                  math.Round((totalCost-math.Min(discount.total(), rentalCost))*100) / 100,
+	})
+}
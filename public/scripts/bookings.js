@@ -6,7 +6,19 @@ document.addEventListener('DOMContentLoaded', async () => {
         return;
     }
 
-    const bookingsApiUrl = `http://localhost:8081/v1/bookings/user/${userId}`;
+    loadWaitlist(userId);
+    loadCalendarFeed(userId);
+    loadReservations(userId, 0);
+});
+
+// Number of reservations loaded at a time, newest first
+const reservationsPageSize = 12;
+
+// Function to load a page of the user's reservations, with a button to load the next page
+async function loadReservations(userId, offset) {
+    const bookingsApiUrl = `http://localhost:8081/v1/bookings/user/${userId}?sort=created_at&order=desc&limit=${reservationsPageSize}&offset=${offset}`;
+    const bookingsContainer = document.getElementById('bookingsContainer');
+    document.getElementById('loadMoreReservations')?.remove();
 
     try {
         const response = await fetch(bookingsApiUrl, {
@@ -16,8 +28,6 @@ document.addEventListener('DOMContentLoaded', async () => {
             },
         });
 
-        const bookingsContainer = document.getElementById('bookingsContainer');
-
         if (!response.ok) {
             // Display a message for fetch errors
             bookingsContainer.innerHTML = `<p class="text-danger">Failed to load reservations. Please try again later.</p>`;
@@ -26,19 +36,17 @@ document.addEventListener('DOMContentLoaded', async () => {
 
         const reservations = await response.json();
 
-        if (!Array.isArray(reservations) || reservations.length === 0) {
+        if (offset === 0 && (!Array.isArray(reservations) || reservations.length === 0)) {
             bookingsContainer.innerHTML = `<p class="text-muted">You have no reservations at the moment.</p>`;
             return;
         }
 
-        reservations.sort((a, b) => b.reservation_id - a.reservation_id);
-
         reservations.forEach((reservation) => {
             const reservationCard = document.createElement('div');
             reservationCard.classList.add('col-md-4', 'mb-4');
 
-            const isCompleted = reservation.status.toLowerCase() === 'completed';
-            const isCancelled = reservation.status.toLowerCase() === 'cancelled';
+            const status = reservation.status;
+            const canModify = status === 'Pending' || status === 'Confirmed';
 
             reservationCard.innerHTML = `
                 <div class="card">
@@ -49,10 +57,28 @@ document.addEventListener('DOMContentLoaded', async () => {
                             Start: ${formatDateTimeToDDMMYYYY(reservation.start_time)}<br>
                             End: ${formatDateTimeToDDMMYYYY(reservation.end_time)}<br>
                             Status: ${reservation.status}<br>
-                            Total Cost: $${reservation.total_cost.toFixed(2)}
+                            Total Cost: $${reservation.total_cost.toFixed(2)}<br>
+                            Payment: ${reservation.payment_status}<br>
+                            Booked: ${formatDateTimeToDDMMYYYY(reservation.created_at)}
                         </p>
                         ${
-                            !isCompleted && !isCancelled
+                            status === 'Pending'
+                                ? `<a class="btn btn-success mb-2" href="checkout.html?reservation_id=${reservation.reservation_id}">Pay Now</a>`
+                                : ''
+                        }
+                        ${
+                            status === 'Confirmed'
+                                ? `<button class="btn btn-success mb-2" onclick="handOverVehicle(${reservation.reservation_id}, 'pickup')">Pick Up</button>`
+                                : ''
+                        }
+                        ${
+                            status === 'InProgress'
+                                ? `<button class="btn btn-success mb-2" onclick="handOverVehicle(${reservation.reservation_id}, 'return')">Return Vehicle</button>`
+                                : ''
+                        }
+                        <a class="btn btn-outline-secondary mb-2" href="http://localhost:8081/v1/bookings/${reservation.reservation_id}/calendar.ics">Add to Calendar</a>
+                        ${
+                            canModify
                                 ? `
                                     <button class="btn btn-primary mb-2" onclick="openModifyInterface(
                                         ${reservation.reservation_id}, 
@@ -61,33 +87,176 @@ document.addEventListener('DOMContentLoaded', async () => {
                                     )">Modify</button>
                                     <button class="btn btn-danger" onclick="cancelReservation(${reservation.reservation_id})">Cancel</button>
                                 `
-                                : `
+                                : ''
+                        }
+                        ${
+                            status === 'Completed' || status === 'Cancelled' || status === 'NoShow' || status === 'Expired'
+                                ? `
                                     <p class="text-secondary">${
-                                        isCancelled
+                                        status === 'Cancelled'
                                             ? "This reservation has been cancelled."
-                                            : "This reservation is completed."
+                                            : status === 'NoShow'
+                                                ? "This reservation was not picked up."
+                                                : status === 'Expired'
+                                                    ? "This reservation expired because it was not paid for in time."
+                                                    : "This reservation is completed."
                                     }</p>
                                 `
+                                : ''
                         }
                     </div>
                 </div>
             `;
             bookingsContainer.appendChild(reservationCard);
         });
+
+        // A full page means there may be more reservations to load
+        if (reservations.length === reservationsPageSize) {
+            const loadMore = document.createElement('div');
+            loadMore.id = 'loadMoreReservations';
+            loadMore.classList.add('col-12', 'mb-4', 'text-center');
+            loadMore.innerHTML = `<button class="btn btn-outline-primary" onclick="loadReservations(${userId}, ${offset + reservations.length})">Load More</button>`;
+            bookingsContainer.appendChild(loadMore);
+        }
     } catch (error) {
         console.error('Error fetching reservations:', error);
-        document.getElementById('bookingsContainer').innerHTML = `<p class="text-danger">Failed to load reservations. Please try again later.</p>`;
+        bookingsContainer.innerHTML = `<p class="text-danger">Failed to load reservations. Please try again later.</p>`;
     }
-});
+}
+
+// Function to show the address of the user's calendar feed, for subscribing in a calendar app
+async function loadCalendarFeed(userId, reset = false) {
+    const calendarFeed = document.getElementById('calendarFeed');
+    try {
+        const response = await fetch(`http://localhost:8081/v1/calendar/user/${userId}${reset ? '/reset' : ''}`, {
+            method: reset ? 'PUT' : 'GET',
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+
+        const feed = await response.json();
+        calendarFeed.innerHTML = `
+            <p class="text-muted mb-1">Subscribe to this address in your calendar app to see your reservations, including any changes and cancellations:</p>
+            <input type="text" class="form-control mb-2" value="${feed.feed_url}" readonly onclick="this.select()">
+            <button class="btn btn-outline-secondary btn-sm" onclick="resetCalendarFeed()">Reset Address</button>
+        `;
+    } catch (error) {
+        console.error('Error fetching calendar feed:', error);
+        calendarFeed.innerHTML = `<p class="text-danger">Failed to load your calendar feed. Please try again later.</p>`;
+    }
+}
+
+// Function to replace the calendar feed address, e.g. after it was shared by mistake
+function resetCalendarFeed() {
+    if (!confirm("Calendars subscribed to the current address will stop updating. Reset the address?")) {
+        return;
+    }
+    loadCalendarFeed(localStorage.getItem('user_id'), true);
+}
+
+// Function to show the user's waitlist entries, with buttons to accept or decline offers
+async function loadWaitlist(userId) {
+    const waitlistContainer = document.getElementById('waitlistContainer');
+    try {
+        const response = await fetch(`http://localhost:8081/v1/waitlist/user/${userId}`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+
+        const entries = (await response.json()).filter(entry => entry.status === 'Waiting' || entry.status === 'Offered');
+        if (entries.length === 0) {
+            waitlistContainer.innerHTML = `<p class="text-muted">You are not on any waitlists.</p>`;
+            return;
+        }
+
+        entries.forEach((entry) => {
+            const entryCard = document.createElement('div');
+            entryCard.classList.add('col-md-4', 'mb-4');
+            const target = entry.vehicle_id ? `Vehicle ${entry.vehicle_id}` : `Any ${entry.vehicle_class} vehicle`;
+            entryCard.innerHTML = `
+                <div class="card">
+                    <div class="card-body">
+                        <h5 class="card-title">${target}</h5>
+                        <p class="card-text"><strong>Start:</strong> ${new Date(entry.start_time).toLocaleString()}</p>
+                        <p class="card-text"><strong>End:</strong> ${new Date(entry.end_time).toLocaleString()}</p>
+                        ${
+                            entry.status === 'Offered'
+                                ? `
+                                    <p class="text-success">Vehicle ${entry.offered_vehicle_id} is held for you until ${new Date(entry.offer_expires_at).toLocaleString()}.</p>
+                                    <button class="btn btn-success" onclick="respondToWaitlistOffer(${entry.waitlist_id}, 'accept')">Accept</button>
+                                    <button class="btn btn-danger" onclick="respondToWaitlistOffer(${entry.waitlist_id}, 'cancel')">Decline</button>
+                                `
+                                : `
+                                    <p class="text-secondary">Waiting for a vehicle to free up.</p>
+                                    <button class="btn btn-danger" onclick="respondToWaitlistOffer(${entry.waitlist_id}, 'cancel')">Leave Waitlist</button>
+                                `
+                        }
+                    </div>
+                </div>
+            `;
+            waitlistContainer.appendChild(entryCard);
+        });
+    } catch (error) {
+        console.error('Error fetching waitlist:', error);
+        waitlistContainer.innerHTML = `<p class="text-danger">Failed to load your waitlist. Please try again later.</p>`;
+    }
+}
+
+// Function to accept a waitlist offer, or to decline it and leave the waitlist
+async function respondToWaitlistOffer(waitlistId, action) {
+    const userId = localStorage.getItem('user_id');
+    try {
+        const response = await fetch(`http://localhost:8081/v1/waitlist/${waitlistId}/${action}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ user_id: parseInt(userId) }),
+        });
+
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+
+        if (action === 'accept') {
+            const data = await response.json();
+            alert('Offer accepted. Please complete payment to confirm your reservation.');
+            window.location.href = `checkout.html?reservation_id=${data.reservation_id}`;
+        } else {
+            alert('You have left the waitlist.');
+            window.location.reload();
+        }
+    } catch (error) {
+        console.error('Error responding to waitlist offer:', error);
+        alert(`Failed to update waitlist: ${error.message}`);
+    }
+}
 
 // Function to cancel a reservation
 async function cancelReservation(reservationId) {
-    if (!confirm(`Are you sure you want to cancel Reservation ID: ${reservationId}?`)) {
+    const cancelUrl = `http://localhost:8081/v1/reservations/${reservationId}/cancel`;
+
+    // Show the cancellation fee before asking for confirmation
+    let feeNotice = '';
+    try {
+        const quoteResponse = await fetch(cancelUrl);
+        if (quoteResponse.ok) {
+            const quote = await quoteResponse.json();
+            if (quote.amount_paid > 0) {
+                feeNotice = `\nCancellation fee: $${quote.cancellation_fee.toFixed(2)}\nRefund: $${quote.refund_amount.toFixed(2)}`;
+            }
+        }
+    } catch (error) {
+        console.error('Error fetching cancellation fee:', error);
+    }
+
+    if (!confirm(`Are you sure you want to cancel Reservation ID: ${reservationId}?${feeNotice}`)) {
         return;
     }
 
     try {
-        const response = await fetch(`http://localhost:8081/v1/reservations/${reservationId}/cancel`, {
+        const response = await fetch(cancelUrl, {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json',
@@ -95,14 +264,49 @@ async function cancelReservation(reservationId) {
         });
 
         if (!response.ok) {
-            throw new Error('Failed to cancel reservation.');
+            throw new Error(await response.text());
         }
 
-        alert("Reservation cancelled successfully.");
+        const result = await response.json();
+        if (result.refund_amount > 0) {
+            alert(`Reservation cancelled successfully. \n$${result.refund_amount.toFixed(2)} will be refunded shortly.`);
+        } else {
+            alert("Reservation cancelled successfully.");
+        }
         window.location.reload();
     } catch (error) {
         console.error('Error cancelling reservation:', error);
-        alert('Failed to cancel reservation. Please try again later.');
+        alert(`Failed to cancel reservation: ${error.message}`);
+    }
+}
+
+// Function to pick up or return the vehicle of a reservation
+async function handOverVehicle(reservationId, action) {
+    const userId = localStorage.getItem('user_id');
+    const label = action === 'pickup' ? 'pick up' : 'return';
+    if (!confirm(`Are you sure you want to ${label} the vehicle for Reservation ID: ${reservationId}?`)) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`http://localhost:8081/v1/bookings/${reservationId}/${action}`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ user_id: parseInt(userId) }),
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || `Failed to ${label} vehicle.`);
+        }
+
+        alert(action === 'pickup' ? "Vehicle picked up. Enjoy your trip!" : "Vehicle returned. Thank you for riding with ElectriGo!");
+        window.location.reload();
+    } catch (error) {
+        console.error(`Error trying to ${label} vehicle:`, error);
+        alert(error.message);
     }
 }
 
@@ -199,6 +403,7 @@ async function saveModifiedReservation() {
     const endDateTime = new Date(`${endDate} ${convertTo24Hour(endTime)}`).toISOString();
 
     const payload = {
+        user_id: parseInt(localStorage.getItem('user_id')),
         start_time: startDateTime,
         end_time: endDateTime,
     };
@@ -213,14 +418,21 @@ async function saveModifiedReservation() {
         });
 
         if (!response.ok) {
-            throw new Error('Failed to modify reservation.');
+            throw new Error(await response.text());
         }
 
-        alert("Reservation modified successfully. \nExtra amount before modification will be refunded shortly. \nIf any extra amount is needed, it will be charged later on.");
+        const result = await response.json();
+        if (result.price_difference > 0) {
+            alert(`Reservation modified successfully. \n$${result.price_difference.toFixed(2)} has been added to your invoice.`);
+        } else if (result.price_difference < 0) {
+            alert(`Reservation modified successfully. \n$${(-result.price_difference).toFixed(2)} will be refunded shortly.`);
+        } else {
+            alert("Reservation modified successfully.");
+        }
         window.location.reload();
     } catch (error) {
         console.error('Error modifying reservation:', error);
-        alert('Failed to modify reservation. Please try again later.');
+        alert(`Failed to modify reservation: ${error.message}`);
     }
 }
 
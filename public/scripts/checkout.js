@@ -1,23 +1,21 @@
 document.addEventListener('DOMContentLoaded', async () => {
     const urlParams = new URLSearchParams(window.location.search);
     const reservationId = urlParams.get('reservation_id');
+    const groupId = urlParams.get('group_id'); // A group booking is paid for in one checkout
     const userId = localStorage.getItem('user_id');
-    const checkoutApiUrl = `http://localhost:8081/v1/bookings/${reservationId}`;
-    const membershipApiUrl = `http://localhost:8080/v1/account/user/${userId}`;
-    const promotionsApiUrl = `http://localhost:8082/v1/promotions/apply`;
+    const checkoutApiUrl = groupId
+        ? `http://localhost:8081/v1/bookings/groups/${groupId}`
+        : `http://localhost:8081/v1/bookings/${reservationId}`;
+    const previewApiUrl = `http://localhost:8082/v1/payments/preview`;
 
-    if (!reservationId) {
+    if (!reservationId && !groupId) {
         alert("Invalid reservation. Redirecting to vehicles page.");
         window.location.href = "vehicles.html";
         return;
     }
 
     let reservation = null;
-    let membershipTier = null;
-    let baseCost = 0;
-    let totalCost = 0;
-    let discountPercentage = 0;
-    let promoDiscountAmount = 0;
+    let appliedPromoCode = ''; // The Payment Service works out the discounts again from the promo code
     let vehicleName = '';
     let hourlyRate = 0;
     let durationHours = 0;
@@ -36,17 +34,31 @@ document.addEventListener('DOMContentLoaded', async () => {
         }
 
         reservation = await response.json();
-        vehicleName = reservation.vehicle_name || 'Unknown Vehicle';
-        hourlyRate = reservation.hourly_rate || 0;
-        baseCost = reservation.total_cost || 0;
+        if (groupId) {
+            // Only reservations still awaiting payment are charged
+            const members = reservation.members.filter(member => member.status === 'Pending');
+            vehicleName = members.map(member => member.vehicle_name).join(', ');
+            hourlyRate = members.reduce((sum, member) => sum + member.hourly_rate, 0);
+
+            // Promo codes apply to single reservations only
+            document.getElementById('promoCodeSection').style.display = 'none';
+        } else {
+            vehicleName = reservation.vehicle_name || 'Unknown Vehicle';
+            hourlyRate = reservation.hourly_rate || 0;
+        }
 
         // Calculate rental duration in hours
         const startTime = new Date(reservation.start_time);
         const endTime = new Date(reservation.end_time);
         durationHours = Math.ceil((endTime - startTime) / (1000 * 60 * 60));
 
-        // Update cost summary
-        updateCostSummary(vehicleName, hourlyRate, membershipTier, durationHours, baseCost, 0, 0, baseCost);
+        // Unpaid reservations only hold the vehicle until their hold expires
+        if (reservation.hold_expires_at) {
+            const holdExpiresAt = new Date(reservation.hold_expires_at);
+            document.getElementById('reservationSummary').innerHTML = `
+                <p class="text-warning">${groupId ? 'These vehicles are' : 'This vehicle is'} held for you until ${holdExpiresAt.toLocaleTimeString()}. Complete payment before then to confirm your booking.</p>
+            `;
+        }
 
     } catch (error) {
         console.error('Error fetching reservation details:', error);
@@ -54,46 +66,14 @@ document.addEventListener('DOMContentLoaded', async () => {
         return;
     }
 
-    // Fetch membership details
+    // Show the amounts the Payment Service will invoice, including the membership discount
     try {
-        const response = await fetch(membershipApiUrl, {
-            method: 'GET',
-            headers: {
-                'Content-Type': 'application/json',
-            },
-        });
-
-        if (!response.ok) {
-            throw new Error('Failed to fetch membership details.');
-        }
-
-        const membershipData = await response.json();
-        membershipTier = membershipData.membership_tier || 'Basic';
-
-        // Determine discount percentage based on membership tier
-        switch (membershipTier) {
-            case 'Basic':
-                discountPercentage = 0;
-                break;
-            case 'Premium':
-                discountPercentage = 10;
-                break;
-            case 'VIP':
-                discountPercentage = 20;
-                break;
-            default:
-                discountPercentage = 0;
-        }
-
-        const membershipDiscount = (baseCost * discountPercentage) / 100;
-        totalCost = baseCost - membershipDiscount - promoDiscountAmount;
-
-        // Update cost summary with membership details
-        updateCostSummary(vehicleName, hourlyRate, membershipTier, durationHours, baseCost, membershipDiscount, promoDiscountAmount, totalCost);
-
+        const preview = await previewPayment('');
+        appliedPromoCode = preview.promo_code || ''; // Set when the reservation was booked with a quoted promo code
+        updateCostSummary(vehicleName, hourlyRate, durationHours, preview);
     } catch (error) {
-        console.error('Error fetching membership details:', error);
-        alert('Failed to load membership details. Please try again later.');
+        console.error('Error previewing payment:', error);
+        alert('Failed to load payment details. Please try again later.');
         return;
     }
 
@@ -105,51 +85,13 @@ document.addEventListener('DOMContentLoaded', async () => {
             return;
         }
     
-        const promoPayload = {
-            promo_code: promoCode,
-            reservation_id: parseInt(reservationId, 10),
-        };
-    
         try {
-            const response = await fetch(promotionsApiUrl, {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify(promoPayload),
-            });
-    
-            if (!response.ok) {
-                const errorText = await response.text();
-                console.error(`Promo code response error: ${errorText}`);
-                throw new Error('Invalid or expired promo code.');
-            }
-    
-            const promoData = await response.json();
-    
-            // Membership discount is applied first
-            const membershipDiscount = (baseCost * discountPercentage) / 100;
-            const costAfterMembershipDiscount = baseCost - membershipDiscount;
-    
-            // Apply promo discount to the remaining cost
-            promoDiscountAmount = (costAfterMembershipDiscount * promoData.discount_percentage) / 100;
-    
-            // Final total cost after all discounts
-            totalCost = costAfterMembershipDiscount - promoDiscountAmount;
+            // The Payment Service previews the discounts it will apply at payment
+            const preview = await previewPayment(promoCode);
+            appliedPromoCode = promoCode;
+            updateCostSummary(vehicleName, hourlyRate, durationHours, preview);
     
-            // Update the cost summary
-            updateCostSummary(
-                vehicleName,
-                hourlyRate,
-                membershipTier,
-                durationHours,
-                baseCost,
-                membershipDiscount,
-                promoDiscountAmount,
-                totalCost
-            );
-    
-            alert(`Promo code applied successfully! You saved ${promoData.discount_percentage}% on your booking.`);
+            alert(`Promo code applied successfully! You saved ${preview.promo_discount_percentage}% on your booking.`);
     
         } catch (error) {
             console.error('Error applying promo code:', error);
@@ -167,13 +109,11 @@ document.addEventListener('DOMContentLoaded', async () => {
         }
     
         const paymentPayload = {
-            reservation_id: parseInt(reservationId, 10),
+            reservation_id: groupId ? undefined : parseInt(reservationId, 10),
+            group_id: groupId ? parseInt(groupId, 10) : undefined,
             payment_method: paymentMethod,
             user_id: parseInt(userId, 10),
-            total_cost: baseCost, // Send the base cost instead of total cost
-            membership_discount: (baseCost * discountPercentage) / 100, // Send the calculated membership discount
-            promo_discount: promoDiscountAmount, // Send the calculated promo discount
-            final_amount: totalCost // Include the final amount after all discounts
+            promo_code: appliedPromoCode || undefined // Discounts are worked out by the Payment Service
         };
     
         try {
@@ -191,7 +131,7 @@ document.addEventListener('DOMContentLoaded', async () => {
             }
     
             alert('Payment successful! Your booking is confirmed.');
-            window.location.href = `confirmation.html?reservation_id=${reservationId}`;
+            window.location.href = groupId ? 'bookings.html' : `confirmation.html?reservation_id=${reservationId}`;
     
         } catch (error) {
             console.error('Error processing payment:', error);
@@ -224,19 +164,41 @@ document.addEventListener('DOMContentLoaded', async () => {
         }
     });
 
-    function updateCostSummary(vehicleName, hourlyRate, membershipTier, durationHours, baseCost, membershipDiscount, promoDiscount, totalCost) {
+    // Asks the Payment Service what paying would charge, with the promo code if given
+    async function previewPayment(promoCode) {
+        const response = await fetch(previewApiUrl, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                reservation_id: groupId ? undefined : parseInt(reservationId, 10),
+                group_id: groupId ? parseInt(groupId, 10) : undefined,
+                user_id: parseInt(userId, 10),
+                promo_code: promoCode || undefined,
+            }),
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(`Payment preview failed: ${errorText}`);
+        }
+        return response.json();
+    }
+
+    function updateCostSummary(vehicleName, hourlyRate, durationHours, preview) {
         const costSummary = document.getElementById('costSummary');
         costSummary.innerHTML = `
             <h3>Cost Summary</h3>
             <p><strong>Vehicle:</strong> ${vehicleName}</p>
             <p><strong>Hourly Rate:</strong> $${hourlyRate.toFixed(2)}</p>
-            <p><strong>Membership Level:</strong> ${membershipTier}</p>
+            <p><strong>Membership Level:</strong> ${preview.membership_tier}</p>
             <p><strong>Rental Duration:</strong> ${durationHours} hours</p>
             <hr>
-            <p><strong>Base Cost:</strong> $${baseCost.toFixed(2)}</p>
-            <p><strong>Membership Discount (${discountPercentage}%):</strong> -$${membershipDiscount.toFixed(2)}</p>
-            <p><strong>Promotional Discount:</strong> -$${promoDiscount.toFixed(2)}</p>
-            <p><strong>Total Cost:</strong> $${totalCost.toFixed(2)}</p>
+            <p><strong>Base Cost:</strong> $${preview.total_cost.toFixed(2)}</p>
+            <p><strong>Membership Discount (${preview.membership_discount_percentage}%):</strong> -$${preview.membership_discount.toFixed(2)}</p>
+            <p><strong>Promotional Discount:</strong> -$${preview.promo_discount.toFixed(2)}</p>
+            <p><strong>Total Cost:</strong> $${preview.final_amount.toFixed(2)}</p>
         `;
     }
 });
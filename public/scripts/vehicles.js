@@ -117,6 +117,36 @@ async function makeReservation(vehicleId) {
     };
 
     try {
+        // Get the price first; booking with the quote ID keeps this price for a few minutes
+        const quoteResponse = await fetch('http://localhost:8081/v1/bookings/quote', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(reservationPayload),
+        });
+
+        if (!quoteResponse.ok) {
+            const errorText = await quoteResponse.text();
+            console.error("Error response from server:", errorText);
+
+            // Offer a place on the waitlist when the vehicle is taken for this period
+            if (quoteResponse.status === 409 && confirm(`${errorText.trim()}\nWould you like to join the waitlist for this vehicle and period?`)) {
+                await joinWaitlist(reservationPayload);
+                return;
+            }
+            throw new Error(errorText || 'Failed to get a price quote.');
+        }
+
+        const quote = await quoteResponse.json();
+        if (!confirm(`Rental cost: $${quote.rental_cost.toFixed(2)}` +
+            (quote.membership_discount > 0 ? `\nMembership discount: -$${quote.membership_discount.toFixed(2)}` : '') +
+            `\nTotal: $${quote.total.toFixed(2)}` +
+            `\n\nThis price is held until ${new Date(quote.expires_at).toLocaleTimeString()}. Book now?`)) {
+            return;
+        }
+        reservationPayload.quote_id = quote.quote_id;
+
         const response = await fetch('http://localhost:8081/v1/bookings/reserve', {
             method: 'POST',
             headers: {
@@ -128,6 +158,12 @@ async function makeReservation(vehicleId) {
         if (!response.ok) {
             const errorText = await response.text(); // Read the server response
             console.error("Error response from server:", errorText);
+
+            // Offer a place on the waitlist when the vehicle is taken for this period
+            if (response.status === 409 && confirm(`${errorText.trim()}\nWould you like to join the waitlist for this vehicle and period?`)) {
+                await joinWaitlist(reservationPayload);
+                return;
+            }
             throw new Error(errorText || 'Failed to make a reservation.');
         }
 
@@ -144,6 +180,29 @@ async function makeReservation(vehicleId) {
     }
 }
 
+// Join the waitlist for a vehicle; the user is notified when it frees up
+async function joinWaitlist(reservationPayload) {
+    try {
+        const response = await fetch('http://localhost:8081/v1/waitlist', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(reservationPayload),
+        });
+
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+
+        const data = await response.json();
+        alert(`You are number ${data.position} on the waitlist. We will email you if the vehicle becomes available.`);
+    } catch (error) {
+        console.error('Error joining waitlist:', error);
+        alert(`Failed to join the waitlist: ${error.message}`);
+    }
+}
+
 function convertTo24Hour(time) {
     const [hour, modifier] = time.split(' ');
     let [hours, minutes] = hour.split(':').map(Number);
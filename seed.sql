@@ -5,7 +5,9 @@ USE ElectriGo_BillingDB;
 
 -- Drop foreign key constraints if they exist
 SET FOREIGN_KEY_CHECKS = 0; -- Temporarily disable foreign key checks
+DROP TABLE IF EXISTS Refunds;
 DROP TABLE IF EXISTS PaymentTransactions;
+DROP TABLE IF EXISTS InvoiceLineItems;
 DROP TABLE IF EXISTS Invoices;
 DROP TABLE IF EXISTS Promotions;
 
@@ -13,14 +15,36 @@ DROP TABLE IF EXISTS Promotions;
 USE ElectriGo_VehicleDB;
 
 -- Drop foreign key constraints if they exist
+DROP TABLE IF EXISTS BillingRequests;
+DROP TABLE IF EXISTS ZoneViolations;
+DROP TABLE IF EXISTS Zones;
+DROP TABLE IF EXISTS VehicleCommands;
+DROP TABLE IF EXISTS ChargingSessions;
+DROP TABLE IF EXISTS ChargingConnectors;
+DROP TABLE IF EXISTS ChargingStations;
+DROP TABLE IF EXISTS DamageRecords;
+DROP TABLE IF EXISTS ConditionPhotos;
+DROP TABLE IF EXISTS ConditionReports;
+DROP TABLE IF EXISTS VehicleTelemetry;
+DROP TABLE IF EXISTS MaintenanceRecords;
+DROP TABLE IF EXISTS LateReturns;
+DROP TABLE IF EXISTS WaitlistEntries;
+DROP TABLE IF EXISTS CalendarFeeds;
 DROP TABLE IF EXISTS Reservations;
+DROP TABLE IF EXISTS ReservationSeries;
+DROP TABLE IF EXISTS ReservationGroups;
 DROP TABLE IF EXISTS Vehicles;
+DROP TABLE IF EXISTS RatePlans;
+DROP TABLE IF EXISTS PublicHolidays;
+DROP TABLE IF EXISTS CancellationPolicies;
+DROP TABLE IF EXISTS Stations;
 
 -- Use ElectriGo_AccountDB
 USE ElectriGo_AccountDB;
 
 -- Drop tables if they exist
 DROP TABLE IF EXISTS Users;
+DROP TABLE IF EXISTS MembershipTiers;
 
 -- Drop databases if they exist
 DROP DATABASE IF EXISTS ElectriGo_AccountDB;
@@ -46,6 +70,7 @@ CREATE TABLE Users (
     email VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
     membership_tier ENUM('Basic', 'Premium', 'VIP') DEFAULT 'Basic',
+    role ENUM('Customer', 'Staff', 'FleetManager') DEFAULT 'Customer',
     first_name VARCHAR(50),
     last_name VARCHAR(50),
     date_of_birth DATE,
@@ -55,6 +80,19 @@ CREATE TABLE Users (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
 
+-- Create MembershipTiers Table (read by both the Car Rental and Payment Services)
+CREATE TABLE MembershipTiers (
+    membership_tier ENUM('Basic', 'Premium', 'VIP') PRIMARY KEY,
+    discount_percent DECIMAL(5, 2) NOT NULL DEFAULT 0.00 -- Discount on the rental cost, taken before promo codes
+);
+
+-- Insert Sample Data into MembershipTiers
+INSERT INTO MembershipTiers (membership_tier, discount_percent)
+VALUES
+('Basic', 0.00),
+('Premium', 10.00),
+('VIP', 20.00);
+
 -- Insert Sample Data into Users
 INSERT INTO Users (email, password_hash, membership_tier, first_name, last_name, date_of_birth, address)
 VALUES 
@@ -64,18 +102,100 @@ VALUES
 ('bob.white@example.com', '$2a$10$eAIugi6UQSOH89HbqMz49.GgYw0blDJwm3tzf..SlW/um9wtyWYtK', 'VIP', 'Bob', 'White', '1980-11-30', '123 Pine Street, Singapore'),
 ('charlie.gray@example.com', '$2a$10$eAIugi6UQSOH89HbqMz49.GgYw0blDJwm3tzf..SlW/um9wtyWYtK', 'Basic', 'Charlie', 'Gray', '1992-06-15', '321 Maple Street, Singapore');
 
+-- Insert Sample Fleet Staff into Users
+INSERT INTO Users (email, password_hash, role, first_name, last_name, date_of_birth, address)
+VALUES
+('fleet.staff@electrigo.com', '$2a$10$eAIugi6UQSOH89HbqMz49.GgYw0blDJwm3tzf..SlW/um9wtyWYtK', 'Staff', 'Fiona', 'Tan', '1991-03-08', '1 Fleet Road, Singapore'),
+('fleet.manager@electrigo.com', '$2a$10$eAIugi6UQSOH89HbqMz49.GgYw0blDJwm3tzf..SlW/um9wtyWYtK', 'FleetManager', 'Marcus', 'Lim', '1983-09-21', '1 Fleet Road, Singapore');
+
 -- Use VehicleDB
 USE ElectriGo_VehicleDB;
 
+-- Create Stations Table
+CREATE TABLE Stations (
+    station_id INT AUTO_INCREMENT PRIMARY KEY,
+    station_name VARCHAR(100) NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_stations_location (latitude, longitude)
+);
+
+-- Create RatePlans Table (rates are multiples of each vehicle's hourly_rate)
+CREATE TABLE RatePlans (
+    vehicle_class VARCHAR(30) PRIMARY KEY,
+    peak_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00, -- Weekdays between peak_start_hour and peak_end_hour
+    weekend_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00,
+    holiday_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00,
+    peak_start_hour TINYINT NOT NULL DEFAULT 0,
+    peak_end_hour TINYINT NOT NULL DEFAULT 0, -- Equal to peak_start_hour when there are no peak hours
+    daily_cap_hours DECIMAL(5, 2) NOT NULL DEFAULT 0, -- A rental day costs at most this many base hours (0 = no cap)
+    weekly_rate_days DECIMAL(5, 2) NOT NULL DEFAULT 0, -- A full week costs at most this many capped days (0 = none)
+    monthly_rate_days DECIMAL(5, 2) NOT NULL DEFAULT 0 -- A full 30 days cost at most this many capped days (0 = none)
+);
+
+-- Create PublicHolidays Table
+CREATE TABLE PublicHolidays (
+    holiday_date DATE PRIMARY KEY,
+    holiday_name VARCHAR(100) NOT NULL
+);
+
+-- Create CancellationPolicies Table (one per membership tier)
+CREATE TABLE CancellationPolicies (
+    membership_tier ENUM('Basic', 'Premium', 'VIP') PRIMARY KEY,
+    free_cancellation_hours DECIMAL(5, 2) NOT NULL, -- Cancelling is free until this many hours before the start time
+    late_fee_percent DECIMAL(5, 2) NOT NULL, -- Share of the amount paid kept when cancelling later; nothing is refunded after the start time
+    no_show_fee_percent DECIMAL(5, 2) NOT NULL DEFAULT 100.00 -- Share of the amount paid kept when the vehicle is never picked up
+);
+
 -- Create Vehicles Table
 CREATE TABLE Vehicles (
     vehicle_id INT AUTO_INCREMENT PRIMARY KEY,
     vehicle_name VARCHAR(100) NOT NULL,
     license_plate VARCHAR(20) UNIQUE NOT NULL,
-    availability_status ENUM('Available', 'Booked', 'Maintenance') DEFAULT 'Available',
+    availability_status ENUM('Available', 'Booked', 'InUse', 'Maintenance', 'OutOfService') DEFAULT 'Available',
     hourly_rate DECIMAL(10, 2) NOT NULL,
+    vehicle_class VARCHAR(30) NOT NULL DEFAULT 'Standard',
+    station_id INT NOT NULL,
+    battery_level DECIMAL(5, 2) NOT NULL DEFAULT 100.00, -- State of charge in percent
+    battery_capacity_kwh DECIMAL(6, 2) NOT NULL,
+    charge_rate_kw DECIMAL(6, 2) NOT NULL, -- Charging power available at the home station
+    max_range_km DECIMAL(7, 2) NOT NULL, -- Range on a full charge
+    connector_type ENUM('Type2', 'CCS2', 'CHAdeMO') NOT NULL DEFAULT 'CCS2',
+    odometer_km DECIMAL(10, 1) NOT NULL DEFAULT 0,
+    last_service_odometer_km DECIMAL(10, 1) NOT NULL DEFAULT 0,
+    last_service_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    service_interval_km INT NOT NULL DEFAULT 15000, -- Service is due after this many km
+    service_interval_hours INT NOT NULL DEFAULT 500, -- or after this many rental hours
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (station_id) REFERENCES Stations(station_id),
+    FOREIGN KEY (vehicle_class) REFERENCES RatePlans(vehicle_class)
+);
+
+-- Create ReservationSeries Table (recurring reservations; each occurrence is a row in Reservations)
+CREATE TABLE ReservationSeries (
+    series_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    vehicle_id INT NOT NULL,
+    rrule VARCHAR(255) NOT NULL, -- Recurrence rule, e.g. FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20250131
+    start_time DATETIME NOT NULL, -- Times of the first occurrence; later occurrences keep the same clock times
+    end_time DATETIME NOT NULL,
+    status ENUM('Active', 'Cancelled') DEFAULT 'Active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE
+);
+
+-- Create ReservationGroups Table (several vehicles booked together for the same period; each vehicle is a row in Reservations)
+CREATE TABLE ReservationGroups (
+    group_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE
 );
 
 -- Create Reservations Table
@@ -83,35 +203,351 @@ CREATE TABLE Reservations (
     reservation_id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
     vehicle_id INT NOT NULL,
+    pickup_station_id INT NOT NULL,
     start_time DATETIME NOT NULL,
     end_time DATETIME NOT NULL,
-    status ENUM('Active', 'Completed', 'Cancelled') DEFAULT 'Active',
+    status ENUM('Pending', 'Confirmed', 'InProgress', 'Completed', 'Cancelled', 'NoShow', 'Expired') DEFAULT 'Pending', -- Pending until paid, Expired if not paid in time
     total_cost DECIMAL(10, 2),
+    trip_distance_km DECIMAL(7, 2), -- Intended trip distance given at booking, if any
+    actual_pickup_at DATETIME,
+    actual_return_at DATETIME,
+    pickup_odometer_km DECIMAL(10, 1),
+    return_odometer_km DECIMAL(10, 1),
+    pickup_charge DECIMAL(5, 2), -- State of charge in percent at pick-up
+    return_charge DECIMAL(5, 2),
+    series_id INT, -- Recurring series this reservation is an occurrence of, if any
+    hold_expires_at DATETIME, -- A Pending reservation releases its vehicle at this time unless paid for
+    group_id INT, -- Group booking this reservation is part of, if any
+    promo_code VARCHAR(50), -- Promo code of the quote the reservation was booked with; it is paid for with this one
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Lets calendar feeds pick up changes
     FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE,
-    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (pickup_station_id) REFERENCES Stations(station_id),
+    FOREIGN KEY (series_id) REFERENCES ReservationSeries(series_id) ON DELETE SET NULL,
+    FOREIGN KEY (group_id) REFERENCES ReservationGroups(group_id) ON DELETE SET NULL
+);
+
+-- Create CalendarFeeds Table (secret address of each user's reservation calendar feed)
+CREATE TABLE CalendarFeeds (
+    user_id INT PRIMARY KEY,
+    token CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE
+);
+
+-- Create WaitlistEntries Table (users waiting for a vehicle, or any vehicle of a class, to free up)
+CREATE TABLE WaitlistEntries (
+    waitlist_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    vehicle_id INT, -- Either a specific vehicle
+    vehicle_class VARCHAR(30), -- or any vehicle of a class
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    status ENUM('Waiting', 'Offered', 'Accepted', 'Expired', 'Cancelled') DEFAULT 'Waiting',
+    offered_vehicle_id INT, -- Vehicle held for the user while Offered
+    offer_expires_at DATETIME,
+    reservation_id INT, -- Reservation made when the offer was accepted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (vehicle_class) REFERENCES RatePlans(vehicle_class),
+    FOREIGN KEY (offered_vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE SET NULL,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL
 );
 
+-- Create LateReturns Table (reservations returned after their end time)
+CREATE TABLE LateReturns (
+    late_return_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL UNIQUE,
+    scheduled_end_time DATETIME NOT NULL,
+    returned_at DATETIME NOT NULL,
+    minutes_late INT NOT NULL,
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    fee_status ENUM('Waived', 'Pending', 'Billed') DEFAULT 'Pending', -- Waived within the grace period
+    invoice_id INT, -- Supplementary invoice the fee was billed on
+    blocked_reservation_id INT, -- Next renter's reservation the late return delayed, if any
+    substitute_vehicle_id INT, -- Vehicle offered to that renter instead
+    substitute_status ENUM('Offered', 'Accepted', 'Unavailable'),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL,
+    FOREIGN KEY (substitute_vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE SET NULL
+);
+
+-- Create MaintenanceRecords Table
+CREATE TABLE MaintenanceRecords (
+    maintenance_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    maintenance_type ENUM('Service', 'Repair', 'Inspection', 'TyreChange', 'BatteryCheck') NOT NULL,
+    status ENUM('Scheduled', 'InProgress', 'Completed', 'Cancelled') DEFAULT 'Scheduled',
+    planned_start DATETIME NOT NULL,
+    planned_end DATETIME NOT NULL,
+    completed_at DATETIME,
+    notes TEXT,
+    triggered_automatically BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    INDEX idx_maintenance_vehicle_window (vehicle_id, planned_start, planned_end)
+);
+
+-- Create VehicleTelemetry Table (time-series, pruned after the retention period)
+CREATE TABLE VehicleTelemetry (
+    telemetry_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    recorded_at DATETIME(3) NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    odometer_km DECIMAL(10, 1) NOT NULL,
+    state_of_charge DECIMAL(5, 2) NOT NULL,
+    speed_kmh DECIMAL(5, 1) NOT NULL,
+    is_locked BOOLEAN NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    INDEX idx_telemetry_vehicle_time (vehicle_id, recorded_at),
+    INDEX idx_telemetry_time (recorded_at)
+);
+
+-- Create ConditionReports Table
+CREATE TABLE ConditionReports (
+    report_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    reservation_id INT,
+    user_id INT NOT NULL, -- Renter or staff member who filed the report
+    report_type ENUM('PickUp', 'Return', 'Inspection') NOT NULL,
+    checklist JSON NOT NULL,
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE
+);
+
+-- Create ConditionPhotos Table
+CREATE TABLE ConditionPhotos (
+    photo_id INT AUTO_INCREMENT PRIMARY KEY,
+    report_id INT NOT NULL,
+    file_path VARCHAR(255) NOT NULL,
+    uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (report_id) REFERENCES ConditionReports(report_id) ON DELETE CASCADE
+);
+
+-- Create DamageRecords Table
+CREATE TABLE DamageRecords (
+    damage_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    report_id INT NOT NULL, -- Report on which the damage was first found
+    reservation_id INT, -- Reservation during which the damage was discovered
+    item VARCHAR(50) NOT NULL,
+    severity ENUM('Minor', 'Moderate', 'Severe') NOT NULL,
+    description TEXT,
+    status ENUM('Open', 'Repaired') DEFAULT 'Open',
+    repaired_at DATETIME,
+    repaired_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (report_id) REFERENCES ConditionReports(report_id) ON DELETE CASCADE,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL,
+    INDEX idx_damage_vehicle_status (vehicle_id, status)
+);
+
+-- Create ChargingStations Table
+CREATE TABLE ChargingStations (
+    charging_station_id INT AUTO_INCREMENT PRIMARY KEY,
+    station_name VARCHAR(100) NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create ChargingConnectors Table
+CREATE TABLE ChargingConnectors (
+    connector_id INT AUTO_INCREMENT PRIMARY KEY,
+    charging_station_id INT NOT NULL,
+    connector_type ENUM('Type2', 'CCS2', 'CHAdeMO') NOT NULL,
+    power_kw DECIMAL(6, 2) NOT NULL,
+    price_per_kwh DECIMAL(6, 4) NOT NULL,
+    status ENUM('Available', 'Occupied', 'OutOfOrder') DEFAULT 'Available',
+    FOREIGN KEY (charging_station_id) REFERENCES ChargingStations(charging_station_id) ON DELETE CASCADE
+);
+
+-- Create ChargingSessions Table
+CREATE TABLE ChargingSessions (
+    session_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    vehicle_id INT NOT NULL,
+    connector_id INT NOT NULL,
+    simulated BOOLEAN DEFAULT FALSE,
+    status ENUM('Active', 'Completed') DEFAULT 'Active',
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at DATETIME,
+    start_charge DECIMAL(5, 2) NOT NULL,
+    end_charge DECIMAL(5, 2),
+    energy_kwh DECIMAL(8, 3) NOT NULL DEFAULT 0,
+    cost DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    billed BOOLEAN DEFAULT FALSE, -- Set once the cost is queued in BillingRequests
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (connector_id) REFERENCES ChargingConnectors(connector_id)
+);
+
+-- Create VehicleCommands Table
+CREATE TABLE VehicleCommands (
+    command_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    user_id INT NOT NULL, -- Renter or staff member who sent the command
+    command_type ENUM('Lock', 'Unlock', 'Locate', 'Honk', 'Immobilise', 'Mobilise') NOT NULL,
+    status ENUM('Queued', 'Delivered', 'Acknowledged', 'Failed') DEFAULT 'Queued',
+    result VARCHAR(255),
+    failure_reason VARCHAR(255),
+    created_at DATETIME NOT NULL,
+    delivered_at DATETIME,
+    acknowledged_at DATETIME,
+    expires_at DATETIME NOT NULL, -- Commands not acknowledged by this time fail with a timeout
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE,
+    INDEX idx_commands_vehicle_time (vehicle_id, created_at)
+);
+
+-- Create Zones Table (polygons stored as a JSON array of {"lat", "lng"} points)
+CREATE TABLE Zones (
+    zone_id INT AUTO_INCREMENT PRIMARY KEY,
+    zone_name VARCHAR(100) NOT NULL,
+    zone_type ENUM('ServiceArea', 'Restricted') NOT NULL,
+    polygon JSON NOT NULL,
+    violation_fee DECIMAL(10, 2) NOT NULL DEFAULT 0, -- Charged at return for each violation of this zone
+    active BOOLEAN DEFAULT TRUE,
+    created_by INT NOT NULL, -- Fleet manager who defined the zone
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES ElectriGo_AccountDB.Users(user_id)
+);
+
+-- Create ZoneViolations Table
+CREATE TABLE ZoneViolations (
+    violation_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    vehicle_id INT NOT NULL,
+    zone_id INT, -- NULL when the vehicle left the service area as a whole
+    violation_type ENUM('LeftServiceArea', 'EnteredRestrictedZone') NOT NULL,
+    latitude DECIMAL(9, 6) NOT NULL,
+    longitude DECIMAL(9, 6) NOT NULL,
+    detected_at DATETIME NOT NULL,
+    resolved_at DATETIME, -- Set once the vehicle is back in compliance
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    fee_status ENUM('None', 'Pending', 'Billed') DEFAULT 'None',
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (vehicle_id) REFERENCES Vehicles(vehicle_id) ON DELETE CASCADE,
+    FOREIGN KEY (zone_id) REFERENCES Zones(zone_id) ON DELETE SET NULL,
+    INDEX idx_violations_reservation (reservation_id, resolved_at)
+);
+
+-- Create BillingRequests Table (charges and refunds queued for the Payment Service, sent once the change that raised them is committed)
+CREATE TABLE BillingRequests (
+    request_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    kind ENUM('LineItem', 'Refund') NOT NULL,
+    item_type VARCHAR(30), -- Line item type, NULL for refunds
+    description VARCHAR(255) NOT NULL, -- Line item description or refund reason
+    amount DECIMAL(10, 2) NOT NULL,
+    status ENUM('Pending', 'Completed', 'Failed') NOT NULL DEFAULT 'Pending', -- Failed when the Payment Service rejects the request
+    result_amount DECIMAL(10, 2), -- Amount actually charged or refunded
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(255),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    INDEX idx_billing_requests_status (status, created_at)
+);
+
+-- Insert Sample Data into Stations
+INSERT INTO Stations (station_name, address, latitude, longitude)
+VALUES
+('Orchard Station', '2 Orchard Turn, Singapore 238801', 1.304052, 103.831767),
+('Marina Bay Station', '10 Bayfront Avenue, Singapore 018956', 1.282375, 103.858875),
+('Jurong East Station', '50 Jurong Gateway Road, Singapore 608549', 1.333115, 103.742297),
+('Tampines Station', '4 Tampines Central 5, Singapore 529510', 1.352650, 103.944770);
+
+-- Insert Sample Data into RatePlans
+INSERT INTO RatePlans (vehicle_class, peak_multiplier, weekend_multiplier, holiday_multiplier, peak_start_hour, peak_end_hour, daily_cap_hours, weekly_rate_days, monthly_rate_days)
+VALUES
+('Economy', 1.20, 1.15, 1.30, 17, 21, 8.00, 5.00, 18.00),
+('Standard', 1.25, 1.20, 1.40, 17, 21, 9.00, 5.00, 18.00),
+('Premium', 1.30, 1.25, 1.50, 17, 21, 10.00, 5.50, 20.00);
+
+-- Insert Sample Data into PublicHolidays
+INSERT INTO PublicHolidays (holiday_date, holiday_name)
+VALUES
+('2024-12-25', 'Christmas Day'),
+('2025-01-01', 'New Year''s Day'),
+('2025-01-29', 'Chinese New Year'),
+('2025-01-30', 'Chinese New Year'),
+('2025-03-31', 'Hari Raya Puasa'),
+('2025-04-18', 'Good Friday'),
+('2025-05-01', 'Labour Day'),
+('2025-05-12', 'Vesak Day'),
+('2025-06-07', 'Hari Raya Haji'),
+('2025-08-09', 'National Day'),
+('2025-10-20', 'Deepavali'),
+('2025-12-25', 'Christmas Day');
+
+-- Insert Sample Data into CancellationPolicies
+INSERT INTO CancellationPolicies (membership_tier, free_cancellation_hours, late_fee_percent, no_show_fee_percent)
+VALUES
+('Basic', 24.00, 50.00, 100.00),
+('Premium', 12.00, 25.00, 75.00),
+('VIP', 2.00, 10.00, 50.00);
+
 -- Insert Sample Data into Vehicles
-INSERT INTO Vehicles (vehicle_name, license_plate, availability_status, hourly_rate)
+INSERT INTO Vehicles (vehicle_name, license_plate, availability_status, hourly_rate, vehicle_class, station_id, battery_level, battery_capacity_kwh, charge_rate_kw, max_range_km, connector_type, odometer_km, last_service_odometer_km, last_service_at)
+VALUES
+('Tesla Model 3', 'EV1234A', 'Available', 20.00, 'Standard', 1, 82.00, 57.50, 11.00, 491.00, 'CCS2', 24310.0, 15200.0, '2024-09-02 09:00:00'),
+('Nissan Leaf', 'EV5678B', 'Booked', 15.00, 'Economy', 1, 45.00, 39.00, 7.40, 270.00, 'CHAdeMO', 38150.0, 36000.0, '2024-10-14 09:00:00'),
+('Chevrolet Bolt', 'EV9101C', 'Maintenance', 18.00, 'Economy', 2, 20.00, 65.00, 7.40, 417.00, 'CCS2', 45020.0, 30010.0, '2024-06-20 09:00:00'),
+('BMW i3', 'EV2022D', 'Available', 25.00, 'Premium', 3, 64.00, 37.90, 11.00, 293.00, 'CCS2', 12800.0, 12500.0, '2024-11-01 09:00:00'),
+('Hyundai Kona EV', 'EV3033E', 'Available', 22.00, 'Standard', 4, 95.00, 64.00, 11.00, 484.00, 'CCS2', 8020.0, 0.0, '2024-08-15 09:00:00');
+
+-- Insert Sample Data into ChargingStations
+INSERT INTO ChargingStations (station_name, address, latitude, longitude)
+VALUES
+('ElectriGo Hub Orchard', '2 Orchard Turn, Singapore 238801', 1.304052, 103.831767),
+('Marina Square Fast Charge', '6 Raffles Boulevard, Singapore 039594', 1.291100, 103.857600),
+('Jurong Point Charging', '1 Jurong West Central 2, Singapore 648886', 1.339700, 103.706600);
+
+-- Insert Sample Data into ChargingConnectors
+INSERT INTO ChargingConnectors (charging_station_id, connector_type, power_kw, price_per_kwh)
+VALUES
+(1, 'Type2', 22.00, 0.5200),
+(1, 'CCS2', 50.00, 0.6500),
+(2, 'CCS2', 150.00, 0.7800),
+(2, 'CHAdeMO', 50.00, 0.6500),
+(3, 'Type2', 7.40, 0.4800),
+(3, 'CCS2', 60.00, 0.6500);
+
+-- Insert Sample Data into Zones
+INSERT INTO Zones (zone_name, zone_type, polygon, violation_fee, created_by)
 VALUES
-('Tesla Model 3', 'EV1234A', 'Available', 20.00),
-('Nissan Leaf', 'EV5678B', 'Booked', 15.00),
-('Chevrolet Bolt', 'EV9101C', 'Maintenance', 18.00),
-('BMW i3', 'EV2022D', 'Available', 25.00),
-('Hyundai Kona EV', 'EV3033E', 'Available', 22.00);
+('Singapore Mainland', 'ServiceArea', '[{"lat": 1.470, "lng": 103.600}, {"lat": 1.470, "lng": 104.050}, {"lat": 1.240, "lng": 104.050}, {"lat": 1.240, "lng": 103.600}]', 100.00, 7),
+('Tuas Checkpoint', 'Restricted', '[{"lat": 1.352, "lng": 103.628}, {"lat": 1.352, "lng": 103.642}, {"lat": 1.340, "lng": 103.642}, {"lat": 1.340, "lng": 103.628}]', 50.00, 7),
+('Woodlands Checkpoint', 'Restricted', '[{"lat": 1.452, "lng": 103.763}, {"lat": 1.452, "lng": 103.775}, {"lat": 1.440, "lng": 103.775}, {"lat": 1.440, "lng": 103.763}]', 50.00, 7);
+
+-- Insert Sample Data into MaintenanceRecords
+INSERT INTO MaintenanceRecords (vehicle_id, maintenance_type, status, planned_start, planned_end, completed_at, notes)
+VALUES
+(1, 'Service', 'Completed', '2024-09-02 09:00:00', '2024-09-02 13:00:00', '2024-09-02 12:30:00', 'Routine 15,000 km service'),
+(3, 'Repair', 'InProgress', '2024-11-18 09:00:00', '2024-11-22 18:00:00', NULL, 'Replacing faulty onboard charger');
 
 -- Insert Sample Data into Reservations
-INSERT INTO Reservations (user_id, vehicle_id, start_time, end_time, status, total_cost)
+INSERT INTO Reservations (user_id, vehicle_id, pickup_station_id, start_time, end_time, status, total_cost)
 VALUES 
-(1, 1, '2024-11-10 09:00:00', '2024-11-10 15:00:00', 'Completed', 120.00), -- John Doe
-(2, 2, '2024-11-11 09:00:00', '2024-11-11 15:00:00', 'Completed', 90.00), -- Jane Smith
-(3, 3, '2024-11-12 09:00:00', '2024-11-12 15:00:00', 'Cancelled', 0.00), -- Alice Brown
-(4, 4, '2024-11-13 09:00:00', '2024-11-13 15:00:00', 'Completed', 150.00), -- Bob White
-(5, 1, '2024-11-14 10:00:00', '2024-11-14 16:00:00', 'Completed', 130.00), -- Charlie Gray
-(5, 2, '2024-11-15 09:00:00', '2024-11-15 12:00:00', 'Completed', 45.00), -- Charlie Gray
-(5, 4, '2024-11-16 13:00:00', '2024-11-16 15:00:00', 'Completed', 50.00), -- Charlie Gray
-(5, 5, '2024-11-17 08:00:00', '2024-11-17 10:00:00', 'Completed', 44.00); -- Charlie Gray
+(1, 1, 1, '2024-11-10 09:00:00', '2024-11-10 15:00:00', 'Completed', 120.00), -- John Doe
+(2, 2, 1, '2024-11-11 09:00:00', '2024-11-11 15:00:00', 'Completed', 90.00), -- Jane Smith
+(3, 3, 2, '2024-11-12 09:00:00', '2024-11-12 15:00:00', 'Cancelled', 0.00), -- Alice Brown
+(4, 4, 3, '2024-11-13 09:00:00', '2024-11-13 15:00:00', 'Completed', 150.00), -- Bob White
+(5, 1, 1, '2024-11-14 10:00:00', '2024-11-14 16:00:00', 'Completed', 130.00), -- Charlie Gray
+(5, 2, 1, '2024-11-15 09:00:00', '2024-11-15 12:00:00', 'Completed', 45.00), -- Charlie Gray
+(5, 4, 3, '2024-11-16 13:00:00', '2024-11-16 15:00:00', 'Completed', 50.00), -- Charlie Gray
+(5, 5, 4, '2024-11-17 08:00:00', '2024-11-17 10:00:00', 'Completed', 44.00); -- Charlie Gray
 
 -- Use BillingDB
 USE ElectriGo_BillingDB;
@@ -119,14 +555,18 @@ USE ElectriGo_BillingDB;
 -- Create Invoices Table
 CREATE TABLE Invoices (
     invoice_id INT AUTO_INCREMENT PRIMARY KEY,
-    reservation_id INT NOT NULL,
+    reservation_id INT, -- NULL on the combined invoice of a group booking
+    group_id INT, -- Group booking billed on this invoice, if any
     user_id INT NOT NULL,
+    invoice_type ENUM('Rental', 'Supplementary') NOT NULL DEFAULT 'Rental', -- Supplementary invoices bill charges raised after the rental
     total_cost DECIMAL(10, 2),
     membership_discount DECIMAL(10, 2) DEFAULT 0,
     promo_discount DECIMAL(10, 2) DEFAULT 0,
     final_amount DECIMAL(10, 2),
+    request_key VARCHAR(64) UNIQUE, -- Set by the caller so a retried supplementary invoice is only created once
     issued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (reservation_id) REFERENCES ElectriGo_VehicleDB.Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES ElectriGo_VehicleDB.ReservationGroups(group_id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES ElectriGo_AccountDB.Users(user_id) ON DELETE CASCADE
 );
 
@@ -139,6 +579,20 @@ CREATE TABLE Promotions (
     valid_until DATE
 );
 
+-- Create InvoiceLineItems Table (charges added to a reservation on top of the rental)
+CREATE TABLE InvoiceLineItems (
+    line_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    invoice_id INT, -- NULL until the reservation is invoiced at payment
+    item_type ENUM('Rental', 'Charging', 'GeofenceFee', 'Extension', 'Modification', 'LateReturn') NOT NULL, -- Rental is each reservation's share of a group invoice
+    description VARCHAR(255) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    request_key VARCHAR(64) UNIQUE, -- Set by the caller so a retried charge is only added once
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reservation_id) REFERENCES ElectriGo_VehicleDB.Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (invoice_id) REFERENCES Invoices(invoice_id) ON DELETE CASCADE
+);
+
 -- Create PaymentTransactions Table
 CREATE TABLE PaymentTransactions (
     transaction_id INT AUTO_INCREMENT PRIMARY KEY,
@@ -151,6 +605,19 @@ CREATE TABLE PaymentTransactions (
     FOREIGN KEY (invoice_id) REFERENCES Invoices(invoice_id) ON DELETE CASCADE
 );
 
+-- Create Refunds Table (partial refunds of an invoice, e.g. when a paid reservation is made cheaper)
+CREATE TABLE Refunds (
+    refund_id INT AUTO_INCREMENT PRIMARY KEY,
+    invoice_id INT NOT NULL,
+    reservation_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    request_key VARCHAR(64) UNIQUE, -- Set by the caller so a retried refund is only paid once
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (invoice_id) REFERENCES Invoices(invoice_id) ON DELETE CASCADE,
+    FOREIGN KEY (reservation_id) REFERENCES ElectriGo_VehicleDB.Reservations(reservation_id) ON DELETE CASCADE
+);
+
 -- Insert Sample Data into BillingDB
 INSERT INTO Promotions (promo_code, discount_percentage, valid_from, valid_until)
 VALUES 